@@ -0,0 +1,181 @@
+// Package admin implements the eurofines-admin maintenance commands. They use
+// the same config, db and repository packages as the server, so they always
+// agree with it about configuration, schema and how records are written.
+package admin
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"gorm.io/gorm"
+)
+
+const usage = `usage: eurofines-admin [config flags] <command> [flags]
+
+commands:
+  create-admin      create an administrator account
+  reset-password    set a new password for a user
+  disable-user      disable (or with -enable, re-enable) a user account
+  unlock-user       lift a lockout caused by failed sign-ins
+  reset-mfa         remove a user's two-factor authentication
+  normalize-emails  lower-case and trim stored email addresses
+  seed-demo-data    create demo records for every entity
+  migrate           apply or roll back schema migrations (up, down [n], status)
+  verify-integrity  check version history, deletion audit trail and users
+  export-audit      export the audit log as CSV, XLSX or PDF
+  cluster-sponsors  propose sponsor records for free-text company names, or apply a reviewed plan
+
+Config flags are the server's (-config, -db-driver, -db-host, ...); run
+eurofines-admin -h for the list. Run eurofines-admin <command> -h for command flags.`
+
+// App runs commands against one database
+type App struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Repos  *repository.Repositories
+	Out    io.Writer
+	Err    io.Writer
+	// Actor is recorded in the audit log for changes made by commands
+	Actor repository.Actor
+}
+
+var (
+	// errUsage means the command line was wrong; usage has already been printed
+	errUsage = errors.New("usage")
+	// errReported means the command failed and has already said why
+	errReported = errors.New("failed")
+)
+
+type command struct {
+	run func(a *App, args []string) error
+	// skipSchemaCheck lets migrate run against an out-of-date schema
+	skipSchemaCheck bool
+}
+
+var commands = map[string]command{
+	"create-admin":     {run: (*App).createAdmin},
+	"reset-password":   {run: (*App).resetPassword},
+	"disable-user":     {run: (*App).disableUser},
+	"unlock-user":      {run: (*App).unlockUser},
+	"reset-mfa":        {run: (*App).resetMFA},
+	"normalize-emails": {run: (*App).normalizeEmails},
+	"seed-demo-data":   {run: (*App).seedDemoData},
+	"migrate":          {run: (*App).migrate, skipSchemaCheck: true},
+	"verify-integrity": {run: (*App).verifyIntegrity},
+	"export-audit":     {run: (*App).exportAudit},
+	"cluster-sponsors": {run: (*App).clusterSponsors},
+}
+
+// Main loads the configuration, connects to the database and runs the
+// command in args. It returns the process exit code.
+func Main(args []string) int {
+	cfg, rest, err := config.Load(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, usage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration: %v\n", err)
+		return 2
+	}
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	database, err := db.ConnectDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return New(database, cfg, os.Stdout, os.Stderr).Run(rest)
+}
+
+// New returns an App writing output to out and diagnostics to errOut
+func New(database *gorm.DB, cfg *config.Config, out, errOut io.Writer) *App {
+	return &App{
+		DB:     database,
+		Config: cfg,
+		Repos:  repository.New(database),
+		Out:    out,
+		Err:    errOut,
+		Actor:  repository.Actor{Email: cliActor()},
+	}
+}
+
+// Run runs one command, args[0] being its name, and returns the exit code
+func (a *App) Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(a.Err, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.Err, "unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+	if !cmd.skipSchemaCheck {
+		if err := db.CheckSchema(a.DB); err != nil {
+			fmt.Fprintf(a.Err, "❌ %v (run `eurofines-admin migrate up`)\n", err)
+			return 1
+		}
+	}
+
+	err := cmd.run(a, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, errReported):
+		return 1
+	default:
+		fmt.Fprintf(a.Err, "❌ %v\n", err)
+		return 1
+	}
+}
+
+// flags returns a flag set for a command that reports errors to a.Err
+func (a *App) flags(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.Err)
+	fs.Usage = func() {
+		fmt.Fprintf(a.Err, "usage: eurofines-admin %s\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses command flags, mapping errors to errUsage
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// cliActor names the operating-system user in audit entries
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
@@ -0,0 +1,304 @@
+package admin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"eurofines-server/admin"
+	"eurofines-server/internal/apitest"
+	"eurofines-server/repository"
+)
+
+// run executes one eurofines-admin command against srv's database
+func run(t *testing.T, srv *apitest.Server, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = admin.New(srv.DB, srv.Config, &out, &errOut).Run(args)
+	return code, out.String(), errOut.String()
+}
+
+func signIn(srv *apitest.Server, email, password string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": email, "password": password})
+}
+
+func TestCreateAdmin(t *testing.T) {
+	srv := apitest.New(t)
+
+	code, out, errOut := run(t, srv, "create-admin", "-email", " Boss@Example.com ", "-password", apitest.Password)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, errOut)
+	}
+	if !strings.Contains(out, "created admin boss@example.com") {
+		t.Fatalf("output %q", out)
+	}
+	res := signIn(srv, "boss@example.com", apitest.Password).Expect(http.StatusOK).JSON()
+	if res["user"].(map[string]interface{})["role"] != "admin" {
+		t.Fatalf("created user is not an admin: %v", res)
+	}
+
+	if code, _, _ := run(t, srv, "create-admin", "-email", "boss@example.com", "-password", apitest.Password); code != 1 {
+		t.Fatalf("duplicate admin: exit %d, want 1", code)
+	}
+	if code, _, _ := run(t, srv, "create-admin", "-email", "other@example.com", "-password", "short"); code != 1 {
+		t.Fatalf("short password: exit %d, want 1", code)
+	}
+	if code, _, _ := run(t, srv, "create-admin"); code != 2 {
+		t.Fatalf("missing -email: exit %d, want 2", code)
+	}
+
+	code, out, _ = run(t, srv, "create-admin", "-email", "gen@example.com")
+	if code != 0 {
+		t.Fatalf("generated password: exit %d", code)
+	}
+	_, password, _ := strings.Cut(out, "password: ")
+	signIn(srv, "gen@example.com", strings.TrimSpace(password)).Expect(http.StatusOK)
+}
+
+func TestResetPasswordAndDisableUser(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("staff@example.com", "user")
+
+	if code, _, errOut := run(t, srv, "reset-password", "-email", "staff@example.com", "-password", "A-brand-new-password-2"); code != 0 {
+		t.Fatalf("reset-password: exit %d: %s", code, errOut)
+	}
+	signIn(srv, "staff@example.com", apitest.Password).Expect(http.StatusUnauthorized)
+	signIn(srv, "staff@example.com", "A-brand-new-password-2").Expect(http.StatusOK)
+
+	if code, _, _ := run(t, srv, "disable-user", "-email", "staff@example.com"); code != 0 {
+		t.Fatalf("disable-user: exit %d", code)
+	}
+	signIn(srv, "staff@example.com", "A-brand-new-password-2").Expect(http.StatusForbidden)
+
+	if code, _, _ := run(t, srv, "disable-user", "-email", "staff@example.com", "-enable"); code != 0 {
+		t.Fatalf("disable-user -enable: exit %d", code)
+	}
+	signIn(srv, "staff@example.com", "A-brand-new-password-2").Expect(http.StatusOK)
+
+	if code, _, errOut := run(t, srv, "disable-user", "-email", "ghost@example.com"); code != 1 || !strings.Contains(errOut, "no user") {
+		t.Fatalf("unknown user: exit %d: %s", code, errOut)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("staff@example.com", "user")
+	for i := 0; i < srv.Config.LockoutThreshold; i++ {
+		signIn(srv, "staff@example.com", "wrong-password").Expect(http.StatusUnauthorized)
+	}
+	signIn(srv, "staff@example.com", apitest.Password).Expect(http.StatusLocked)
+
+	if code, out, errOut := run(t, srv, "unlock-user", "-email", "staff@example.com"); code != 0 || !strings.Contains(out, "unlocked") {
+		t.Fatalf("unlock-user: exit %d: %s%s", code, out, errOut)
+	}
+	signIn(srv, "staff@example.com", apitest.Password).Expect(http.StatusOK)
+}
+
+func TestResetMFA(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("staff@example.com", "user")
+	ctx := context.Background()
+	if err := srv.Repos.MFA.StartEnrollment(ctx, u.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Repos.MFA.Enable(ctx, u.ID, 1, nil, repository.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if res := signIn(srv, u.Email, apitest.Password).Expect(http.StatusOK).JSON(); res["mfa_required"] != true {
+		t.Fatalf("signin with MFA: %v", res)
+	}
+
+	if code, out, errOut := run(t, srv, "reset-mfa", "-email", u.Email); code != 0 || !strings.Contains(out, "removed two-factor") {
+		t.Fatalf("reset-mfa: exit %d: %s%s", code, out, errOut)
+	}
+	if res := signIn(srv, u.Email, apitest.Password).Expect(http.StatusOK).JSON(); res["token"] == nil {
+		t.Fatalf("signin after reset-mfa: %v", res)
+	}
+}
+
+func TestNormalizeEmails(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("Mixed.Case@Example.com", "user")
+	srv.CreateUser("taken@example.com", "user")
+	srv.CreateUser("TAKEN@example.com", "user")
+
+	code, out, errOut := run(t, srv, "normalize-emails", "-dry-run")
+	if code != 1 || !strings.Contains(out, "would normalize 1 of 3") || !strings.Contains(errOut, "conflicts") {
+		t.Fatalf("dry run: exit %d\n%s%s", code, out, errOut)
+	}
+
+	run(t, srv, "normalize-emails")
+	users, err := srv.Repos.Users.List(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := map[string]bool{}
+	for _, u := range users {
+		emails[u.Email] = true
+	}
+	if !emails["mixed.case@example.com"] || !emails["TAKEN@example.com"] {
+		t.Fatalf("emails after normalize: %v", emails)
+	}
+}
+
+func TestSeedAndVerifyIntegrity(t *testing.T) {
+	srv := apitest.New(t)
+
+	code, out, errOut := run(t, srv, "seed-demo-data", "-per-entity", "2")
+	if code != 0 || !strings.Contains(out, "created 18 demo records") {
+		t.Fatalf("seed: exit %d\n%s%s", code, out, errOut)
+	}
+	list := srv.Do(http.MethodGet, "/api/studies?entity=agro", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(list) != 2 {
+		t.Fatalf("agro has %d demo studies, want 2", len(list))
+	}
+
+	if code, out, _ := run(t, srv, "verify-integrity"); code != 0 {
+		t.Fatalf("verify-integrity on a clean database: exit %d\n%s", code, out)
+	}
+
+	// a change made behind the application's back
+	srv.DB.Exec("UPDATE studies SET version = version + 1 WHERE id = 1")
+	srv.DB.Exec("UPDATE test_items SET deleted_at = CURRENT_TIMESTAMP WHERE id = 2")
+	code, out, _ = run(t, srv, "verify-integrity")
+	if code != 1 || !strings.Contains(out, "study 1 is at version 2") || !strings.Contains(out, "test_item 2 is deleted") {
+		t.Fatalf("verify-integrity after tampering: exit %d\n%s", code, out)
+	}
+
+	srv.Config.Env = "production"
+	if code, _, errOut := run(t, srv, "seed-demo-data"); code != 1 || !strings.Contains(errOut, "production") {
+		t.Fatalf("seed in production: exit %d: %s", code, errOut)
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	srv.Do(http.MethodDelete, "/api/studies/"+strconv.FormatUint(uint64(fx.Studies["agro"].ID), 10), map[string]string{"reason": "duplicate entry"}, admin).
+		Expect(http.StatusOK)
+	run(t, srv, "disable-user", "-email", "admin@example.com")
+
+	code, out, errOut := run(t, srv, "export-audit", "-action", "delete")
+	if code != 0 {
+		t.Fatalf("export-audit: exit %d: %s", code, errOut)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][2] != "admin@example.com" || rows[1][4] != "study" || rows[1][6] != "duplicate entry" {
+		t.Fatalf("audit export = %v", rows)
+	}
+
+	if code, _, _ := run(t, srv, "export-audit", "-format", "docx"); code != 1 {
+		t.Fatalf("bad format: exit %d, want 1", code)
+	}
+}
+
+func TestClusterSponsors(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	for _, name := range []string{"ACME Pharma Ltd.", " Globex Limited", "globex"} {
+		srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "sample", "company_name": name, "entity": "agro"}, admin).
+			Expect(http.StatusCreated)
+	}
+	srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{"study_number": "ST-9", "test_item_code": "TI-001", "entity": "adgyl"}, admin).
+		Expect(http.StatusCreated)
+
+	plan := filepath.Join(t.TempDir(), "plan.csv")
+	if code, out, errOut := run(t, srv, "cluster-sponsors", "-o", plan); code != 0 || !strings.Contains(out, "proposed 2 sponsors for 4 company names") {
+		t.Fatalf("cluster-sponsors: exit %d\n%s%s", code, out, errOut)
+	}
+	data, err := os.ReadFile(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposed := map[string]string{}
+	for _, row := range rows[1:] {
+		proposed[row[1]] = row[3]
+	}
+	if proposed["ACME Pharma Ltd."] != "Acme Pharma" || proposed["Globex Limited"] != proposed["globex"] {
+		t.Fatalf("plan = %v", rows)
+	}
+
+	// the admin confirms the plan, naming the second sponsor properly
+	reviewed := strings.ReplaceAll(string(data), ","+proposed["globex"]+"\n", ",Globex Corporation\n")
+	if err := os.WriteFile(plan, []byte(reviewed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, out, errOut := run(t, srv, "cluster-sponsors", "-apply", plan)
+	if code != 0 || !strings.Contains(out, "Acme Pharma (created): 4 test items, 1 studies") ||
+		!strings.Contains(out, "Globex Corporation (created): 2 test items, 0 studies") {
+		t.Fatalf("apply: exit %d\n%s%s", code, out, errOut)
+	}
+
+	items := srv.Do(http.MethodGet, "/api/test-items?entity=agro", nil, admin).Expect(http.StatusOK).JSON()["test_items"].([]interface{})
+	for _, item := range items {
+		if m := item.(map[string]interface{}); m["sponsor_id"] == nil || (m["company_name"] != "Acme Pharma" && m["company_name"] != "Globex Corporation") {
+			t.Fatalf("test item after apply = %v", m)
+		}
+	}
+	if _, out, _ := run(t, srv, "cluster-sponsors"); strings.Count(out, "\n") != 1 {
+		t.Fatalf("plan after apply = %q", out)
+	}
+}
+
+func TestClusterSponsorsSharedTestItemCodes(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	for _, item := range []struct{ company, code, entity string }{
+		{"Acme Pharma", "X-1", "agro"}, {"Globex", "X-1", "agro"}, {"Acme Pharma", "A-2", "adgyl"},
+	} {
+		srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+			"test_item_name": "sample", "company_name": item.company, "test_item_code": item.code, "entity": item.entity,
+		}, admin).Expect(http.StatusCreated)
+	}
+	study := func(number, code, entity string) string {
+		created := srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{"study_number": number, "test_item_code": code, "entity": entity}, admin).
+			Expect(http.StatusCreated).JSON()["study"].(map[string]interface{})
+		return fmt.Sprintf("/api/studies/%v", created["id"])
+	}
+	shared, elsewhere, own := study("ST-1", "X-1", "agro"), study("ST-2", "A-2", "biopharma"), study("ST-3", "A-2", "adgyl")
+
+	plan := filepath.Join(t.TempDir(), "plan.csv")
+	if code, out, errOut := run(t, srv, "cluster-sponsors", "-o", plan); code != 0 {
+		t.Fatalf("cluster-sponsors: exit %d\n%s%s", code, out, errOut)
+	}
+	code, out, errOut := run(t, srv, "cluster-sponsors", "-apply", plan)
+	if code != 0 || !strings.Contains(out, "Acme Pharma (created): 2 test items, 1 studies") ||
+		!strings.Contains(out, "Globex (created): 1 test items, 0 studies") {
+		t.Fatalf("apply: exit %d\n%s%s", code, out, errOut)
+	}
+	// a code shared with another company, or from another entity, does not link
+	for path, linked := range map[string]bool{shared: false, elsewhere: false, own: true} {
+		got := srv.Do(http.MethodGet, path, nil, admin).Expect(http.StatusOK).JSON()["study"].(map[string]interface{})
+		if (got["sponsor_id"] != nil) != linked {
+			t.Fatalf("%s after apply = %v", got["study_number"], got)
+		}
+	}
+}
+
+func TestUnknownCommandAndMigrateStatus(t *testing.T) {
+	srv := apitest.New(t)
+
+	if code, _, _ := run(t, srv, "frobnicate"); code != 2 {
+		t.Fatalf("unknown command: exit %d, want 2", code)
+	}
+	code, out, _ := run(t, srv, "migrate", "status")
+	if code != 0 || !strings.Contains(out, "0001_initial_schema") {
+		t.Fatalf("migrate status: exit %d\n%s", code, out)
+	}
+}
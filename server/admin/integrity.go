@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+)
+
+// integrityTables are the archive registers checked by verify-integrity
+var integrityTables = []struct {
+	recordType string
+	table      string
+}{
+	{repository.RecordTypeTestItem, "test_items"},
+	{repository.RecordTypeStudy, "studies"},
+	{repository.RecordTypeFacilityDoc, "facility_docs"},
+}
+
+// verifyIntegrity cross-checks the archive registers against their version
+// history and audit trail. It changes nothing and fails if any check does.
+func (a *App) verifyIntegrity(args []string) error {
+	fs := a.flags("verify-integrity", "verify-integrity")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	checks := []struct {
+		name string
+		run  func() ([]string, error)
+	}{
+		{"records match their latest version snapshot", a.checkVersionHistory},
+		{"deleted records have a deletion audit entry", a.checkDeletionAudit},
+		{"version history belongs to existing or purged records", a.checkOrphanedHistory},
+		{"user emails are unique ignoring case", a.checkUserEmails},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		problems, err := c.run()
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(a.Out, "✅ %s\n", c.name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(a.Out, "❌ %s\n", c.name)
+		for _, p := range problems {
+			fmt.Fprintf(a.Out, "   - %s\n", p)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(a.Err, "%d of %d checks failed\n", failed, len(checks))
+		return errReported
+	}
+	return nil
+}
+
+// checkVersionHistory finds records whose stored version differs from their
+// newest snapshot, i.e. rows changed outside the application
+func (a *App) checkVersionHistory() ([]string, error) {
+	var problems []string
+	for _, t := range integrityTables {
+		var rows []struct {
+			ID      uint
+			Version int
+			Data    *string
+		}
+		err := a.DB.Raw(fmt.Sprintf(`SELECT r.id, r.version, v.data FROM %s r
+			LEFT JOIN record_versions v ON v.record_type = ? AND v.record_id = r.id
+				AND v.version = (SELECT MAX(version) FROM record_versions WHERE record_type = ? AND record_id = r.id)
+			ORDER BY r.id`, t.table), t.recordType, t.recordType).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			if r.Data == nil {
+				// records from before versioning get history on their first change
+				if r.Version > 1 {
+					problems = append(problems, fmt.Sprintf("%s %d is at version %d but has no version history", t.recordType, r.ID, r.Version))
+				}
+				continue
+			}
+			var snapshot struct {
+				Version int `json:"version"`
+			}
+			if err := json.Unmarshal([]byte(*r.Data), &snapshot); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %d: latest snapshot is not valid JSON: %v", t.recordType, r.ID, err))
+				continue
+			}
+			if snapshot.Version != r.Version {
+				problems = append(problems, fmt.Sprintf("%s %d is at version %d but its latest snapshot is of version %d",
+					t.recordType, r.ID, r.Version, snapshot.Version))
+			}
+		}
+	}
+	return problems, nil
+}
+
+func (a *App) checkDeletionAudit() ([]string, error) {
+	var problems []string
+	for _, t := range integrityTables {
+		var ids []uint
+		err := a.DB.Raw(fmt.Sprintf(`SELECT r.id FROM %s r WHERE r.deleted_at IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM audit_logs l WHERE l.record_type = ? AND l.record_id = r.id AND l.action = ?)
+			ORDER BY r.id`, t.table), t.recordType, db.AuditDelete).Scan(&ids).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			problems = append(problems, fmt.Sprintf("%s %d is deleted but the audit log has no deletion entry", t.recordType, id))
+		}
+	}
+	return problems, nil
+}
+
+// checkOrphanedHistory finds history for rows that vanished without a purge
+func (a *App) checkOrphanedHistory() ([]string, error) {
+	var problems []string
+	for _, t := range integrityTables {
+		var ids []uint
+		err := a.DB.Raw(fmt.Sprintf(`SELECT DISTINCT v.record_id FROM record_versions v
+			WHERE v.record_type = ?
+			AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.id = v.record_id)
+			AND NOT EXISTS (SELECT 1 FROM audit_logs l WHERE l.record_type = v.record_type AND l.record_id = v.record_id AND l.action = ?)
+			ORDER BY v.record_id`, t.table), t.recordType, db.AuditPurge).Scan(&ids).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			problems = append(problems, fmt.Sprintf("%s %d has version history but was removed without a purge", t.recordType, id))
+		}
+	}
+	return problems, nil
+}
+
+func (a *App) checkUserEmails() ([]string, error) {
+	var dupes []struct {
+		Email string
+		Count int
+	}
+	err := a.DB.Raw(`SELECT LOWER(email) AS email, COUNT(*) AS count FROM users
+		GROUP BY LOWER(email) HAVING COUNT(*) > 1 ORDER BY 1`).Scan(&dupes).Error
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, d := range dupes {
+		problems = append(problems, fmt.Sprintf("%d accounts share the email %s", d.Count, d.Email))
+	}
+	return problems, nil
+}
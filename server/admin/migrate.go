@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: %s migrate <command>
+
+commands:
+  up         apply all pending migrations
+  down [n]   roll back the last n migrations (default 1)
+  status     list migrations and whether they are applied`
+
+func (a *App) migrate(args []string) error {
+	if code := Migrate(a.DB, "eurofines-admin", args, a.Out, a.Err); code != 0 {
+		if code == 2 {
+			return errUsage
+		}
+		return errReported
+	}
+	return nil
+}
+
+// Migrate implements the `migrate` subcommand shared by eurofines-server and
+// eurofines-admin, and returns the exit code
+func Migrate(database *gorm.DB, prog string, args []string, out, errOut io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(errOut, migrateUsage+"\n", prog)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(database)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "❌ %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(errOut, "invalid step count: %s\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+		rolledBack, err := db.MigrateDown(database, steps)
+		for _, m := range rolledBack {
+			fmt.Fprintf(out, "rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "❌ %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(out, "nothing to roll back")
+		}
+
+	case "status":
+		states, err := db.MigrationStatus(database)
+		if err != nil {
+			fmt.Fprintf(errOut, "❌ %v\n", err)
+			return 1
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Fprintf(errOut, migrateUsage+"\n", prog)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+)
+
+var seedEntities = []string{"adgyl", "agro", "biopharma"}
+
+var (
+	demoCompounds = []string{"Paracetamol", "Ibuprofen", "Glyphosate", "Chlorpyrifos", "Metformin", "Atrazine", "Caffeine", "Imidacloprid"}
+	demoSponsors  = []string{"Acme Pharma", "Greenfield Agro", "Nova Biologics", "Helix Labs"}
+	demoDirectors = []string{"Dr. A. Rao", "Dr. S. Menon", "Dr. P. Iyer", "Dr. K. Shah"}
+	demoDepts     = []string{"QA", "QC", "Facility", "Archives"}
+	demoDocs      = []string{"Balance calibration log", "Temperature monitoring record", "SOP training record", "Pest control report"}
+)
+
+// seedDemoData fills each entity's registers with plausible demo records,
+// written through the repositories so they get version history like real ones
+func (a *App) seedDemoData(args []string) error {
+	fs := a.flags("seed-demo-data", "seed-demo-data [-per-entity n] [-force]")
+	perEntity := fs.Int("per-entity", 5, "records of each type to create per entity")
+	force := fs.Bool("force", false, "allow seeding when env is production")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *perEntity < 1 {
+		return errors.New("-per-entity must be at least 1")
+	}
+	if a.Config.Env == config.EnvProduction && !*force {
+		return errors.New("refusing to seed demo data into a production database (use -force)")
+	}
+
+	ctx := context.Background()
+	base := time.Now().AddDate(-1, 0, 0)
+	created := 0
+	for e, entity := range seedEntities {
+		for i := 0; i < *perEntity; i++ {
+			n := e**perEntity + i
+			received := db.NewDate(base.AddDate(0, 0, n*7))
+			expiry := db.NewDate(base.AddDate(2, 0, n*7))
+			pages := 4 + n%20
+
+			ti := &db.TestItem{
+				TestItemName:  fmt.Sprintf("%s (demo)", demoCompounds[n%len(demoCompounds)]),
+				TestItemCode:  fmt.Sprintf("DEMO-TI-%04d", n+1),
+				CompanyName:   demoSponsors[n%len(demoSponsors)],
+				DateOfReceipt: &received,
+				BatchNo:       fmt.Sprintf("B%05d", 1000+n),
+				Storage:       "2-8 °C",
+				ExpiryDate:    &expiry,
+				Quantity:      fmt.Sprintf("%d g", 10+n),
+				Entity:        entity,
+				Version:       1,
+			}
+			if err := a.Repos.TestItems.Create(ctx, ti, a.Actor); err != nil {
+				return fmt.Errorf("create demo test item: %w", err)
+			}
+
+			st := &db.Study{
+				StudyNumber:   fmt.Sprintf("DEMO-%s-%04d", entity, i+1),
+				StudyCode:     fmt.Sprintf("SC-%04d", n+1),
+				TestItemCode:  ti.TestItemCode,
+				SdOrPiName:    demoDirectors[n%len(demoDirectors)],
+				DateOfReceipt: &received,
+				RawDataCount:  n % 7,
+				Entity:        entity,
+				Version:       1,
+			}
+			if err := a.Repos.Studies.Create(ctx, st, a.Actor); err != nil {
+				return fmt.Errorf("create demo study: %w", err)
+			}
+
+			fd := &db.FacilityDoc{
+				DeptSection:    demoDepts[n%len(demoDepts)],
+				Date:           &received,
+				Particulars:    fmt.Sprintf("%s (demo)", demoDocs[n%len(demoDocs)]),
+				TotalNoOfPages: &pages,
+				SubmittedBy:    demoDirectors[(n+1)%len(demoDirectors)],
+				Entity:         entity,
+				Version:        1,
+			}
+			if err := a.Repos.FacilityDocs.Create(ctx, fd, a.Actor); err != nil {
+				return fmt.Errorf("create demo facility doc: %w", err)
+			}
+			created += 3
+		}
+	}
+
+	fmt.Fprintf(a.Out, "created %d demo records across %d entities\n", created, len(seedEntities))
+	return nil
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+)
+
+var sponsorPlanHeaders = []string{"cluster", "company_name", "test_items", "sponsor"}
+
+// legalForms are company suffixes ignored when clustering names
+var legalForms = map[string]bool{
+	"ltd": true, "limited": true, "inc": true, "incorporated": true, "llc": true, "llp": true,
+	"plc": true, "pvt": true, "private": true, "co": true, "company": true, "corp": true,
+	"corporation": true, "gmbh": true, "ag": true, "sa": true, "bv": true, "srl": true,
+}
+
+var nonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// companyCluster reduces a company name to the key that spelling variants
+// share: lower case, no punctuation and no trailing legal form, so "ABC Ltd",
+// "ABC Limited" and "abc" all become "abc"
+func companyCluster(name string) string {
+	words := strings.Fields(nonAlnum.ReplaceAllString(strings.ToLower(name), " "))
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	for len(words) > 1 && legalForms[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// clusterSponsors maps the free-text company names of test items onto
+// sponsor records in two steps, so an admin confirms the result: without
+// -apply it writes a CSV plan proposing a sponsor for every name, clustering
+// spelling variants; with -apply it reads the (edited) plan, creates the
+// sponsors that do not exist yet and assigns the test items and their
+// studies to them.
+func (a *App) clusterSponsors(args []string) error {
+	fs := a.flags("cluster-sponsors", "cluster-sponsors [-o plan.csv] | -apply plan.csv")
+	output := fs.String("o", "", "write the plan to this file (default standard output)")
+	apply := fs.String("apply", "", "apply a reviewed plan; rows with an empty sponsor are skipped")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *apply != "" {
+		return a.applySponsorPlan(*apply)
+	}
+
+	ctx := context.Background()
+	names, err := a.Repos.Sponsors.CompanyNames(ctx)
+	if err != nil {
+		return err
+	}
+	sponsors, err := a.Repos.Sponsors.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	clusters := map[string][]string{}
+	for name := range names {
+		key := companyCluster(name)
+		clusters[key] = append(clusters[key], name)
+	}
+	// existing sponsors name their cluster; otherwise the spelling used most
+	existing := map[string]string{}
+	for _, s := range sponsors {
+		existing[companyCluster(s.Name)] = s.Name
+	}
+	keys := make([]string, 0, len(clusters))
+	for key, members := range clusters {
+		sort.Slice(members, func(i, j int) bool {
+			if names[members[i]] != names[members[j]] {
+				return names[members[i]] > names[members[j]]
+			}
+			if len(members[i]) != len(members[j]) {
+				return len(members[i]) > len(members[j])
+			}
+			return members[i] < members[j]
+		})
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out io.Writer = a.Out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := csv.NewWriter(out)
+	if err := w.Write(sponsorPlanHeaders); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		sponsor, ok := existing[key]
+		if !ok {
+			sponsor = clusters[key][0]
+		}
+		for _, name := range clusters[key] {
+			if err := w.Write([]string{key, name, strconv.Itoa(names[name]), sponsor}); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(a.Out, "proposed %d sponsors for %d company names; review %s, then run cluster-sponsors -apply %s\n",
+			len(keys), len(names), *output, *output)
+	}
+	return nil
+}
+
+// applySponsorPlan assigns test items to the sponsors a reviewed plan names
+func (a *App) applySponsorPlan(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return fmt.Errorf("read plan: %w", err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(sponsorPlanHeaders, ",") {
+		return fmt.Errorf("plan must start with the header %s", strings.Join(sponsorPlanHeaders, ","))
+	}
+
+	// company names per sponsor, in plan order
+	var order []string
+	spelling := map[string]string{}
+	companies := map[string][]string{}
+	for _, row := range rows[1:] {
+		name := strings.TrimSpace(row[1])
+		sponsor := strings.Join(strings.Fields(row[3]), " ")
+		if name == "" || sponsor == "" {
+			continue
+		}
+		key := strings.ToLower(sponsor)
+		if _, ok := spelling[key]; !ok {
+			spelling[key] = sponsor
+			order = append(order, key)
+		}
+		companies[key] = append(companies[key], name)
+	}
+
+	ctx := context.Background()
+	for _, key := range order {
+		sponsor, err := a.Repos.Sponsors.FindByName(ctx, spelling[key])
+		created := false
+		if errors.Is(err, repository.ErrNotFound) {
+			sponsor = &db.Sponsor{Name: spelling[key]}
+			err = a.Repos.Sponsors.Create(ctx, sponsor, a.Actor)
+			created = true
+		}
+		if err != nil {
+			return fmt.Errorf("sponsor %s: %w", spelling[key], err)
+		}
+		items, studies, err := a.Repos.Sponsors.Link(ctx, sponsor.ID, companies[key], a.Actor)
+		if err != nil {
+			return fmt.Errorf("sponsor %s: %w", sponsor.Name, err)
+		}
+		note := ""
+		if created {
+			note = " (created)"
+		}
+		fmt.Fprintf(a.Out, "%s%s: %d test items, %d studies\n", sponsor.Name, note, items, studies)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+)
+
+// choosePassword validates password against the configured policy, or
+// generates one when it is empty. generated reports whether the caller must
+// show it to the operator.
+func (a *App) choosePassword(password string) (hash, plain string, generated bool, err error) {
+	if password == "" {
+		if password, err = utils.GeneratePassword(); err != nil {
+			return "", "", false, err
+		}
+		generated = true
+	} else if err := a.Config.PasswordPolicy().Check(password); err != nil {
+		return "", "", false, err
+	}
+	hash, err = utils.HashPassword(password)
+	return hash, password, generated, err
+}
+
+func (a *App) createAdmin(args []string) error {
+	fs := a.flags("create-admin", "create-admin -email <email> [-password <password>]")
+	email := fs.String("email", "", "email address of the new administrator (required)")
+	password := fs.String("password", "", "password; a random one is generated and printed if omitted")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+	normalized := strings.ToLower(strings.TrimSpace(*email))
+
+	ctx := context.Background()
+	if _, err := a.Repos.Users.FindByEmail(ctx, normalized); err == nil {
+		return fmt.Errorf("a user with email %s already exists", normalized)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	hash, plain, generated, err := a.choosePassword(*password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user := &db.User{Email: normalized, Password: hash, Role: "admin", Version: 1, MustChangePassword: generated, PasswordChangedAt: &now}
+	if err := a.Repos.Users.CreateAudited(ctx, user, a.Actor); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "created admin %s (id %d)\n", user.Email, user.ID)
+	if generated {
+		fmt.Fprintf(a.Out, "password: %s\n", plain)
+	}
+	return nil
+}
+
+func (a *App) resetPassword(args []string) error {
+	fs := a.flags("reset-password", "reset-password -email <email> [-password <password>]")
+	email := fs.String("email", "", "email address of the user (required)")
+	password := fs.String("password", "", "new password; a random one is generated and printed if omitted")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	ctx := context.Background()
+	user, err := a.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if !user.HasLocalPassword() {
+		return fmt.Errorf("%s signs in with %s; change the password in the directory", user.Email, user.AuthProvider)
+	}
+	hash, plain, generated, err := a.choosePassword(*password)
+	if err != nil {
+		return err
+	}
+	policy := a.Config.PasswordPolicy()
+	if !generated {
+		recent, err := a.Repos.Users.RecentPasswords(ctx, user.ID, policy.History)
+		if err != nil {
+			return err
+		}
+		if policy.Reused(plain, recent) {
+			return fmt.Errorf("password was used recently; choose one not among the last %d", policy.History)
+		}
+	}
+	// the user has to replace a password someone else chose
+	opts := repository.PasswordUpdate{MustChange: true, Keep: policy.History - 1}
+	if err := a.Repos.Users.SetPassword(ctx, user.ID, hash, opts, a.Actor); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "password reset for %s\n", user.Email)
+	if generated {
+		fmt.Fprintf(a.Out, "password: %s\n", plain)
+	}
+	return nil
+}
+
+func (a *App) disableUser(args []string) error {
+	fs := a.flags("disable-user", "disable-user -email <email> [-enable]")
+	email := fs.String("email", "", "email address of the user (required)")
+	enable := fs.Bool("enable", false, "re-enable a disabled account instead")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	ctx := context.Background()
+	user, err := a.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.Users.SetDisabled(ctx, user.ID, !*enable, a.Actor); err != nil {
+		return err
+	}
+
+	if *enable {
+		fmt.Fprintf(a.Out, "enabled %s\n", user.Email)
+	} else {
+		fmt.Fprintf(a.Out, "disabled %s\n", user.Email)
+	}
+	return nil
+}
+
+func (a *App) unlockUser(args []string) error {
+	fs := a.flags("unlock-user", "unlock-user -email <email>")
+	email := fs.String("email", "", "email address of the user (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	ctx := context.Background()
+	user, err := a.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.Users.Unlock(ctx, user.ID, a.Actor); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Out, "unlocked %s\n", user.Email)
+	return nil
+}
+
+// resetMFA removes a user's second factor, for admins locked out of the API
+// after losing their authenticator and recovery codes
+func (a *App) resetMFA(args []string) error {
+	fs := a.flags("reset-mfa", "reset-mfa -email <email>")
+	email := fs.String("email", "", "email address of the user (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	ctx := context.Background()
+	user, err := a.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.MFA.Disable(ctx, user.ID, a.Actor); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Out, "removed two-factor authentication for %s\n", user.Email)
+	return nil
+}
+
+// normalizeEmails lower-cases and trims every stored email. Addresses that
+// would then collide with another account are reported and left alone.
+func (a *App) normalizeEmails(args []string) error {
+	fs := a.flags("normalize-emails", "normalize-emails [-dry-run]")
+	dryRun := fs.Bool("dry-run", false, "report the changes without making them")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	users, err := a.Repos.Users.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner := map[string]uint{}
+	for _, u := range users {
+		if normalized := strings.ToLower(strings.TrimSpace(u.Email)); normalized == u.Email {
+			owner[normalized] = u.ID
+		}
+	}
+
+	updated, conflicts := 0, 0
+	for _, u := range users {
+		normalized := strings.ToLower(strings.TrimSpace(u.Email))
+		if normalized == u.Email {
+			continue
+		}
+		if id, taken := owner[normalized]; taken && id != u.ID {
+			fmt.Fprintf(a.Err, "⚠️  %s (user %d) conflicts with user %d; skipped\n", u.Email, u.ID, id)
+			conflicts++
+			continue
+		}
+		if !*dryRun {
+			if err := a.Repos.Users.SetEmail(ctx, u.ID, normalized, a.Actor); err != nil {
+				return fmt.Errorf("update user %d: %w", u.ID, err)
+			}
+		}
+		owner[normalized] = u.ID
+		fmt.Fprintf(a.Out, "user %d: %s -> %s\n", u.ID, u.Email, normalized)
+		updated++
+	}
+
+	verb := "normalized"
+	if *dryRun {
+		verb = "would normalize"
+	}
+	fmt.Fprintf(a.Out, "%s %d of %d emails\n", verb, updated, len(users))
+	if conflicts > 0 {
+		return fmt.Errorf("%d emails conflict with existing accounts and must be merged by hand", conflicts)
+	}
+	return nil
+}
+
+// findUser looks a user up by email with a readable not-found error
+func (a *App) findUser(ctx context.Context, email string) (*db.User, error) {
+	user, err := a.Repos.Users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("no user with email %s", email)
+	}
+	return user, err
+}
@@ -0,0 +1,102 @@
+// Package auth checks sign-in credentials. Providers are tried in order and
+// the first one that knows the user decides: the local provider checks the
+// bcrypt hashes stored here, the LDAP provider binds against a directory.
+// Single sign-on with OpenID Connect is the separate redirect flow in OIDC.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/utils"
+)
+
+var (
+	// ErrUnknownUser means the provider has no such user; the next one is asked
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials means the provider knows the user but the password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNotPermitted means the credentials are right but the provider does
+	// not allow the user into this application
+	ErrNotPermitted = errors.New("account is not permitted to sign in")
+)
+
+// Identity is a user whose credentials a provider has accepted. Role and
+// Entities are set by providers that manage them; empty values leave the
+// local account's as they are.
+type Identity struct {
+	Provider string
+	Email    string
+	Role     string
+	Entities []string
+}
+
+// Provider verifies an email address and password
+type Provider interface {
+	// Name is recorded as the user's auth_provider
+	Name() string
+	// Authenticate checks the credentials. user is the local account with
+	// that email, or nil if there is none yet.
+	Authenticate(ctx context.Context, email, password string, user *db.User) (*Identity, error)
+}
+
+// Authenticator is the chain of providers behind sign-in
+type Authenticator struct {
+	Providers []Provider
+	// OIDC is the single sign-on provider, nil unless configured
+	OIDC *OIDC
+}
+
+// New builds the providers listed in cfg.AuthProviders
+func New(cfg *config.Config) (*Authenticator, error) {
+	a := &Authenticator{}
+	for _, name := range cfg.AuthProviders {
+		switch name {
+		case db.ProviderLocal:
+			a.Providers = append(a.Providers, Local{})
+		case db.ProviderLDAP:
+			a.Providers = append(a.Providers, NewLDAP(cfg.LDAP))
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", name)
+		}
+	}
+	if cfg.OIDC.Issuer != "" {
+		a.OIDC = NewOIDC(cfg.OIDC)
+	}
+	return a, nil
+}
+
+// Authenticate asks each provider in turn. ErrUnknownUser is returned only
+// if none of them knows the user.
+func (a *Authenticator) Authenticate(ctx context.Context, email, password string, user *db.User) (*Identity, error) {
+	for _, p := range a.Providers {
+		identity, err := p.Authenticate(ctx, email, password, user)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		identity.Provider = p.Name()
+		return identity, nil
+	}
+	return nil, ErrUnknownUser
+}
+
+// Local checks the bcrypt password hashes of local accounts
+type Local struct{}
+
+func (Local) Name() string { return db.ProviderLocal }
+
+func (Local) Authenticate(_ context.Context, _, password string, user *db.User) (*Identity, error) {
+	if user == nil || !user.HasLocalPassword() {
+		return nil, ErrUnknownUser
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Email: user.Email}, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import "strings"
+
+// groupMapping turns the groups a provider reports into a role and entity
+// memberships, as configured by its admin and entity:group lists
+type groupMapping struct {
+	admin    map[string]bool
+	entities map[string][]string
+}
+
+func newGroupMapping(adminGroups, entityGroups []string) groupMapping {
+	m := groupMapping{admin: map[string]bool{}, entities: map[string][]string{}}
+	for _, g := range adminGroups {
+		m.admin[strings.ToLower(g)] = true
+	}
+	for _, pair := range entityGroups {
+		entity, group, _ := strings.Cut(pair, ":")
+		key := strings.ToLower(group)
+		m.entities[key] = append(m.entities[key], entity)
+	}
+	return m
+}
+
+// resolve maps groups, each matched by the lower-case names keys returns for
+// it. The role is only set if admin groups are configured and entities only
+// if entity groups are; ok is false if mappings are configured and none of
+// them matched.
+func (m groupMapping) resolve(groups []string, keys func(string) []string) (role string, entities []string, ok bool) {
+	configured := len(m.admin) > 0 || len(m.entities) > 0
+	matched := false
+	seen := map[string]bool{}
+	for _, g := range groups {
+		for _, key := range keys(g) {
+			if m.admin[key] {
+				role, matched = "admin", true
+			}
+			for _, e := range m.entities[key] {
+				matched = true
+				if !seen[e] {
+					seen[e] = true
+					entities = append(entities, e)
+				}
+			}
+		}
+	}
+
+	if len(m.admin) > 0 && role == "" {
+		role = "user"
+	}
+	if len(m.entities) > 0 && entities == nil {
+		entities = []string{}
+	}
+	return role, entities, matched || !configured
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout bounds connecting to the directory and each request
+const ldapTimeout = 10 * time.Second
+
+// LDAP authenticates against an LDAP or Active Directory server: it finds
+// the user's entry as the search account, then binds as the user
+type LDAP struct {
+	cfg    config.LDAPConfig
+	groups groupMapping
+}
+
+// NewLDAP returns a provider for cfg, which config.Validate has checked
+func NewLDAP(cfg config.LDAPConfig) *LDAP {
+	return &LDAP{cfg: cfg, groups: newGroupMapping(cfg.AdminGroups, cfg.EntityGroups)}
+}
+
+func (p *LDAP) Name() string { return db.ProviderLDAP }
+
+func (p *LDAP) Authenticate(ctx context.Context, email, password string, user *db.User) (*Identity, error) {
+	if user != nil && user.AuthProvider != db.ProviderLDAP {
+		return nil, ErrUnknownUser
+	}
+	// an empty password would be an unauthenticated bind, which servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap bind as search account: %w", err)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(email)),
+		[]string{"mail", p.cfg.GroupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		if user != nil {
+			// the account was removed from the directory
+			return nil, ErrInvalidCredentials
+		}
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		return nil, fmt.Errorf("ldap search: %d entries match %s", len(res.Entries), email)
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind as user: %w", err)
+	}
+
+	identity := &Identity{Email: email}
+	if mail := entry.GetAttributeValue("mail"); mail != "" {
+		identity.Email = mail
+	}
+	var ok bool
+	identity.Role, identity.Entities, ok = p.mapGroups(entry.GetAttributeValues(p.cfg.GroupAttribute))
+	if !ok {
+		return nil, ErrNotPermitted
+	}
+	return identity, nil
+}
+
+func (p *LDAP) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	host, err := ldapHost(p.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapHost returns the host of an LDAP URL, with or without a port, that
+// the server certificate is checked against
+func ldapHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("ldap url: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("ldap url %q has no host", rawURL)
+	}
+	return u.Hostname(), nil
+}
+
+// mapGroups turns group DNs into a role and entities. Groups match by DN or
+// by their CN. Once any group mapping is configured a user must match one of
+// them to get in (ok false otherwise).
+func (p *LDAP) mapGroups(groups []string) (role string, entities []string, ok bool) {
+	return p.groups.resolve(groups, groupKeys)
+}
+
+// groupKeys are the lower-case names a group DN is matched by: the DN and its CN
+func groupKeys(dn string) []string {
+	keys := []string{strings.ToLower(dn)}
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return keys
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			keys = append(keys, strings.ToLower(attr.Value))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+)
+
+func testLDAPConfig(url string) config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:            url,
+		BindDN:         "cn=admin,dc=example,dc=org",
+		BindPassword:   "admin",
+		BaseDN:         "dc=example,dc=org",
+		UserFilter:     "(&(objectClass=inetOrgPerson)(mail=%s))",
+		GroupAttribute: "memberOf",
+		AdminGroups:    []string{"archive-admins"},
+		EntityGroups:   []string{"agro:lab-agro", "biopharma:lab-biopharma"},
+	}
+}
+
+func TestMapGroups(t *testing.T) {
+	p := NewLDAP(testLDAPConfig(""))
+	for _, tc := range []struct {
+		groups   []string
+		role     string
+		entities []string
+		ok       bool
+	}{
+		{[]string{"cn=lab-agro,ou=groups,dc=example,dc=org"}, "user", []string{"agro"}, true},
+		{[]string{"CN=Archive-Admins,OU=Groups,DC=example,DC=org", "cn=lab-agro,ou=groups,dc=example,dc=org"}, "admin", []string{"agro"}, true},
+		{[]string{"cn=archive-admins,ou=groups,dc=example,dc=org"}, "admin", []string{}, true},
+		{[]string{"cn=canteen,ou=groups,dc=example,dc=org"}, "user", []string{}, false},
+		{nil, "user", []string{}, false},
+	} {
+		role, entities, ok := p.mapGroups(tc.groups)
+		if role != tc.role || !reflect.DeepEqual(entities, tc.entities) || ok != tc.ok {
+			t.Errorf("mapGroups(%v) = %q, %v, %v; want %q, %v, %v", tc.groups, role, entities, ok, tc.role, tc.entities, tc.ok)
+		}
+	}
+
+	// without any mapping everyone in the directory may sign in and nothing is managed
+	role, entities, ok := NewLDAP(config.LDAPConfig{}).mapGroups([]string{"cn=x,dc=example,dc=org"})
+	if role != "" || entities != nil || !ok {
+		t.Errorf("unmapped: %q, %v, %v", role, entities, ok)
+	}
+}
+
+func TestLDAPHost(t *testing.T) {
+	for url, want := range map[string]string{
+		"ldap://dc.example.com":       "dc.example.com",
+		"ldap://dc.example.com:389":   "dc.example.com",
+		"ldaps://DC.example.com:636/": "DC.example.com",
+		"ldap://[::1]:389":            "::1",
+		"ldap://":                     "",
+	} {
+		host, err := ldapHost(url)
+		if host != want || (err != nil) != (want == "") {
+			t.Errorf("ldapHost(%q) = %q, %v; want %q", url, host, err, want)
+		}
+	}
+}
+
+// TestLDAPAgainstOpenLDAP needs a directory loaded with testdata/seed.ldif:
+//
+//	docker run --rm -p 3389:389 -e LDAP_DOMAIN=example.org -e LDAP_ADMIN_PASSWORD=admin \
+//	  -v "$PWD/auth/testdata:/container/service/slapd/assets/config/bootstrap/ldif/custom" \
+//	  osixia/openldap:1.5.0 --copy-service
+//	LDAP_TEST_URL=ldap://localhost:3389 go test ./auth
+func TestLDAPAgainstOpenLDAP(t *testing.T) {
+	url := os.Getenv("LDAP_TEST_URL")
+	if url == "" {
+		t.Skip("LDAP_TEST_URL not set")
+	}
+	p := NewLDAP(testLDAPConfig(url))
+	ctx := context.Background()
+
+	alice, err := p.Authenticate(ctx, "alice@example.org", "alice-password", nil)
+	if err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if alice.Role != "user" || !reflect.DeepEqual(alice.Entities, []string{"agro", "biopharma"}) {
+		t.Errorf("alice: %+v", alice)
+	}
+	bob, err := p.Authenticate(ctx, "BOB@example.org", "bob-password", nil)
+	if err != nil || bob.Role != "admin" || bob.Email != "bob@example.org" {
+		t.Errorf("bob: %+v, %v", bob, err)
+	}
+
+	for _, tc := range []struct {
+		email, password string
+		user            *db.User
+		want            error
+	}{
+		{"alice@example.org", "wrong", nil, ErrInvalidCredentials},
+		{"alice@example.org", "", nil, ErrInvalidCredentials},
+		{"nobody@example.org", "x", nil, ErrUnknownUser},
+		{"nobody@example.org", "x", &db.User{AuthProvider: db.ProviderLDAP}, ErrInvalidCredentials},
+		{"alice@example.org", "alice-password", &db.User{AuthProvider: db.ProviderLocal}, ErrUnknownUser},
+		{"carol@example.org", "carol-password", nil, ErrNotPermitted},
+		{"*)(mail=*", "x", nil, ErrUnknownUser},
+	} {
+		if _, err := p.Authenticate(ctx, tc.email, tc.password, tc.user); !errors.Is(err, tc.want) {
+			t.Errorf("%s / %q: %v, want %v", tc.email, tc.password, err, tc.want)
+		}
+	}
+}
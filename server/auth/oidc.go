@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcTimeout bounds each request to the OpenID Connect provider
+const oidcTimeout = 10 * time.Second
+
+// OIDC signs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE. Unlike the password providers it is
+// not part of the Authenticate chain: the user authenticates at the
+// provider, and the code it returns is exchanged here. The provider's
+// metadata is discovered on first use, so the server starts while it is down.
+type OIDC struct {
+	cfg    config.OIDCConfig
+	groups groupMapping
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDC returns a provider for cfg, which config.Validate has checked
+func NewOIDC(cfg config.OIDCConfig) *OIDC {
+	return &OIDC{
+		cfg:    cfg,
+		groups: newGroupMapping(cfg.AdminGroups, cfg.EntityGroups),
+		client: &http.Client{Timeout: oidcTimeout},
+	}
+}
+
+func (o *OIDC) Name() string { return db.ProviderOIDC }
+
+// AuthCodeURL returns the provider's authorization URL for one sign-in
+// attempt. verifier is the PKCE code verifier, sent only as its S256 challenge.
+func (o *OIDC) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	conf, _, err := o.oauth2(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code, verifies the ID token against
+// nonce and maps its claims to an identity. A code the provider rejects or
+// a token that fails verification is ErrInvalidCredentials; an unverified
+// email address or unmapped groups are ErrNotPermitted.
+func (o *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	conf, provider, err := o.oauth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = oidc.ClientContext(ctx, o.client)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	var rejected *oauth2.RetrieveError
+	if errors.As(err, &rejected) && rejected.ErrorCode == "invalid_grant" {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: o.cfg.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidCredentials)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc claims: %w", err)
+	}
+	return o.identity(claims)
+}
+
+// identity maps ID token claims onto the local account
+func (o *OIDC) identity(claims map[string]interface{}) (*Identity, error) {
+	email, _ := claims["email"].(string)
+	// accounts are matched by email, so it must be one the provider checked
+	verified := claims["email_verified"] == true || claims["email_verified"] == "true"
+	if email == "" || !verified {
+		return nil, fmt.Errorf("%w: no verified email address", ErrNotPermitted)
+	}
+
+	identity := &Identity{Email: email}
+	var ok bool
+	identity.Role, identity.Entities, ok = o.groups.resolve(claimStrings(claims, o.cfg.GroupsClaim), func(g string) []string {
+		return []string{strings.ToLower(g)}
+	})
+	if !ok {
+		return nil, ErrNotPermitted
+	}
+	return identity, nil
+}
+
+// oauth2 returns the client configuration, discovering the provider first
+// if needed. A failed discovery is retried on the next call.
+func (o *OIDC) oauth2(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider == nil {
+		provider, err := oidc.NewProvider(oidc.ClientContext(ctx, o.client), o.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		o.provider = provider
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, s := range o.cfg.Scopes {
+		if s != oidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		RedirectURL:  o.cfg.RedirectURL,
+		Endpoint:     o.provider.Endpoint(),
+		Scopes:       scopes,
+	}, o.provider, nil
+}
+
+// claimStrings returns the strings in the claim at the dotted path, which
+// may hold a list or a single string
+func claimStrings(claims map[string]interface{}, path string) []string {
+	if path == "" {
+		return nil
+	}
+	var v interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
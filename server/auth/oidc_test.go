@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"eurofines-server/config"
+)
+
+func TestOIDCIdentity(t *testing.T) {
+	p := NewOIDC(config.OIDCConfig{
+		GroupsClaim:  "realm_access.roles",
+		AdminGroups:  []string{"Archive-Admins"},
+		EntityGroups: []string{"agro:lab-agro"},
+	})
+	roles := func(r ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"roles": r}
+	}
+
+	identity, err := p.identity(map[string]interface{}{
+		"email": "ann@example.com", "email_verified": "true", "realm_access": roles("archive-admins", "lab-agro", 7),
+	})
+	if err != nil || identity.Email != "ann@example.com" || identity.Role != "admin" || !reflect.DeepEqual(identity.Entities, []string{"agro"}) {
+		t.Errorf("identity = %+v, %v", identity, err)
+	}
+
+	for _, claims := range []map[string]interface{}{
+		{"email": "ann@example.com", "email_verified": false, "realm_access": roles("lab-agro")},
+		{"email_verified": true, "realm_access": roles("lab-agro")},
+		{"email": "ann@example.com", "email_verified": true, "realm_access": roles("canteen")},
+		{"email": "ann@example.com", "email_verified": true, "groups": []interface{}{"lab-agro"}},
+	} {
+		if _, err := p.identity(claims); !errors.Is(err, ErrNotPermitted) {
+			t.Errorf("identity(%v): %v, want ErrNotPermitted", claims, err)
+		}
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	claims := map[string]interface{}{
+		"groups": "single",
+		"nested": map[string]interface{}{"list": []interface{}{"a", "b"}},
+	}
+	for path, want := range map[string][]string{
+		"groups":      {"single"},
+		"nested.list": {"a", "b"},
+		"nested.none": nil,
+		"groups.x":    nil,
+		"":            nil,
+	} {
+		if got := claimStrings(claims, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("claimStrings(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
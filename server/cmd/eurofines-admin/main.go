@@ -0,0 +1,19 @@
+// Command eurofines-admin runs user, seed and maintenance operations against
+// the server's database, using the server's configuration.
+package main
+
+import (
+	"os"
+
+	"eurofines-server/admin"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Same .env lookup as the server, so both see the same settings
+	if err := godotenv.Load(".env"); err != nil {
+		_ = godotenv.Load()
+	}
+	os.Exit(admin.Main(os.Args[1:]))
+}
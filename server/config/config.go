@@ -1,11 +1,54 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"eurofines-server/utils"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Environments accepted in Config.Env
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvProduction  = "production"
 )
 
+// Database drivers accepted in Config.DBDriver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Signup modes accepted in Config.SignupMode
+const (
+	// SignupDisabled turns self-service signup off; accounts are created by admins
+	SignupDisabled = "disabled"
+	// SignupInvite requires a valid invitation token
+	SignupInvite = "invite"
+	// SignupApproval lets anyone request a user account that an admin must approve
+	SignupApproval = "approval"
+)
+
+// DefaultJWTSecret is the placeholder secret; it is only accepted in development and test
+const DefaultJWTSecret = "your_super_secret_jwt_key_change_this_in_production_min_32_chars"
+
+// Config is the server configuration. It is loaded once at startup by Load
+// and passed to the packages that need it.
 type Config struct {
+	Env string
+	// DBDriver selects the backend: PostgreSQL, or a single SQLite file at DBPath
+	DBDriver   string
+	DBPath     string
 	DBHost     string
 	DBPort     string
 	DBName     string
@@ -14,24 +57,564 @@ type Config struct {
 	DBSSLMode  string
 	Port       string
 	JWTSecret  string
+	// JWTExpiry is the lifetime of issued access tokens
+	JWTExpiry time.Duration
+	// RefreshExpiry is how long a session lasts without signing in again
+	RefreshExpiry time.Duration
+	// RetentionYears is how long archive records must be kept before they may be purged
+	RetentionYears int
+	// AccessPurposeRequired refuses reads of archive records that do not
+	// state a purpose for the access log
+	AccessPurposeRequired bool
+	CORSOrigins           []string
+	// SignupMode controls self-service signup: disabled, invite or approval
+	SignupMode string
+	// InviteExpiry is how long an invitation token can be used
+	InviteExpiry time.Duration
+	// APIKeyMaxAge is the longest an API key may stay valid, and the expiry
+	// of keys created without one
+	APIKeyMaxAge time.Duration
+	// LockoutThreshold failed sign-ins in a row lock an account for LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// LoginIPLimit failed sign-ins from one IP address within LoginIPWindow
+	// block further attempts from it until the window has passed
+	LoginIPLimit  int
+	LoginIPWindow time.Duration
+	// Password rules; see utils.PasswordPolicy
+	PasswordMinLength  int
+	PasswordMinClasses int
+	PasswordMaxAge     time.Duration
+	PasswordHistory    int
+	// ResetTokenExpiry is how long an emailed password reset link works
+	ResetTokenExpiry time.Duration
+	// AppURL is the web client's base URL, used for links in emails
+	AppURL string
+	// SMTP server for outgoing mail; without SMTPHost mail is only logged,
+	// and refused in production
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	// MFARequiredEntities lists entities where users who may manage users
+	// or dispose of records must use a second factor; "*" lists them all
+	MFARequiredEntities []string
+	// MFAChallengeExpiry is how long after the password the second factor may be given
+	MFAChallengeExpiry time.Duration
+	// MFAIssuer names the account in authenticator apps
+	MFAIssuer string
+	// AuthProviders are tried in order at sign-in: local (bcrypt passwords
+	// stored here) and ldap (bind against a directory)
+	AuthProviders []string
+	LDAP          LDAPConfig
+	// OIDC enables single sign-on with an OpenID Connect provider, next to
+	// the password providers, when its issuer is set
+	OIDC OIDCConfig
+}
+
+// LDAPConfig configures sign-in against an LDAP or Active Directory server.
+// Users are found with a search as BindDN, then authenticated by binding as
+// themselves. Directory groups decide role and entity memberships.
+type LDAPConfig struct {
+	// URL is ldap://host:389 or ldaps://host:636
+	URL string
+	// StartTLS upgrades an ldap:// connection before any credentials are sent
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry for an email address, substituted for %s
+	UserFilter string
+	// GroupAttribute on the user entry lists the groups it belongs to
+	GroupAttribute string
+	// AdminGroups make their members admins; if empty, roles are managed here
+	AdminGroups []string
+	// EntityGroups map groups to entities as entity:group; if empty,
+	// memberships are managed here
+	EntityGroups []string
+}
+
+// OIDCConfig configures single sign-on with the authorization code flow and
+// PKCE. The provider's endpoints are discovered from Issuer; the ID token's
+// groups claim decides role and entity memberships.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, e.g. https://login.example.com/realms/lab
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the registered callback: the frontend page that posts
+	// the code and state back to /api/auth/oidc/callback
+	RedirectURL string
+	// Scopes requested besides openid
+	Scopes []string
+	// GroupsClaim names the ID token claim listing the user's groups or
+	// roles; dots reach into nested objects (realm_access.roles)
+	GroupsClaim string
+	// AdminGroups make their members admins; if empty, roles are managed here
+	AdminGroups []string
+	// EntityGroups map groups to entities as entity:group; if empty,
+	// memberships are managed here
+	EntityGroups []string
+}
+
+// setting describes one configuration key. The same key is used in the
+// config file; the env var and flag names are derived from it.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	apply func(c *Config, v string) error
+}
+
+func str(dst func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*dst(c) = v
+		return nil
+	}
+}
+
+func duration(dst func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*dst(c) = d
+		return nil
+	}
+}
+
+func integer(dst func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*dst(c) = n
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"env", "APP_ENV", "environment: development, test or production", str(func(c *Config) *string { return &c.Env })},
+	{"port", "PORT", "HTTP listen port", str(func(c *Config) *string { return &c.Port })},
+	{"db_driver", "DB_DRIVER", "database backend: postgres or sqlite", str(func(c *Config) *string { return &c.DBDriver })},
+	{"db_path", "DB_PATH", "SQLite database file (db_driver=sqlite)", str(func(c *Config) *string { return &c.DBPath })},
+	{"db_host", "DB_HOST", "PostgreSQL host", str(func(c *Config) *string { return &c.DBHost })},
+	{"db_port", "DB_PORT", "PostgreSQL port", str(func(c *Config) *string { return &c.DBPort })},
+	{"db_name", "DB_NAME", "PostgreSQL database name", str(func(c *Config) *string { return &c.DBName })},
+	{"db_user", "DB_USER", "PostgreSQL user", str(func(c *Config) *string { return &c.DBUser })},
+	{"db_password", "DB_PASSWORD", "PostgreSQL password", str(func(c *Config) *string { return &c.DBPassword })},
+	{"db_sslmode", "DB_SSLMODE", "PostgreSQL sslmode", str(func(c *Config) *string { return &c.DBSSLMode })},
+	{"jwt_secret", "JWT_SECRET", "HMAC secret for signing tokens", str(func(c *Config) *string { return &c.JWTSecret })},
+	{"jwt_expiry", "JWT_EXPIRY", "access token lifetime, e.g. 15m", duration(func(c *Config) *time.Duration { return &c.JWTExpiry })},
+	{"refresh_expiry", "REFRESH_EXPIRY", "session lifetime for refresh tokens, e.g. 720h", duration(func(c *Config) *time.Duration { return &c.RefreshExpiry })},
+	{"retention_years", "RETENTION_YEARS", "years archive records are retained before purge", integer(func(c *Config) *int { return &c.RetentionYears })},
+	{"access_purpose_required", "ACCESS_PURPOSE_REQUIRED", "refuse archive record reads without a stated purpose (true or false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.AccessPurposeRequired = b
+		return nil
+	}},
+	{"cors_origins", "CORS_ORIGINS", "comma separated list of allowed browser origins", func(c *Config, v string) error {
+		c.CORSOrigins = splitList(v)
+		return nil
+	}},
+	{"signup_mode", "SIGNUP_MODE", "self-service signup: disabled, invite or approval", str(func(c *Config) *string { return &c.SignupMode })},
+	{"invite_expiry", "INVITE_EXPIRY", "lifetime of invitation tokens, e.g. 168h", duration(func(c *Config) *time.Duration { return &c.InviteExpiry })},
+	{"api_key_max_age", "API_KEY_MAX_AGE", "longest lifetime of an API key, e.g. 8760h", duration(func(c *Config) *time.Duration { return &c.APIKeyMaxAge })},
+	{"lockout_threshold", "LOCKOUT_THRESHOLD", "failed sign-ins in a row that lock an account", integer(func(c *Config) *int { return &c.LockoutThreshold })},
+	{"lockout_duration", "LOCKOUT_DURATION", "how long a locked account stays locked, e.g. 15m", duration(func(c *Config) *time.Duration { return &c.LockoutDuration })},
+	{"login_ip_limit", "LOGIN_IP_LIMIT", "failed sign-ins allowed from one IP address per login_ip_window", integer(func(c *Config) *int { return &c.LoginIPLimit })},
+	{"login_ip_window", "LOGIN_IP_WINDOW", "window for login_ip_limit, e.g. 15m", duration(func(c *Config) *time.Duration { return &c.LoginIPWindow })},
+	{"password_min_length", "PASSWORD_MIN_LENGTH", "minimum password length", integer(func(c *Config) *int { return &c.PasswordMinLength })},
+	{"password_min_classes", "PASSWORD_MIN_CLASSES", "character classes (lower, upper, digit, symbol) a password needs, 1-4", integer(func(c *Config) *int { return &c.PasswordMinClasses })},
+	{"password_max_age", "PASSWORD_MAX_AGE", "password lifetime, e.g. 2160h; 0 disables expiry", duration(func(c *Config) *time.Duration { return &c.PasswordMaxAge })},
+	{"password_history", "PASSWORD_HISTORY", "recent passwords that may not be reused, including the current one", integer(func(c *Config) *int { return &c.PasswordHistory })},
+	{"reset_token_expiry", "RESET_TOKEN_EXPIRY", "lifetime of password reset links, e.g. 1h", duration(func(c *Config) *time.Duration { return &c.ResetTokenExpiry })},
+	{"app_url", "APP_URL", "base URL of the web client, for links in emails", str(func(c *Config) *string { return &c.AppURL })},
+	{"smtp_host", "SMTP_HOST", "SMTP server for outgoing mail", str(func(c *Config) *string { return &c.SMTPHost })},
+	{"smtp_port", "SMTP_PORT", "SMTP port", str(func(c *Config) *string { return &c.SMTPPort })},
+	{"smtp_username", "SMTP_USERNAME", "SMTP user, if the server requires authentication", str(func(c *Config) *string { return &c.SMTPUsername })},
+	{"smtp_password", "SMTP_PASSWORD", "SMTP password", str(func(c *Config) *string { return &c.SMTPPassword })},
+	{"mail_from", "MAIL_FROM", "sender address of outgoing mail", str(func(c *Config) *string { return &c.MailFrom })},
+	{"mfa_required_entities", "MFA_REQUIRED_ENTITIES", "comma separated entities whose admins must use two-factor authentication", func(c *Config, v string) error {
+		c.MFARequiredEntities = splitList(v)
+		return nil
+	}},
+	{"mfa_challenge_expiry", "MFA_CHALLENGE_EXPIRY", "time allowed between password and second factor at sign-in", duration(func(c *Config) *time.Duration { return &c.MFAChallengeExpiry })},
+	{"mfa_issuer", "MFA_ISSUER", "issuer name shown in authenticator apps", str(func(c *Config) *string { return &c.MFAIssuer })},
+	{"auth_providers", "AUTH_PROVIDERS", "comma separated sign-in providers, tried in order: local, ldap", func(c *Config, v string) error {
+		c.AuthProviders = splitList(v)
+		return nil
+	}},
+	{"ldap_url", "LDAP_URL", "LDAP server, ldap://host:389 or ldaps://host:636", str(func(c *Config) *string { return &c.LDAP.URL })},
+	{"ldap_start_tls", "LDAP_START_TLS", "upgrade ldap:// connections with StartTLS (true or false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.LDAP.StartTLS = b
+		return nil
+	}},
+	{"ldap_bind_dn", "LDAP_BIND_DN", "DN of the account that searches for users", str(func(c *Config) *string { return &c.LDAP.BindDN })},
+	{"ldap_bind_password", "LDAP_BIND_PASSWORD", "password of the search account", str(func(c *Config) *string { return &c.LDAP.BindPassword })},
+	{"ldap_base_dn", "LDAP_BASE_DN", "subtree searched for users", str(func(c *Config) *string { return &c.LDAP.BaseDN })},
+	{"ldap_user_filter", "LDAP_USER_FILTER", "search filter for a user; %s is the email address", str(func(c *Config) *string { return &c.LDAP.UserFilter })},
+	{"ldap_group_attribute", "LDAP_GROUP_ATTRIBUTE", "user attribute listing group DNs", str(func(c *Config) *string { return &c.LDAP.GroupAttribute })},
+	{"ldap_admin_groups", "LDAP_ADMIN_GROUPS", "comma separated groups (CN or DN) whose members are admins", func(c *Config, v string) error {
+		c.LDAP.AdminGroups = splitList(v)
+		return nil
+	}},
+	{"ldap_entity_groups", "LDAP_ENTITY_GROUPS", "comma separated entity:group pairs, e.g. agro:lab-agro", func(c *Config, v string) error {
+		c.LDAP.EntityGroups = splitList(v)
+		return nil
+	}},
+	{"oidc_issuer", "OIDC_ISSUER", "OpenID Connect issuer URL; enables single sign-on", str(func(c *Config) *string { return &c.OIDC.Issuer })},
+	{"oidc_client_id", "OIDC_CLIENT_ID", "client ID registered with the OpenID Connect provider", str(func(c *Config) *string { return &c.OIDC.ClientID })},
+	{"oidc_client_secret", "OIDC_CLIENT_SECRET", "client secret registered with the OpenID Connect provider", str(func(c *Config) *string { return &c.OIDC.ClientSecret })},
+	{"oidc_redirect_url", "OIDC_REDIRECT_URL", "registered redirect URL (the frontend's callback page)", str(func(c *Config) *string { return &c.OIDC.RedirectURL })},
+	{"oidc_scopes", "OIDC_SCOPES", "comma separated scopes requested besides openid", func(c *Config, v string) error {
+		c.OIDC.Scopes = splitList(v)
+		return nil
+	}},
+	{"oidc_groups_claim", "OIDC_GROUPS_CLAIM", "ID token claim listing groups, dotted for nested claims", str(func(c *Config) *string { return &c.OIDC.GroupsClaim })},
+	{"oidc_admin_groups", "OIDC_ADMIN_GROUPS", "comma separated groups whose members are admins", func(c *Config, v string) error {
+		c.OIDC.AdminGroups = splitList(v)
+		return nil
+	}},
+	{"oidc_entity_groups", "OIDC_ENTITY_GROUPS", "comma separated entity:group pairs, e.g. agro:lab-agro", func(c *Config, v string) error {
+		c.OIDC.EntityGroups = splitList(v)
+		return nil
+	}},
 }
 
-func LoadConfig() *Config {
+// Default returns the built-in configuration before any overrides
+func Default() *Config {
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBName:     getEnv("DB_NAME", "eurofines_db"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", ""),
-		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
-		Port:       getEnv("PORT", "3001"),
-		JWTSecret:  getEnv("JWT_SECRET", "your_super_secret_jwt_key_change_this_in_production_min_32_chars"),
+		Env:            EnvProduction,
+		DBDriver:       DriverPostgres,
+		DBPath:         "eurofines.db",
+		DBHost:         "localhost",
+		DBPort:         "5432",
+		DBName:         "eurofines_db",
+		DBUser:         "postgres",
+		DBSSLMode:      "disable",
+		Port:           "3001",
+		JWTSecret:      DefaultJWTSecret,
+		JWTExpiry:      15 * time.Minute,
+		RefreshExpiry:  30 * 24 * time.Hour,
+		RetentionYears: 10,
+		CORSOrigins:    []string{"http://localhost:3000", "http://localhost:5173"},
+		SignupMode:     SignupInvite,
+		InviteExpiry:   7 * 24 * time.Hour,
+		APIKeyMaxAge:   365 * 24 * time.Hour,
+
+		LockoutThreshold: 5,
+		LockoutDuration:  15 * time.Minute,
+		LoginIPLimit:     20,
+		LoginIPWindow:    15 * time.Minute,
+
+		PasswordMinLength:  12,
+		PasswordMinClasses: 3,
+		PasswordMaxAge:     90 * 24 * time.Hour,
+		PasswordHistory:    5,
+
+		ResetTokenExpiry: time.Hour,
+		AppURL:           "http://localhost:5173",
+		SMTPPort:         "587",
+		MailFrom:         "eurofines@localhost",
+
+		MFAChallengeExpiry: 5 * time.Minute,
+		MFAIssuer:          "Eurofines Archive",
+
+		AuthProviders: []string{"local"},
+		LDAP: LDAPConfig{
+			UserFilter:     "(&(objectClass=person)(mail=%s))",
+			GroupAttribute: "memberOf",
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"email", "profile"},
+			GroupsClaim: "groups",
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: built-in
+// defaults, an optional YAML or TOML file (-config or CONFIG_FILE), the
+// environment, and command line flags. It returns the arguments left after
+// flag parsing (e.g. a subcommand) and validates the result.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("eurofines-server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.key] = fs.String(strings.ReplaceAll(s.key, "_", "-"), "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// DB_PASS was read by older builds; honour it when DB_PASSWORD is unset
+	if os.Getenv("DB_PASSWORD") == "" && os.Getenv("DB_PASS") != "" {
+		cfg.DBPassword = os.Getenv("DB_PASS")
+	}
+	for _, s := range settings {
+		if v := strings.TrimSpace(os.Getenv(s.env)); v != "" {
+			if err := s.apply(cfg, v); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, s := range settings {
+		name := strings.ReplaceAll(s.key, "_", "-")
+		if explicit[name] {
+			if err := s.apply(cfg, *flagValues[s.key]); err != nil {
+				return nil, nil, fmt.Errorf("-%s: %w", name, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile applies a flat YAML or TOML file whose keys match the setting keys
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
 	}
+
+	known := map[string]setting{}
+	for _, s := range settings {
+		known[s.key] = s
+	}
+	for key, raw := range values {
+		s, ok := known[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+		v := fmt.Sprint(raw)
+		if list, ok := raw.([]interface{}); ok {
+			parts := make([]string, len(list))
+			for i, item := range list {
+				parts[i] = fmt.Sprint(item)
+			}
+			v = strings.Join(parts, ",")
+		}
+		if err := s.apply(c, v); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// Validate rejects configurations the server cannot or must not run with
+func (c *Config) Validate() error {
+	var errs []error
+	switch c.Env {
+	case EnvDevelopment, EnvTest, EnvProduction:
+	default:
+		errs = append(errs, fmt.Errorf("env must be development, test or production, got %q", c.Env))
+	}
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("port must be a TCP port number, got %q", c.Port))
+	}
+	switch c.DBDriver {
+	case DriverPostgres:
+		if c.DBHost == "" || c.DBName == "" || c.DBUser == "" {
+			errs = append(errs, errors.New("db_host, db_name and db_user are required"))
+		}
+	case DriverSQLite:
+		if c.DBPath == "" {
+			errs = append(errs, errors.New("db_path is required for sqlite"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("db_driver must be postgres or sqlite, got %q", c.DBDriver))
+	}
+	if c.JWTExpiry <= 0 {
+		errs = append(errs, errors.New("jwt_expiry must be positive"))
+	}
+	if c.RefreshExpiry < c.JWTExpiry {
+		errs = append(errs, errors.New("refresh_expiry must be at least jwt_expiry"))
+	}
+	switch c.SignupMode {
+	case SignupDisabled, SignupInvite, SignupApproval:
+	default:
+		errs = append(errs, fmt.Errorf("signup_mode must be disabled, invite or approval, got %q", c.SignupMode))
+	}
+	if c.InviteExpiry <= 0 {
+		errs = append(errs, errors.New("invite_expiry must be positive"))
+	}
+	if c.APIKeyMaxAge <= 0 {
+		errs = append(errs, errors.New("api_key_max_age must be positive"))
+	}
+	if c.LockoutThreshold < 1 || c.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("lockout_threshold must be at least 1 and lockout_duration positive"))
+	}
+	if c.LoginIPLimit < 1 || c.LoginIPWindow <= 0 {
+		errs = append(errs, errors.New("login_ip_limit must be at least 1 and login_ip_window positive"))
+	}
+	if c.PasswordMinLength < 8 {
+		errs = append(errs, errors.New("password_min_length must be at least 8"))
+	}
+	if c.PasswordMinClasses < 1 || c.PasswordMinClasses > 4 {
+		errs = append(errs, errors.New("password_min_classes must be between 1 and 4"))
+	}
+	if c.PasswordMaxAge < 0 || c.PasswordHistory < 1 {
+		errs = append(errs, errors.New("password_max_age must not be negative and password_history must be at least 1"))
+	}
+	if c.ResetTokenExpiry <= 0 {
+		errs = append(errs, errors.New("reset_token_expiry must be positive"))
+	}
+	if c.SMTPHost != "" && c.MailFrom == "" {
+		errs = append(errs, errors.New("mail_from is required when smtp_host is set"))
+	}
+	if c.MFAChallengeExpiry <= 0 {
+		errs = append(errs, errors.New("mfa_challenge_expiry must be positive"))
+	}
+	if c.MFAIssuer == "" {
+		errs = append(errs, errors.New("mfa_issuer is required"))
+	}
+	errs = append(errs, c.validateAuthProviders()...)
+	errs = append(errs, c.validateOIDC()...)
+	if c.RetentionYears < 1 {
+		errs = append(errs, errors.New("retention_years must be at least 1"))
+	}
+	if !c.IsDevelopment() {
+		if c.JWTSecret == DefaultJWTSecret {
+			errs = append(errs, errors.New("jwt_secret must be changed from the default outside development"))
+		} else if len(c.JWTSecret) < 32 {
+			errs = append(errs, errors.New("jwt_secret must be at least 32 characters outside development"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PasswordPolicy returns the configured rules for user-chosen passwords
+func (c *Config) PasswordPolicy() utils.PasswordPolicy {
+	return utils.PasswordPolicy{
+		MinLength:  c.PasswordMinLength,
+		MinClasses: c.PasswordMinClasses,
+		MaxAge:     c.PasswordMaxAge,
+		History:    c.PasswordHistory,
+	}
+}
+
+func (c *Config) validateAuthProviders() []error {
+	var errs []error
+	if len(c.AuthProviders) == 0 {
+		errs = append(errs, errors.New("auth_providers must name at least one provider"))
+	}
+	seen := map[string]bool{}
+	for _, p := range c.AuthProviders {
+		switch {
+		case p != "local" && p != "ldap":
+			errs = append(errs, fmt.Errorf("auth_providers: unknown provider %q (want local or ldap)", p))
+		case seen[p]:
+			errs = append(errs, fmt.Errorf("auth_providers: %q listed twice", p))
+		}
+		seen[p] = true
+	}
+	if !seen["ldap"] {
+		return errs
+	}
+	if c.LDAP.URL == "" || c.LDAP.BaseDN == "" {
+		errs = append(errs, errors.New("ldap_url and ldap_base_dn are required for the ldap provider"))
+	}
+	if strings.Count(c.LDAP.UserFilter, "%s") != 1 {
+		errs = append(errs, errors.New("ldap_user_filter must contain %s exactly once"))
+	}
+	if c.LDAP.StartTLS && strings.HasPrefix(c.LDAP.URL, "ldaps://") {
+		errs = append(errs, errors.New("ldap_start_tls cannot be used with an ldaps:// URL"))
+	}
+	// passwords are sent in the bind
+	if c.Env == EnvProduction && strings.HasPrefix(c.LDAP.URL, "ldap://") && !c.LDAP.StartTLS {
+		errs = append(errs, errors.New("in production the ldap provider needs ldaps:// or ldap_start_tls"))
+	}
+	for _, pair := range c.LDAP.EntityGroups {
+		if entity, group, ok := strings.Cut(pair, ":"); !ok || entity == "" || group == "" {
+			errs = append(errs, fmt.Errorf("ldap_entity_groups: %q is not entity:group", pair))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateOIDC() []error {
+	if c.OIDC.Issuer == "" {
+		return nil
+	}
+	var errs []error
+	if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+		errs = append(errs, errors.New("oidc_client_id and oidc_redirect_url are required with oidc_issuer"))
+	}
+	if !c.IsDevelopment() && !strings.HasPrefix(c.OIDC.Issuer, "https://") {
+		errs = append(errs, errors.New("oidc_issuer must be https outside development"))
+	}
+	if c.OIDC.GroupsClaim == "" && (len(c.OIDC.AdminGroups) > 0 || len(c.OIDC.EntityGroups) > 0) {
+		errs = append(errs, errors.New("oidc_groups_claim is required to map groups"))
+	}
+	for _, pair := range c.OIDC.EntityGroups {
+		if entity, group, ok := strings.Cut(pair, ":"); !ok || entity == "" || group == "" {
+			errs = append(errs, fmt.Errorf("oidc_entity_groups: %q is not entity:group", pair))
+		}
+	}
+	return errs
+}
+
+// IsDevelopment reports whether development-only relaxations apply
+func (c *Config) IsDevelopment() bool {
+	return c.Env == EnvDevelopment || c.Env == EnvTest
+}
+
+// DSN returns the PostgreSQL connection string
+func (c *Config) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		dsnQuote(c.DBHost), dsnQuote(c.DBUser), dsnQuote(c.DBPassword),
+		dsnQuote(c.DBName), dsnQuote(c.DBPort), dsnQuote(c.DBSSLMode))
+}
+
+// dsnQuote quotes a keyword/value DSN value so passwords may contain spaces or quotes
+func dsnQuote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
 
-func getEnv(key, def string) string {
-	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
-		return v
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
 	}
-	return def
+	return out
 }
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit actions recorded against archive records
+const (
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Audit actions recorded against user accounts
+const (
+	AuditUserCreate     = "create_user"
+	AuditPasswordReset  = "reset_password"
+	AuditPasswordChange = "change_password"
+	AuditUserDisable    = "disable_user"
+	AuditUserEnable     = "enable_user"
+	AuditEmailChange    = "change_email"
+	AuditRoleChange     = "change_role"
+	AuditEntityChange   = "change_entities"
+	AuditEntityRoles    = "change_entity_roles"
+	AuditSponsorChange  = "change_sponsor"
+	AuditSignup         = "signup"
+	AuditUserApprove    = "approve_user"
+	AuditRevokeSessions = "revoke_sessions"
+	AuditLogin          = "login"
+	AuditLoginFailed    = "login_failed"
+	AuditAccountLock    = "lock_account"
+	AuditAccountUnlock  = "unlock_account"
+	AuditForgotPassword = "forgot_password"
+	AuditResetByEmail   = "reset_password_email"
+	AuditMFAEnable      = "enable_mfa"
+	AuditMFADisable     = "disable_mfa"
+	AuditMFAReset       = "reset_mfa"
+	AuditRecoveryCodes  = "regenerate_recovery_codes"
+	AuditRecoveryUsed   = "use_recovery_code"
+)
+
+// Audit actions recorded against invitations
+const (
+	AuditInviteCreate = "create_invitation"
+	AuditInviteRevoke = "revoke_invitation"
+	AuditInviteAccept = "accept_invitation"
+)
+
+// Audit actions recorded against API keys
+const (
+	AuditAPIKeyCreate = "create_api_key"
+	AuditAPIKeyRevoke = "revoke_api_key"
+)
+
+// Audit actions recorded against roles
+const (
+	AuditRoleCreate = "create_role"
+	AuditRoleUpdate = "update_role"
+	AuditRoleDelete = "delete_role"
+)
+
+// Audit actions recorded against sponsors
+const (
+	AuditSponsorCreate = "create_sponsor"
+	AuditSponsorUpdate = "update_sponsor"
+	AuditSponsorDelete = "delete_sponsor"
+	// AuditSponsorLink records test items and studies assigned to a sponsor
+	AuditSponsorLink = "link_sponsor"
+)
+
+// Audit actions recorded against the personnel directory
+const (
+	AuditPersonCreate = "create_person"
+	AuditPersonUpdate = "update_person"
+	AuditPersonDelete = "delete_person"
+)
+
+// Audit actions recorded against disposal requests
+const (
+	AuditDisposalRequest = "request_disposal"
+	AuditDisposalApprove = "approve_disposal"
+)
+
+// AuditLog is an append-only trail of significant actions on archive records
+// and user accounts
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     *uint     `gorm:"index" json:"user_id"`
+	UserEmail  string    `json:"user_email"`
+	Action     string    `gorm:"not null;type:VARCHAR(50)" json:"action"`
+	RecordType string    `gorm:"type:VARCHAR(50);index:idx_audit_logs_record" json:"record_type"`
+	RecordID   uint      `gorm:"index:idx_audit_logs_record" json:"record_id"`
+	Details    string    `gorm:"type:text" json:"details"`
+	IPAddress  string    `gorm:"type:VARCHAR(64)" json:"ip_address"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// WriteAudit appends an entry to the audit log using tx, so it commits or
+// rolls back together with the change it describes
+func WriteAudit(tx *gorm.DB, entry AuditLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	return tx.Create(&entry).Error
+}
+
+// Kinds of access recorded in the access log
+const (
+	AccessView    = "view"
+	AccessExport  = "export"
+	AccessHistory = "history"
+)
+
+// AccessLog records one read of an archive record, as GLP requires access to
+// the archive to be controlled and traceable, not only changes to it. An
+// export logs every record it writes, with the query it was made with in
+// Filter.
+type AccessLog struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      *uint     `gorm:"index" json:"user_id"`
+	UserEmail   string    `json:"user_email"`
+	RecordType  string    `gorm:"type:VARCHAR(50);index:idx_access_logs_record" json:"record_type"`
+	RecordID    uint      `gorm:"index:idx_access_logs_record" json:"record_id"`
+	Entity      string    `gorm:"type:VARCHAR(50)" json:"entity"`
+	Access      string    `gorm:"type:VARCHAR(20)" json:"access"`
+	Filter      string    `gorm:"type:text" json:"filter"`
+	Purpose     string    `gorm:"type:text" json:"purpose"`
+	IPAddress   string    `gorm:"type:VARCHAR(64)" json:"ip_address"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
@@ -3,39 +3,59 @@ package db
 import (
 	"fmt"
 	"log"
-	"os"
+	"strings"
 
+	"eurofines-server/config"
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
-
-// ConnectDatabase initializes the database connection and runs migrations
-func ConnectDatabase() {
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASS")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
+// ConnectDatabase opens the database described by cfg: PostgreSQL, or a
+// single SQLite file for tests and small single-lab sites. Schema changes
+// are applied separately with `migrate up`; see migrate.go.
+func ConnectDatabase(cfg *config.Config) (*gorm.DB, error) {
+	switch cfg.DBDriver {
+	case config.DriverSQLite:
+		return OpenSQLite(cfg.DBPath)
+	default:
+		database, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("connect to database %s on %s:%s: %w", cfg.DBName, cfg.DBHost, cfg.DBPort, err)
+		}
+		log.Println("✅ Connected to PostgreSQL successfully!")
+		return database, nil
+	}
+}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host, user, password, dbname, port)
+// OpenSQLite opens (creating if needed) the SQLite database at path.
+// ":memory:" gives a private in-memory database, which tests use.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	dsn := "file:" + path
+	if path == ":memory:" {
+		dsn = "file::memory:"
+	}
+	pragmas := []string{"foreign_keys(1)", "busy_timeout(5000)"}
+	if path != ":memory:" {
+		pragmas = append(pragmas, "journal_mode(WAL)")
+	}
+	dsn += "?_pragma=" + strings.Join(pragmas, "&_pragma=")
 
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	database, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to database: %v", err)
+		return nil, fmt.Errorf("open sqlite database %s: %w", path, err)
 	}
 
-	log.Println("✅ Connected to PostgreSQL successfully!")
-
-	DB = database
-
-	// Auto migrate all your models (tables)
-	err = database.AutoMigrate(&User{}, &TestItem{}, &Study{}, &FacilityDoc{})
+	// SQLite allows one writer at a time; a single connection serialises
+	// access instead of failing with "database is locked", and keeps an
+	// in-memory database alive for the life of the pool.
+	sqlDB, err := database.DB()
 	if err != nil {
-		log.Fatalf("❌ Failed to migrate database: %v", err)
+		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(1)
 
-	log.Println("✅ Database migration complete!")
+	log.Printf("✅ Opened SQLite database %s", path)
+	return database, nil
 }
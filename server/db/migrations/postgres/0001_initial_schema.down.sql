@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS facility_docs;
+DROP TABLE IF EXISTS studies;
+DROP TABLE IF EXISTS test_items;
+DROP TABLE IF EXISTS users;
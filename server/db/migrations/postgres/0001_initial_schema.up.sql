@@ -1,5 +1,5 @@
--- Create database (run this manually in PostgreSQL)
--- CREATE DATABASE eurofines;
+-- Baseline schema. Uses IF NOT EXISTS so databases created by the old
+-- schema.sql or GORM AutoMigrate can be brought under migrations.
 
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS audit_logs;
+
+ALTER TABLE facility_docs DROP COLUMN IF EXISTS deletion_reason;
+ALTER TABLE facility_docs DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE facility_docs DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE studies DROP COLUMN IF EXISTS deletion_reason;
+ALTER TABLE studies DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE studies DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE test_items DROP COLUMN IF EXISTS deletion_reason;
+ALTER TABLE test_items DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE test_items DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,4 @@
+ALTER TABLE facility_docs DROP COLUMN IF EXISTS version;
+ALTER TABLE studies DROP COLUMN IF EXISTS version;
+ALTER TABLE test_items DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_facility_docs_search;
+DROP INDEX IF EXISTS idx_studies_search;
+DROP INDEX IF EXISTS idx_test_items_search;
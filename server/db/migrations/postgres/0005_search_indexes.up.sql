@@ -0,0 +1,17 @@
+-- Full-text search indexes. The expressions must match db.SearchTables
+-- exactly or PostgreSQL will not use them.
+CREATE INDEX IF NOT EXISTS idx_test_items_search ON test_items USING GIN ((
+  setweight(to_tsvector('simple', coalesce(test_item_name, '') || ' ' || coalesce(test_item_code, '')), 'A') ||
+  setweight(to_tsvector('simple', coalesce(company_name, '') || ' ' || coalesce(batch_no, '')), 'B') ||
+  setweight(to_tsvector('simple', coalesce(remark, '')), 'C')
+));
+CREATE INDEX IF NOT EXISTS idx_studies_search ON studies USING GIN ((
+  setweight(to_tsvector('simple', coalesce(study_number, '') || ' ' || coalesce(study_code, '') || ' ' || coalesce(test_item_code, '')), 'A') ||
+  setweight(to_tsvector('simple', coalesce(sd_or_pi_name, '')), 'B') ||
+  setweight(to_tsvector('simple', coalesce(remarks, '')), 'C')
+));
+CREATE INDEX IF NOT EXISTS idx_facility_docs_search ON facility_docs USING GIN ((
+  setweight(to_tsvector('simple', coalesce(particulars, '') || ' ' || coalesce(admin_index_no, '')), 'A') ||
+  setweight(to_tsvector('simple', coalesce(dept_section, '') || ' ' || coalesce(submitted_by, '')), 'B') ||
+  setweight(to_tsvector('simple', coalesce(admin_remarks, '')), 'C')
+));
@@ -0,0 +1,7 @@
+-- Entities a user belongs to, assigned by admins
+CREATE TABLE IF NOT EXISTS user_entities (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, entity)
+);
@@ -0,0 +1,17 @@
+-- Self-service signups wait for an admin's approval before they can sign in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Invitations let an admin pre-authorise one email address for one entity
+CREATE TABLE IF NOT EXISTS invitations (
+  id SERIAL PRIMARY KEY,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  email VARCHAR(255) NOT NULL,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMP NOT NULL,
+  accepted_at TIMESTAMP,
+  accepted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (LOWER(email));
@@ -0,0 +1,24 @@
+-- A session is one signed-in client. Its refresh token rotates on every use;
+-- only hashes are stored, and previous_hash detects reuse of a rotated token.
+CREATE TABLE IF NOT EXISTS sessions (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  refresh_hash VARCHAR(64) NOT NULL UNIQUE,
+  previous_hash VARCHAR(64),
+  ip_address VARCHAR(64),
+  user_agent TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  revoke_reason VARCHAR(50)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_hash ON sessions (previous_hash);
+
+-- Access tokens revoked before they expire (logout); rows can be dropped once expired
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti VARCHAR(64) PRIMARY KEY,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
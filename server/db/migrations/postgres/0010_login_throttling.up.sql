@@ -0,0 +1,6 @@
+-- Consecutive failed sign-ins per account; reaching the threshold locks it until locked_until
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+-- Sign-in events live in the audit log; failures per IP are counted from it
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action_ip ON audit_logs (action, ip_address, created_at);
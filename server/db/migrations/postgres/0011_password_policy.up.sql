@@ -0,0 +1,15 @@
+-- Set when an admin issues a password or the password has expired; the user
+-- may do nothing but change it until it is cleared
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+-- Passwords expire a fixed time after they were set; existing passwords count from now
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP;
+UPDATE users SET password_changed_at = CURRENT_TIMESTAMP WHERE password_changed_at IS NULL;
+
+-- Hashes of previous passwords, so recent ones cannot be reused
+CREATE TABLE IF NOT EXISTS password_history (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  password_hash VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id, created_at);
@@ -0,0 +1,10 @@
+-- Pending single sign-on attempts: PKCE verifier and nonce keyed by the state's hash
+CREATE TABLE IF NOT EXISTS oidc_logins (
+  id SERIAL PRIMARY KEY,
+  state_hash VARCHAR(64) NOT NULL UNIQUE,
+  code_verifier VARCHAR(128) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_oidc_logins_expires_at ON oidc_logins (expires_at);
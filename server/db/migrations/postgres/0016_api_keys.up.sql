@@ -0,0 +1,15 @@
+-- API keys for machine integrations; only hashes are stored
+CREATE TABLE IF NOT EXISTS api_keys (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  scopes TEXT NOT NULL,
+  prefix VARCHAR(20) NOT NULL,
+  key_hash VARCHAR(64) NOT NULL UNIQUE,
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP,
+  last_used_ip VARCHAR(64),
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
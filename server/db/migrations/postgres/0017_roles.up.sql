@@ -0,0 +1,29 @@
+-- Named sets of permissions; users.role holds the base role
+CREATE TABLE IF NOT EXISTS roles (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(50) NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  permissions TEXT NOT NULL,
+  builtin BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO roles (name, description, permissions, builtin) VALUES
+  ('admin', 'Full access, including user management', 'create,edit,archive,dispose,index,export,audit-read,manage-users', TRUE),
+  ('user', 'Registers and edits records', 'create,edit,index,export,audit-read', TRUE),
+  ('archivist', 'Maintains the archive and archives records', 'create,edit,archive,index,export,audit-read', FALSE),
+  ('qa-reviewer', 'Reviews records and their history', 'index,export,audit-read', FALSE),
+  ('study-director', 'Follows studies and their history', 'index,audit-read', FALSE),
+  ('submitter', 'Submits records for a department', 'create,edit,index', FALSE),
+  ('sponsor-viewer', 'Searches the records of a sponsor', 'index', FALSE)
+ON CONFLICT (name) DO NOTHING;
+
+-- Roles assigned to a user in one entity, or in every entity ('*')
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('*', 'adgyl', 'agro', 'biopharma')),
+  role VARCHAR(50) NOT NULL REFERENCES roles(name),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, entity, role)
+);
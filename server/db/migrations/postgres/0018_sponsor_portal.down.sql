@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS disposal_requests;
+ALTER TABLE users DROP COLUMN IF EXISTS sponsor;
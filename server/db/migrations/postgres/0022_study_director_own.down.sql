@@ -0,0 +1,7 @@
+UPDATE roles SET permissions = 'index,audit-read', description = 'Follows studies and their history'
+  WHERE name = 'study-director' AND permissions = 'index-own';
+UPDATE roles SET permissions = 'create,edit,archive,dispose,index,export,audit-read,manage-users'
+  WHERE name = 'admin' AND permissions = 'create,edit,archive,dispose,index,index-own,export,audit-read,manage-users';
+-- any other grant of index-own has no meaning before this migration
+UPDATE roles SET permissions = replace(replace(permissions, ',index-own', ''), 'index-own,', '')
+  WHERE permissions LIKE '%index-own%' AND permissions <> 'index-own';
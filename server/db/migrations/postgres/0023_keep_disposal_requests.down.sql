@@ -0,0 +1,3 @@
+DELETE FROM disposal_requests WHERE test_item_id NOT IN (SELECT id FROM test_items);
+ALTER TABLE disposal_requests ADD CONSTRAINT disposal_requests_test_item_id_fkey
+  FOREIGN KEY (test_item_id) REFERENCES test_items(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+-- Disposal requests are the sponsor's approval on record, so they outlive the
+-- test item once it is purged. test_item_id is kept as a plain reference,
+-- like audit_logs.record_id.
+ALTER TABLE disposal_requests DROP CONSTRAINT IF EXISTS disposal_requests_test_item_id_fkey;
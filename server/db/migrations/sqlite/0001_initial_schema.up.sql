@@ -1,9 +1,8 @@
--- Create database (run this manually in PostgreSQL)
--- CREATE DATABASE eurofines;
+-- Baseline schema (SQLite). Keep in step with ../postgres.
 
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
-  id SERIAL PRIMARY KEY,
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
   email VARCHAR(255) UNIQUE NOT NULL,
   password VARCHAR(255) NOT NULL,
   role VARCHAR(20) NOT NULL CHECK (role IN ('user', 'admin')),
@@ -13,7 +12,7 @@ CREATE TABLE IF NOT EXISTS users (
 
 -- Test Items table
 CREATE TABLE IF NOT EXISTS test_items (
-  id SERIAL PRIMARY KEY,
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
   test_item_name VARCHAR(255),
   test_item_code VARCHAR(100),
   company_name VARCHAR(255),
@@ -39,7 +38,7 @@ CREATE TABLE IF NOT EXISTS test_items (
 
 -- Studies table
 CREATE TABLE IF NOT EXISTS studies (
-  id SERIAL PRIMARY KEY,
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
   study_number VARCHAR(255),
   study_code VARCHAR(100),
   test_item_code VARCHAR(100),
@@ -70,7 +69,7 @@ CREATE TABLE IF NOT EXISTS studies (
   carcass_box_no_of_box VARCHAR(100),
   study_completion_date DATE,
   remarks TEXT,
-  raw_data_items JSONB,
+  raw_data_items TEXT,
   entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
   created_by INTEGER REFERENCES users(id),
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -79,7 +78,7 @@ CREATE TABLE IF NOT EXISTS studies (
 
 -- Facility Docs table
 CREATE TABLE IF NOT EXISTS facility_docs (
-  id SERIAL PRIMARY KEY,
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
   dept_section VARCHAR(255),
   date DATE,
   particulars VARCHAR(255),
@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS audit_logs;
+
+-- SQLite cannot drop an indexed column
+DROP INDEX IF EXISTS idx_facility_docs_deleted_at;
+DROP INDEX IF EXISTS idx_studies_deleted_at;
+DROP INDEX IF EXISTS idx_test_items_deleted_at;
+
+ALTER TABLE facility_docs DROP COLUMN deletion_reason;
+ALTER TABLE facility_docs DROP COLUMN deleted_by;
+ALTER TABLE facility_docs DROP COLUMN deleted_at;
+
+ALTER TABLE studies DROP COLUMN deletion_reason;
+ALTER TABLE studies DROP COLUMN deleted_by;
+ALTER TABLE studies DROP COLUMN deleted_at;
+
+ALTER TABLE test_items DROP COLUMN deletion_reason;
+ALTER TABLE test_items DROP COLUMN deleted_by;
+ALTER TABLE test_items DROP COLUMN deleted_at;
@@ -0,0 +1,32 @@
+ALTER TABLE test_items ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE test_items ADD COLUMN deleted_by INTEGER;
+ALTER TABLE test_items ADD COLUMN deletion_reason TEXT;
+
+ALTER TABLE studies ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE studies ADD COLUMN deleted_by INTEGER;
+ALTER TABLE studies ADD COLUMN deletion_reason TEXT;
+
+ALTER TABLE facility_docs ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE facility_docs ADD COLUMN deleted_by INTEGER;
+ALTER TABLE facility_docs ADD COLUMN deletion_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_test_items_deleted_at ON test_items(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_studies_deleted_at ON studies(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_facility_docs_deleted_at ON facility_docs(deleted_at);
+
+-- Audit log (append-only)
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER,
+  user_email VARCHAR(255),
+  action VARCHAR(50) NOT NULL,
+  record_type VARCHAR(50),
+  record_id INTEGER,
+  details TEXT,
+  ip_address VARCHAR(64),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_record ON audit_logs(record_type, record_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
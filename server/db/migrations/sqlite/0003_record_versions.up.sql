@@ -0,0 +1,15 @@
+-- Numbered snapshots of archive records, one per save
+CREATE TABLE IF NOT EXISTS record_versions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  record_type VARCHAR(50) NOT NULL,
+  record_id INTEGER NOT NULL,
+  version INTEGER NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  data TEXT NOT NULL,
+  changed_by INTEGER,
+  changed_by_email VARCHAR(255),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_record_versions_record ON record_versions(record_type, record_id, version);
+CREATE INDEX IF NOT EXISTS idx_record_versions_created_at ON record_versions(created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE facility_docs DROP COLUMN version;
+ALTER TABLE studies DROP COLUMN version;
+ALTER TABLE test_items DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
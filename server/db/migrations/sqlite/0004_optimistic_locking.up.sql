@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE test_items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE studies ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE facility_docs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- PostgreSQL builds GIN full-text indexes here. SQLite search matches with
+-- LIKE instead (see repository/search_sqlite.go), so there is nothing to do.
+SELECT 1;
@@ -0,0 +1,2 @@
+-- Accounts can be disabled without deleting them, keeping audit references intact
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
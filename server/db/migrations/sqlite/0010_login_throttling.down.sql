@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_logs_action_ip;
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN failed_logins;
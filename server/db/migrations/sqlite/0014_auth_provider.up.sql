@@ -0,0 +1,3 @@
+-- Which sign-in provider owns the account's password: local (bcrypt hash in
+-- users.password) or an external directory such as ldap
+ALTER TABLE users ADD COLUMN auth_provider VARCHAR(20) NOT NULL DEFAULT 'local';
@@ -0,0 +1,19 @@
+-- Sponsor portal accounts belong to the company named here; empty for staff
+ALTER TABLE users ADD COLUMN sponsor VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Requests for a sponsor to approve disposing of or returning a test item
+CREATE TABLE IF NOT EXISTS disposal_requests (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  test_item_id INTEGER NOT NULL REFERENCES test_items(id) ON DELETE CASCADE,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  company_name VARCHAR(255) NOT NULL,
+  action VARCHAR(20) NOT NULL CHECK (action IN ('dispose', 'return')),
+  note TEXT NOT NULL DEFAULT '',
+  requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  approved_at TIMESTAMP,
+  approved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  approval_note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_disposal_requests_test_item ON disposal_requests (test_item_id);
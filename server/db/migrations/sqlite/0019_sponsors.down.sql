@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_studies_sponsor;
+DROP INDEX IF EXISTS idx_test_items_sponsor;
+ALTER TABLE studies DROP COLUMN sponsor_id;
+ALTER TABLE test_items DROP COLUMN sponsor_id;
+DROP TABLE IF EXISTS sponsors;
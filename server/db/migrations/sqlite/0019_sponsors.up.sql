@@ -0,0 +1,22 @@
+-- Sponsor master data, replacing free-text company names on records
+CREATE TABLE IF NOT EXISTS sponsors (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(255) NOT NULL,
+  contact_name VARCHAR(255) NOT NULL DEFAULT '',
+  contact_email VARCHAR(255) NOT NULL DEFAULT '',
+  contact_phone VARCHAR(50) NOT NULL DEFAULT '',
+  address TEXT NOT NULL DEFAULT '',
+  -- years the sponsor's records are kept; NULL for the archive default
+  retention_years INTEGER CHECK (retention_years IS NULL OR retention_years >= 1),
+  notes TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sponsors_name ON sponsors (LOWER(name));
+
+ALTER TABLE test_items ADD COLUMN sponsor_id INTEGER REFERENCES sponsors(id);
+ALTER TABLE studies ADD COLUMN sponsor_id INTEGER REFERENCES sponsors(id);
+
+CREATE INDEX IF NOT EXISTS idx_test_items_sponsor ON test_items (sponsor_id);
+CREATE INDEX IF NOT EXISTS idx_studies_sponsor ON studies (sponsor_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_facility_docs_submitted_by;
+DROP INDEX IF EXISTS idx_test_items_archived_by;
+DROP INDEX IF EXISTS idx_studies_study_director;
+ALTER TABLE facility_docs DROP COLUMN submitted_by_id;
+ALTER TABLE test_items DROP COLUMN archived_by_id;
+ALTER TABLE studies DROP COLUMN study_director_id;
+DROP TABLE IF EXISTS personnel;
@@ -0,0 +1,20 @@
+-- Personnel directory of study directors, PIs and archivists that records name
+CREATE TABLE IF NOT EXISTS personnel (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  -- comma separated: study-director, pi, archivist
+  roles VARCHAR(255) NOT NULL DEFAULT '',
+  user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE SET NULL,
+  notes TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE studies ADD COLUMN study_director_id INTEGER REFERENCES personnel(id);
+ALTER TABLE test_items ADD COLUMN archived_by_id INTEGER REFERENCES personnel(id);
+ALTER TABLE facility_docs ADD COLUMN submitted_by_id INTEGER REFERENCES personnel(id);
+
+CREATE INDEX IF NOT EXISTS idx_studies_study_director ON studies (study_director_id);
+CREATE INDEX IF NOT EXISTS idx_test_items_archived_by ON test_items (archived_by_id);
+CREATE INDEX IF NOT EXISTS idx_facility_docs_submitted_by ON facility_docs (submitted_by_id);
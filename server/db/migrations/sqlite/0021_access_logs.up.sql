@@ -0,0 +1,18 @@
+-- Reads of individual archive records, kept apart from the audit log of changes
+CREATE TABLE IF NOT EXISTS access_logs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER,
+  user_email VARCHAR(255) NOT NULL DEFAULT '',
+  record_type VARCHAR(50) NOT NULL,
+  record_id INTEGER NOT NULL,
+  entity VARCHAR(50) NOT NULL DEFAULT '',
+  -- view or export
+  access VARCHAR(20) NOT NULL,
+  purpose TEXT NOT NULL DEFAULT '',
+  ip_address VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_logs_record ON access_logs (record_type, record_id);
+CREATE INDEX IF NOT EXISTS idx_access_logs_user_id ON access_logs (user_id);
+CREATE INDEX IF NOT EXISTS idx_access_logs_created_at ON access_logs (created_at);
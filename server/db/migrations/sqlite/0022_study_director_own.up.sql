@@ -0,0 +1,6 @@
+-- Study directors read only the studies they direct, through index-own.
+-- Roles an admin has edited since they were seeded are left alone.
+UPDATE roles SET permissions = 'index-own', description = 'Follows the studies they direct'
+  WHERE name = 'study-director' AND permissions = 'index,audit-read';
+UPDATE roles SET permissions = 'create,edit,archive,dispose,index,index-own,export,audit-read,manage-users'
+  WHERE name = 'admin' AND permissions = 'create,edit,archive,dispose,index,export,audit-read,manage-users';
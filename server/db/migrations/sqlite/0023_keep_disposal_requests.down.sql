@@ -0,0 +1,19 @@
+CREATE TABLE disposal_requests_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  test_item_id INTEGER NOT NULL REFERENCES test_items(id) ON DELETE CASCADE,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  company_name VARCHAR(255) NOT NULL,
+  action VARCHAR(20) NOT NULL CHECK (action IN ('dispose', 'return')),
+  note TEXT NOT NULL DEFAULT '',
+  requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  approved_at TIMESTAMP,
+  approved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  approval_note TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO disposal_requests_new SELECT * FROM disposal_requests
+  WHERE test_item_id IN (SELECT id FROM test_items);
+DROP TABLE disposal_requests;
+ALTER TABLE disposal_requests_new RENAME TO disposal_requests;
+CREATE INDEX IF NOT EXISTS idx_disposal_requests_test_item ON disposal_requests (test_item_id);
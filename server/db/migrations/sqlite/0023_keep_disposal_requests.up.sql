@@ -0,0 +1,22 @@
+-- Disposal requests are the sponsor's approval on record, so they outlive the
+-- test item once it is purged. test_item_id is kept as a plain reference,
+-- like audit_logs.record_id. SQLite cannot drop a constraint, so the table is
+-- rebuilt without it.
+CREATE TABLE disposal_requests_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  test_item_id INTEGER NOT NULL,
+  entity VARCHAR(50) NOT NULL CHECK (entity IN ('adgyl', 'agro', 'biopharma')),
+  company_name VARCHAR(255) NOT NULL,
+  action VARCHAR(20) NOT NULL CHECK (action IN ('dispose', 'return')),
+  note TEXT NOT NULL DEFAULT '',
+  requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  approved_at TIMESTAMP,
+  approved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  approval_note TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO disposal_requests_new SELECT * FROM disposal_requests;
+DROP TABLE disposal_requests;
+ALTER TABLE disposal_requests_new RENAME TO disposal_requests;
+CREATE INDEX IF NOT EXISTS idx_disposal_requests_test_item ON disposal_requests (test_item_id);
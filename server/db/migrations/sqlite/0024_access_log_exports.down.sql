@@ -0,0 +1 @@
+ALTER TABLE access_logs DROP COLUMN filter;
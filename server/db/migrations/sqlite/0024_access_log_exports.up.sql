@@ -0,0 +1,3 @@
+-- Each record an export writes is logged with the query the export was made
+-- with, before the export starts
+ALTER TABLE access_logs ADD COLUMN filter TEXT NOT NULL DEFAULT '';
@@ -4,8 +4,11 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Date is a custom type that handles date-only strings (YYYY-MM-DD)
@@ -140,20 +143,121 @@ func (d *Date) Scan(value interface{}) error {
 }
 
 type User struct {
-    ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-    Email     string    `gorm:"uniqueIndex;not null" json:"email"`
-    Password  string    `gorm:"not null" json:"-"`
-    Role      string    `gorm:"not null;type:VARCHAR(20);check:role IN ('user','admin')" json:"role"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email      string     `gorm:"uniqueIndex;not null" json:"email"`
+	Password   string     `gorm:"not null" json:"-"`
+	Role       string     `gorm:"not null;type:VARCHAR(20)" json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	// PendingApproval is set on self-service signups until an admin approves them
+	PendingApproval bool `gorm:"not null" json:"pending_approval"`
+	// FailedLogins counts failed sign-ins since the last success; reaching the
+	// lockout threshold sets LockedUntil
+	FailedLogins int        `gorm:"not null;default:0" json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until"`
+	// MustChangePassword limits the user to changing their password
+	MustChangePassword bool       `gorm:"not null" json:"must_change_password"`
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
+	// AuthProvider checks the password at sign-in; only local accounts have
+	// a password stored here
+	AuthProvider string `gorm:"not null;default:local;type:VARCHAR(20)" json:"auth_provider"`
+	// MFASecret is the TOTP secret; it takes effect once MFAEnabledAt is set
+	MFASecret    string     `gorm:"column:mfa_secret;type:VARCHAR(64)" json:"-"`
+	MFAEnabledAt *time.Time `gorm:"column:mfa_enabled_at" json:"mfa_enabled_at"`
+	// MFALastStep is the TOTP time step of the last accepted code
+	MFALastStep int64 `gorm:"column:mfa_last_step;not null;default:0" json:"-"`
+	// Sponsor is the company of a sponsor portal account, matched against
+	// TestItem.CompanyName; empty for staff
+	Sponsor   string    `gorm:"not null;default:''" json:"sponsor"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `gorm:"not null;default:1" json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Sign-in providers recorded in User.AuthProvider
+const (
+	ProviderLocal = "local"
+	ProviderLDAP  = "ldap"
+	ProviderOIDC  = "oidc"
+)
+
+// HasLocalPassword reports whether the password is stored and managed here
+// rather than in an external directory
+func (u *User) HasLocalPassword() bool {
+	return u.AuthProvider == "" || u.AuthProvider == ProviderLocal
+}
+
+// PasswordSetAt is when the current password was set, for accounts created
+// before this was recorded the creation time
+func (u *User) PasswordSetAt() time.Time {
+	if u.PasswordChangedAt != nil {
+		return *u.PasswordChangedAt
+	}
+	return u.CreatedAt
+}
+
+// PasswordHistory keeps the hash of a password a user has replaced
+type PasswordHistory struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"not null;index"`
+	PasswordHash string `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+// TableName keeps the table name singular, as created by the migration
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// PasswordReset is a one-time token emailed to a user who forgot their
+// password. Only the token's hash is stored.
+type PasswordReset struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null;type:VARCHAR(64)"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	IPAddress string `gorm:"type:VARCHAR(64)"`
+	CreatedAt time.Time
 }
 
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only the code's hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;type:VARCHAR(64)"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TableName matches the table created by the migration
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// OIDCLogin is a single sign-on attempt between the redirect to the
+// provider and the callback. It is keyed by the hash of the state parameter
+// and holds the PKCE verifier and nonce the callback needs.
+type OIDCLogin struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null;type:VARCHAR(64)"`
+	CodeVerifier string    `gorm:"not null;type:VARCHAR(128)"`
+	Nonce        string    `gorm:"not null;type:VARCHAR(64)"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+// TableName matches the table created by the migration
+func (OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
 
 type TestItem struct {
 	ID                  uint       `gorm:"primaryKey" json:"id"`
 	TestItemName        string     `json:"test_item_name"`
 	TestItemCode        string     `json:"test_item_code"`
 	CompanyName         string     `json:"company_name"`
+	SponsorID           *uint      `json:"sponsor_id"`
 	DateOfReceipt       *Date      `json:"date_of_receipt"`
 	BatchNo             string     `json:"batch_no"`
 	ArcNo               string     `json:"arc_no"`
@@ -167,12 +271,18 @@ type TestItem struct {
 	ArchivedBy          string     `json:"archived_by"`
 	DisposedOrReturned  string     `json:"disposed_or_returned"`
 	SponsorApprovalDate *Date      `json:"sponsor_approval_date"`
+	ArchivedByID        *uint      `json:"archived_by_id"`
 	Remark              string     `gorm:"type:text" json:"remark"`
-	Entity              string     `gorm:"not null;check:entity IN ('adgyl', 'agro', 'biopharma')" json:"entity"`
+	Entity              string     `gorm:"not null" json:"entity"`
 	CreatedBy           *uint      `json:"created_by"`
 	Creator             *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 	CreatedAt           time.Time  `json:"created_at"`
+	Version             int        `gorm:"not null;default:1" json:"version"`
 	UpdatedAt           time.Time  `json:"updated_at"`
+
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedBy      *uint          `json:"deleted_by,omitempty"`
+	DeletionReason string         `gorm:"type:text" json:"deletion_reason,omitempty"`
 }
 
 type Study struct {
@@ -180,7 +290,9 @@ type Study struct {
 	StudyNumber                              string     `json:"study_number"`
 	StudyCode                                string     `json:"study_code"`
 	TestItemCode                             string     `json:"test_item_code"`
+	SponsorID                                *uint      `json:"sponsor_id"`
 	SdOrPiName                               string     `json:"sd_or_pi_name"`
+	StudyDirectorID                          *uint      `json:"study_director_id"`
 	StudyPlanPageNo                          string     `json:"study_plan_page_no"`
 	StudyPlanAmendmentPages                  string     `json:"study_plan_amendment_pages"`
 	DateOfReceipt                            *Date      `json:"date_of_receipt"`
@@ -208,11 +320,16 @@ type Study struct {
 	StudyCompletionDate                      *Date      `json:"study_completion_date"`
 	Remarks                                  string     `gorm:"type:text" json:"remarks"`
 	RawDataItems                             string     `gorm:"type:jsonb" json:"raw_data_items"`
-	Entity                                   string     `gorm:"not null;check:entity IN ('adgyl', 'agro', 'biopharma')" json:"entity"`
+	Entity                                   string     `gorm:"not null" json:"entity"`
 	CreatedBy                                *uint      `json:"created_by"`
 	Creator                                  *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 	CreatedAt                                time.Time  `json:"created_at"`
+	Version                                  int        `gorm:"not null;default:1" json:"version"`
 	UpdatedAt                                time.Time  `json:"updated_at"`
+
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedBy      *uint          `json:"deleted_by,omitempty"`
+	DeletionReason string         `gorm:"type:text" json:"deletion_reason,omitempty"`
 }
 
 type FacilityDoc struct {
@@ -222,13 +339,290 @@ type FacilityDoc struct {
 	Particulars         string     `json:"particulars"`
 	TotalNoOfPages      *int       `json:"total_no_of_pages"`
 	SubmittedBy         string     `json:"submitted_by"`
+	SubmittedByID       *uint      `json:"submitted_by_id"`
 	AdminIndexNo        string     `json:"admin_index_no"`
 	AdminDateOfReceipt  *Date      `json:"admin_date_of_receipt"`
 	AdminDateOfIndexing *Date      `json:"admin_date_of_indexing"`
 	AdminRemarks        string     `gorm:"type:text" json:"admin_remarks"`
-	Entity              string     `gorm:"not null;check:entity IN ('adgyl', 'agro', 'biopharma')" json:"entity"`
+	Entity              string     `gorm:"not null" json:"entity"`
 	CreatedBy           *uint      `json:"created_by"`
 	Creator             *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 	CreatedAt           time.Time  `json:"created_at"`
+	Version             int        `gorm:"not null;default:1" json:"version"`
 	UpdatedAt           time.Time  `json:"updated_at"`
+
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedBy      *uint          `json:"deleted_by,omitempty"`
+	DeletionReason string         `gorm:"type:text" json:"deletion_reason,omitempty"`
+}
+
+// UserEntity records that a user belongs to an entity
+type UserEntity struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	Entity    string    `gorm:"primaryKey;type:VARCHAR(50)" json:"entity"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sponsor is a sponsor company that records are archived for. Test items
+// keep the sponsor's name in CompanyName as well.
+type Sponsor struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Name         string `gorm:"not null" json:"name"`
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+	ContactPhone string `json:"contact_phone"`
+	Address      string `gorm:"type:text" json:"address"`
+	// RetentionYears is how long the sponsor's records are kept when longer
+	// than the archive's own retention period; nil for the archive default
+	RetentionYears *int      `json:"retention_years"`
+	Notes          string    `gorm:"type:text" json:"notes"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Person is an entry in the personnel directory that study and archive
+// records name. The record keeps the person's name in its free-text field
+// as well (SdOrPiName, ArchivedBy, SubmittedBy).
+type Person struct {
+	ID    uint   `gorm:"primaryKey" json:"id"`
+	Name  string `gorm:"not null" json:"name"`
+	Email string `json:"email"`
+	// Roles is a comma separated list of PersonRoles
+	Roles string `gorm:"not null;default:''" json:"-"`
+	// UserID links the person to their account, if they have one
+	UserID    *uint     `json:"user_id"`
+	Notes     string    `gorm:"type:text" json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName matches the table created by the migration
+func (Person) TableName() string {
+	return "personnel"
+}
+
+// Roles a person can have in the personnel directory
+const (
+	PersonStudyDirector = "study-director"
+	PersonPI            = "pi"
+	PersonArchivist     = "archivist"
+)
+
+// PersonRoles lists every personnel role in display order
+var PersonRoles = []string{PersonStudyDirector, PersonPI, PersonArchivist}
+
+// RoleList returns the person's roles
+func (p *Person) RoleList() []string {
+	if p.Roles == "" {
+		return []string{}
+	}
+	return strings.Split(p.Roles, ",")
+}
+
+// HasRole reports whether the person has any of roles
+func (p *Person) HasRole(roles ...string) bool {
+	for _, r := range p.RoleList() {
+		if slices.Contains(roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// DisposalRequest asks a test item's sponsor to approve its disposal or
+// return. Approval fills the test item's SponsorApprovalDate.
+type DisposalRequest struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	TestItemID uint `gorm:"not null;index" json:"test_item_id"`
+	// Entity and CompanyName are copied from the test item when requested
+	Entity       string     `gorm:"not null;type:VARCHAR(50)" json:"entity"`
+	CompanyName  string     `gorm:"not null" json:"company_name"`
+	Action       string     `gorm:"not null;type:VARCHAR(20)" json:"action"`
+	Note         string     `gorm:"type:text" json:"note"`
+	RequestedBy  *uint      `json:"requested_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ApprovedAt   *time.Time `json:"approved_at"`
+	ApprovedBy   *uint      `json:"approved_by"`
+	ApprovalNote string     `gorm:"type:text" json:"approval_note"`
+}
+
+// Actions a disposal request asks the sponsor to approve
+const (
+	DisposalDispose = "dispose"
+	DisposalReturn  = "return"
+)
+
+// Disposal request statuses
+const (
+	DisposalPending  = "pending"
+	DisposalApproved = "approved"
+)
+
+// Status reports whether the sponsor has approved the request
+func (r *DisposalRequest) Status() string {
+	if r.ApprovedAt != nil {
+		return DisposalApproved
+	}
+	return DisposalPending
+}
+
+// Role is a named set of permissions. Users have a base role (User.Role) and
+// may be assigned further roles per entity.
+type Role struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"uniqueIndex;not null;type:VARCHAR(50)" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	// Permissions is a comma separated list of Permissions
+	Permissions string `gorm:"type:text;not null" json:"-"`
+	// Builtin roles ship with the archive and cannot be deleted
+	Builtin   bool      `gorm:"not null" json:"builtin"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserRole assigns a role to a user in one entity, or in every entity when
+// Entity is AllEntities
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"-"`
+	Entity    string    `gorm:"primaryKey;type:VARCHAR(50)" json:"entity"`
+	Role      string    `gorm:"primaryKey;type:VARCHAR(50)" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation authorises one email address to sign up as a user of one
+// entity. Only a hash of the token is stored; the token itself is shown once
+// to the inviting admin.
+type Invitation struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	TokenHash  string     `gorm:"uniqueIndex;not null;type:VARCHAR(64)" json:"-"`
+	Email      string     `gorm:"not null" json:"email"`
+	Entity     string     `gorm:"not null;type:VARCHAR(50)" json:"entity"`
+	InvitedBy  *uint      `json:"invited_by"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	AcceptedBy *uint      `json:"accepted_by"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Invitation statuses reported by Invitation.Status
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Status reports whether the invitation is still open at now
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+// Usable reports whether the invitation can still be redeemed at now
+func (i *Invitation) Usable(now time.Time) bool {
+	return i.Status(now) == InvitationPending
+}
+
+// APIKey lets a machine integration (a LIMS, a label-printing station) call
+// the API without a user's password. A key belongs to one entity and grants
+// only its scopes. Only the key's hash is stored; Prefix identifies it in
+// lists.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Entity     string     `gorm:"not null;type:VARCHAR(50)" json:"entity"`
+	Scopes     string     `gorm:"not null;type:text" json:"-"`
+	Prefix     string     `gorm:"not null;type:VARCHAR(20)" json:"prefix"`
+	KeyHash    string     `gorm:"uniqueIndex;not null;type:VARCHAR(64)" json:"-"`
+	CreatedBy  *uint      `json:"created_by"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"type:VARCHAR(64)" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName matches the table created by the migration
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// Scopes an API key can be granted
+const (
+	ScopeTestItemsRead  = "test_items:read"
+	ScopeTestItemsWrite = "test_items:write"
+	ScopeExport         = "export"
+)
+
+// APIKeyScopes lists every scope, in the order they are shown
+var APIKeyScopes = []string{ScopeTestItemsRead, ScopeTestItemsWrite, ScopeExport}
+
+// API key statuses reported by APIKey.Status
+const (
+	APIKeyActive  = "active"
+	APIKeyRevoked = "revoked"
+	APIKeyExpired = "expired"
+)
+
+// ScopeList returns the key's scopes
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Status reports whether the key is still accepted at now
+func (k *APIKey) Status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyRevoked
+	case !now.Before(k.ExpiresAt):
+		return APIKeyExpired
+	}
+	return APIKeyActive
+}
+
+// Session is one signed-in client. The refresh token is rotated on every use
+// and only its hash is kept; PreviousHash is the hash it replaced, so reuse of
+// a rotated token can be detected.
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	RefreshHash  string     `gorm:"uniqueIndex;not null;type:VARCHAR(64)" json:"-"`
+	PreviousHash string     `gorm:"index;type:VARCHAR(64)" json:"-"`
+	IPAddress    string     `gorm:"type:VARCHAR(64)" json:"ip_address"`
+	UserAgent    string     `gorm:"type:text" json:"user_agent"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	RevokeReason string     `gorm:"type:VARCHAR(50)" json:"revoke_reason,omitempty"`
+	// MFAVerified is set when the session was opened with a second factor
+	MFAVerified bool `gorm:"column:mfa_verified;not null" json:"mfa_verified"`
+}
+
+// RevokedToken is an access token withdrawn before it expired
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;primaryKey;type:VARCHAR(64)"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
 }
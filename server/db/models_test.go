@@ -0,0 +1,67 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDateJSON(t *testing.T) {
+	for _, in := range []string{`"2024-03-05"`, `"2024-03-05T00:00:00Z"`, `"2024-03-05T00:00:00.000Z"`} {
+		var d Date
+		if err := json.Unmarshal([]byte(in), &d); err != nil {
+			t.Fatalf("unmarshal %s: %v", in, err)
+		}
+		out, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `"2024-03-05"` {
+			t.Errorf("%s round-tripped to %s", in, out)
+		}
+	}
+
+	for _, in := range []string{`null`, `""`, `"undefined"`} {
+		var d Date
+		if err := json.Unmarshal([]byte(in), &d); err != nil || !d.IsZero() {
+			t.Errorf("%s: got %v, %v; want zero date", in, d.Time(), err)
+		}
+		if out, _ := json.Marshal(d); string(out) != "null" {
+			t.Errorf("zero date marshals to %s, want null", out)
+		}
+	}
+
+	var d Date
+	if err := json.Unmarshal([]byte(`"05/03/2024"`), &d); err == nil {
+		t.Error("dd/mm/yyyy was accepted")
+	}
+}
+
+func TestDateSQL(t *testing.T) {
+	want := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	if v, err := (Date{}).Value(); err != nil || v != nil {
+		t.Errorf("zero Value() = %v, %v; want NULL", v, err)
+	}
+	if v, err := NewDate(want).Value(); err != nil || !v.(time.Time).Equal(want) {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+
+	for _, src := range []interface{}{want, "2024-03-05", []byte("2024-03-05"), "2024-03-05T00:00:00Z"} {
+		var d Date
+		if err := d.Scan(src); err != nil {
+			t.Fatalf("Scan(%#v): %v", src, err)
+		}
+		if !d.Time().Equal(want) {
+			t.Errorf("Scan(%#v) = %v, want %v", src, d.Time(), want)
+		}
+	}
+
+	var d Date
+	if err := d.Scan(nil); err != nil || !d.IsZero() {
+		t.Errorf("Scan(nil) = %v, %v; want zero", d.Time(), err)
+	}
+	if err := d.Scan(42); err == nil {
+		t.Error("Scan(int) succeeded")
+	}
+}
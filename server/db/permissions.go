@@ -0,0 +1,83 @@
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// Permissions a role can grant. Each guards one kind of action on the
+// archive; PermManageUsers guards the admin endpoints. PermIndexOwn reads
+// only the studies whose study director is linked to the user.
+const (
+	PermCreate      = "create"
+	PermEdit        = "edit"
+	PermArchive     = "archive"
+	PermDispose     = "dispose"
+	PermIndex       = "index"
+	PermIndexOwn    = "index-own"
+	PermExport      = "export"
+	PermAuditRead   = "audit-read"
+	PermManageUsers = "manage-users"
+)
+
+// Permissions lists every permission, in the order they are shown
+var Permissions = []string{PermCreate, PermEdit, PermArchive, PermDispose, PermIndex, PermIndexOwn, PermExport, PermAuditRead, PermManageUsers}
+
+// Built-in roles. Every user has one of these as their base role.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// AllEntities stands for every entity in role assignments and Grants
+const AllEntities = "*"
+
+// Grants are the permissions a user holds, by entity. Permissions held under
+// AllEntities apply in every entity.
+type Grants map[string][]string
+
+// Add grants perms in entity
+func (g Grants) Add(entity string, perms ...string) {
+	for _, p := range perms {
+		if !g.has(entity, p) {
+			g[entity] = append(g[entity], p)
+		}
+	}
+}
+
+func (g Grants) has(entity, perm string) bool {
+	for _, p := range g[entity] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether perm is held in entity
+func (g Grants) Has(perm, entity string) bool {
+	return g.has(AllEntities, perm) || g.has(entity, perm)
+}
+
+// Entities returns the entities in which perm is held, sorted; all is true
+// when it is held in every entity
+func (g Grants) Entities(perm string) (entities []string, all bool) {
+	if g.has(AllEntities, perm) {
+		return nil, true
+	}
+	for entity := range g {
+		if g.has(entity, perm) {
+			entities = append(entities, entity)
+		}
+	}
+	sort.Strings(entities)
+	return entities, false
+}
+
+// PermissionList returns the role's permissions
+func (r *Role) PermissionList() []string {
+	if r.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(r.Permissions, ",")
+}
@@ -0,0 +1,53 @@
+package db
+
+import "time"
+
+// Retainable is implemented by archive records that fall under the GLP
+// retention period and therefore may not be purged before it ends
+type Retainable interface {
+	RetentionStart() time.Time
+}
+
+// RetainedUntil returns the end of the retention period for r
+func RetainedUntil(r Retainable, years int) time.Time {
+	return r.RetentionStart().AddDate(years, 0, 0)
+}
+
+// UnderRetention reports whether r is still inside its retention period
+func UnderRetention(r Retainable, years int, now time.Time) bool {
+	return now.Before(RetainedUntil(r, years))
+}
+
+// RetentionStart is the archive date, falling back to when the record was created
+func (t *TestItem) RetentionStart() time.Time {
+	if t.DateOfArchive != nil && !t.DateOfArchive.IsZero() {
+		return t.DateOfArchive.Time()
+	}
+	return t.CreatedAt
+}
+
+// RetentionStart is the study completion date, falling back to when the record was created
+func (s *Study) RetentionStart() time.Time {
+	if s.StudyCompletionDate != nil && !s.StudyCompletionDate.IsZero() {
+		return s.StudyCompletionDate.Time()
+	}
+	return s.CreatedAt
+}
+
+// RetentionStart is the document date, falling back to when the record was created
+func (f *FacilityDoc) RetentionStart() time.Time {
+	if f.Date != nil && !f.Date.IsZero() {
+		return f.Date.Time()
+	}
+	return f.CreatedAt
+}
+
+// Sponsored is implemented by archive records that may belong to a sponsor,
+// whose retention terms can extend the retention period
+type Sponsored interface {
+	SponsorRef() *uint
+}
+
+func (t *TestItem) SponsorRef() *uint { return t.SponsorID }
+
+func (s *Study) SponsorRef() *uint { return s.SponsorID }
@@ -0,0 +1,50 @@
+package db
+
+// SearchTable describes how one archive table takes part in full-text search.
+// Document is the expression used in queries; it must match the GIN index
+// expression in migrations/postgres/0005_search_indexes.up.sql exactly for
+// PostgreSQL to use the index. Weights lists the same columns by weight
+// (A, B, C) for backends without tsvector support.
+type SearchTable struct {
+	Type     string
+	Table    string
+	Title    string
+	Document string
+	Text     string
+	Weights  [3][]string
+}
+
+// SearchTables lists the searchable registers. Names and codes weigh most,
+// then sponsor/person/batch fields, then free-text remarks.
+var SearchTables = []SearchTable{
+	{
+		Type:  "test_item",
+		Table: "test_items",
+		Title: "test_item_name",
+		Document: "setweight(to_tsvector('simple', coalesce(test_item_name, '') || ' ' || coalesce(test_item_code, '')), 'A') || " +
+			"setweight(to_tsvector('simple', coalesce(company_name, '') || ' ' || coalesce(batch_no, '')), 'B') || " +
+			"setweight(to_tsvector('simple', coalesce(remark, '')), 'C')",
+		Text:    "concat_ws(' | ', test_item_name, test_item_code, company_name, batch_no, remark)",
+		Weights: [3][]string{{"test_item_name", "test_item_code"}, {"company_name", "batch_no"}, {"remark"}},
+	},
+	{
+		Type:  "study",
+		Table: "studies",
+		Title: "study_number",
+		Document: "setweight(to_tsvector('simple', coalesce(study_number, '') || ' ' || coalesce(study_code, '') || ' ' || coalesce(test_item_code, '')), 'A') || " +
+			"setweight(to_tsvector('simple', coalesce(sd_or_pi_name, '')), 'B') || " +
+			"setweight(to_tsvector('simple', coalesce(remarks, '')), 'C')",
+		Text:    "concat_ws(' | ', study_number, study_code, test_item_code, sd_or_pi_name, remarks)",
+		Weights: [3][]string{{"study_number", "study_code", "test_item_code"}, {"sd_or_pi_name"}, {"remarks"}},
+	},
+	{
+		Type:  "facility_doc",
+		Table: "facility_docs",
+		Title: "particulars",
+		Document: "setweight(to_tsvector('simple', coalesce(particulars, '') || ' ' || coalesce(admin_index_no, '')), 'A') || " +
+			"setweight(to_tsvector('simple', coalesce(dept_section, '') || ' ' || coalesce(submitted_by, '')), 'B') || " +
+			"setweight(to_tsvector('simple', coalesce(admin_remarks, '')), 'C')",
+		Text:    "concat_ws(' | ', particulars, admin_index_no, dept_section, submitted_by, admin_remarks)",
+		Weights: [3][]string{{"particulars", "admin_index_no"}, {"dept_section", "submitted_by"}, {"admin_remarks"}},
+	},
+}
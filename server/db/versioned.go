@@ -0,0 +1,23 @@
+package db
+
+// Versioned is implemented by models carrying an optimistic-locking version.
+// Every successful update increments the version; writers must present the
+// version they read.
+type Versioned interface {
+	CurrentVersion() int
+}
+
+func (u *User) CurrentVersion() int        { return u.Version }
+func (t *TestItem) CurrentVersion() int    { return t.Version }
+func (s *Study) CurrentVersion() int       { return s.Version }
+func (f *FacilityDoc) CurrentVersion() int { return f.Version }
+
+// RecordID returns the primary key of an archive record
+func (t *TestItem) RecordID() uint    { return t.ID }
+func (s *Study) RecordID() uint       { return s.ID }
+func (f *FacilityDoc) RecordID() uint { return f.ID }
+
+// RecordEntity returns the entity an archive record belongs to
+func (t *TestItem) RecordEntity() string    { return t.Entity }
+func (s *Study) RecordEntity() string       { return s.Entity }
+func (f *FacilityDoc) RecordEntity() string { return f.Entity }
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Version actions
+const (
+	VersionCreate   = "create"
+	VersionUpdate   = "update"
+	VersionDelete   = "delete"
+	VersionRestore  = "restore"
+	VersionBaseline = "baseline"
+)
+
+// RecordVersion is a numbered snapshot of an archive record after a save.
+// Versions are kept when a record is purged so its history stays inspectable.
+type RecordVersion struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	RecordType     string    `gorm:"not null;type:VARCHAR(50);uniqueIndex:idx_record_versions_record" json:"record_type"`
+	RecordID       uint      `gorm:"not null;uniqueIndex:idx_record_versions_record" json:"record_id"`
+	Version        int       `gorm:"not null;uniqueIndex:idx_record_versions_record" json:"version"`
+	Action         string    `gorm:"not null;type:VARCHAR(20)" json:"action"`
+	Data           string    `gorm:"type:jsonb;not null" json:"-"`
+	ChangedBy      *uint     `json:"changed_by"`
+	ChangedByEmail string    `json:"changed_by_email"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
+
+// VersionInput describes a save to be recorded
+type VersionInput struct {
+	RecordType     string
+	RecordID       uint
+	Action         string
+	Record         interface{} // state after the change
+	Before         interface{} // state before the change, used if the record has no history yet
+	ChangedBy      *uint
+	ChangedByEmail string
+}
+
+// SaveVersion stores in.Record as the record's next version. Records that
+// predate versioning get their prior state stored first as a baseline
+// version, so the first diff shows the actual change.
+func SaveVersion(tx *gorm.DB, in VersionInput) (*RecordVersion, error) {
+	var latest int
+	if err := tx.Model(&RecordVersion{}).
+		Where("record_type = ? AND record_id = ?", in.RecordType, in.RecordID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	if latest == 0 && in.Before != nil && in.Action != VersionCreate {
+		if _, err := insertVersion(tx, in, VersionBaseline, in.Before, 1); err != nil {
+			return nil, err
+		}
+		latest = 1
+	}
+	return insertVersion(tx, in, in.Action, in.Record, latest+1)
+}
+
+func insertVersion(tx *gorm.DB, in VersionInput, action string, record interface{}, n int) (*RecordVersion, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	v := RecordVersion{
+		RecordType:     in.RecordType,
+		RecordID:       in.RecordID,
+		Version:        n,
+		Action:         action,
+		Data:           string(data),
+		ChangedBy:      in.ChangedBy,
+		ChangedByEmail: in.ChangedByEmail,
+		CreatedAt:      time.Now(),
+	}
+	if err := tx.Create(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// FieldChange is one field that differs between two versions
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// diffIgnored are bookkeeping fields that change on every save
+var diffIgnored = map[string]bool{"updated_at": true, "version": true, "creator": true}
+
+// DiffVersions lists the fields whose values differ between from and to
+func DiffVersions(from, to *RecordVersion) ([]FieldChange, error) {
+	var a, b map[string]interface{}
+	if err := json.Unmarshal([]byte(from.Data), &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(to.Data), &b); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	fields := make([]string, 0, len(keys))
+	for k := range keys {
+		if !diffIgnored[k] {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, f := range fields {
+		if !reflect.DeepEqual(a[f], b[f]) {
+			changes = append(changes, FieldChange{Field: f, From: a[f], To: b[f]})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is an output format supported by the register exports
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+	FormatPDF  Format = "pdf"
+)
+
+// ParseFormat validates a ?format= query value, defaulting to CSV
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	case FormatPDF:
+		return FormatPDF, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %s, expected csv, xlsx or pdf", s)
+}
+
+// ContentType returns the MIME type sent with the export
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatPDF:
+		return "application/pdf"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Extension returns the file extension used in the download filename
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// Meta describes the register being exported. It is printed in the
+// PDF page header and in the first rows of the XLSX sheet.
+type Meta struct {
+	Title       string
+	Entity      string
+	GeneratedAt time.Time
+	GeneratedBy string
+}
+
+// EntityLabel returns the entity for display, or "All entities" when unscoped
+func (m Meta) EntityLabel() string {
+	if m.Entity == "" {
+		return "All entities"
+	}
+	return strings.ToUpper(m.Entity)
+}
+
+// escapeFormula prefixes a value that a spreadsheet would run as a formula
+// with ', so that record text opens as text in Excel
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Writer receives the register one row at a time so callers can stream
+// rows straight from the database.
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []string) error
+	// Close flushes any buffered output. It must be called exactly once.
+	Close() error
+}
+
+// NewWriter returns a Writer producing the given format on w
+func NewWriter(format Format, w io.Writer, meta Meta) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, meta)
+	case FormatPDF:
+		return newPDFWriter(w, meta), nil
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
@@ -0,0 +1,280 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfFontSize  = 7
+	pdfRowHeight = 5
+
+	// landscape A4 in mm, and the points per mm PDF coordinates use
+	pdfPageW  = 297.0
+	pdfPageH  = 210.0
+	pdfMargin = 10.0
+	pdfBottom = pdfPageH - 12
+	pdfK      = 72 / 25.4
+	// pdfCellMargin is the padding left of text in a cell, as fpdf's default
+	pdfCellMargin = 1.0
+)
+
+// Objects whose numbers are known up front. Pages and the page count are
+// written last, once every page is known; the rest of the objects are
+// pages, numbered from pdfFirstPageObj in the order they are written.
+const (
+	pdfCatalogObj = iota + 1
+	pdfPagesObj
+	pdfFontObj
+	pdfBoldFontObj
+	pdfPageCountObj
+	pdfResourcesObj
+	pdfFirstPageObj
+)
+
+// pdfWriter lays the register out as a landscape A4 table. The column
+// header is repeated on every page and each page carries the register
+// metadata and "Page x of y".
+//
+// Every page is written to out as soon as it is full, so only one page is
+// held in memory. The total in "of y" is a form XObject that every footer
+// refers to and that is only written at Close. fpdf is used for the
+// Helvetica metrics and code page, not to build the document.
+type pdfWriter struct {
+	out     *pdfOutput
+	meta    Meta
+	measure *fpdf.Fpdf
+	tr      func(string) string
+	columns []string
+	widths  []float64
+
+	started bool
+	page    bytes.Buffer // content stream of the current page
+	pages   []int        // object numbers of the written pages
+	y       float64      // current position from the top of the page, in mm
+	nextObj int
+}
+
+// pdfOutput counts the bytes written for the cross-reference table and
+// keeps the first write error
+type pdfOutput struct {
+	w       io.Writer
+	n       int64
+	err     error
+	offsets map[int]int64
+}
+
+func (o *pdfOutput) printf(format string, args ...interface{}) {
+	if o.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(o.w, format, args...)
+	o.n += int64(n)
+	o.err = err
+}
+
+// object writes object num with body, or with dict and a stream
+func (o *pdfOutput) object(num int, dict string, stream []byte) {
+	o.offsets[num] = o.n
+	if stream == nil {
+		o.printf("%d 0 obj\n%s\nendobj\n", num, dict)
+		return
+	}
+	o.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(stream))
+	if o.err == nil {
+		n, err := o.w.Write(stream)
+		o.n += int64(n)
+		o.err = err
+	}
+	o.printf("\nendstream\nendobj\n")
+}
+
+func newPDFWriter(w io.Writer, meta Meta) *pdfWriter {
+	measure := fpdf.New("L", "mm", "A4", "")
+	return &pdfWriter{
+		out:     &pdfOutput{w: w, offsets: map[int]int64{}},
+		meta:    meta,
+		measure: measure,
+		tr:      measure.UnicodeTranslatorFromDescriptor(""),
+		nextObj: pdfFirstPageObj,
+	}
+}
+
+// start writes the document header and the shared objects. It is called
+// when the first page is complete, so nothing reaches out before the first
+// rows are in and callers can still answer with an error until then.
+func (p *pdfWriter) start() {
+	if p.started {
+		return
+	}
+	p.started = true
+	p.out.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	p.out.object(pdfFontObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	p.out.object(pdfBoldFontObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+	p.out.object(pdfResourcesObj, fmt.Sprintf("<< /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject << /NB %d 0 R >> >>",
+		pdfFontObj, pdfBoldFontObj, pdfPageCountObj), nil)
+}
+
+func (p *pdfWriter) addPage() {
+	if p.page.Len() > 0 {
+		p.finishPage()
+	}
+	p.y = pdfMargin
+	p.text(pdfMargin, 6, "B", 11, p.meta.Title+" - "+p.meta.EntityLabel())
+	p.y += 6
+	line := fmt.Sprintf("Generated %s by %s",
+		p.meta.GeneratedAt.Format("2006-01-02 15:04:05 MST"), p.meta.GeneratedBy)
+	p.text(pdfMargin, 5, "", 8, line)
+	p.y += 5 + 2
+	if len(p.columns) > 0 {
+		p.tableHeader()
+	}
+}
+
+// finishPage adds the footer and writes the current page to out
+func (p *pdfWriter) finishPage() {
+	p.start()
+	num := len(p.pages) + 1
+	prefix := fmt.Sprintf("Page %d of ", num)
+	// the total is not known yet; centre as if it had as many digits as num
+	p.setFont("", 8)
+	width := p.measure.GetStringWidth(prefix + strconv.Itoa(num))
+	x := (pdfPageW - width) / 2
+	baseline := pdfPageH - 10 + 2.5 + 0.3*8/pdfK
+	fmt.Fprintf(&p.page, "BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET\n", x*pdfK, (pdfPageH-baseline)*pdfK, pdfEscape(prefix))
+	fmt.Fprintf(&p.page, "q 1 0 0 1 %.2f %.2f cm /NB Do Q\n",
+		(x+p.measure.GetStringWidth(prefix))*pdfK, (pdfPageH-baseline)*pdfK)
+
+	content := p.nextObj
+	page := p.nextObj + 1
+	p.nextObj += 2
+	p.out.object(content, "", p.page.Bytes())
+	p.out.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %d 0 R /Contents %d 0 R >>",
+		pdfPagesObj, pdfPageW*pdfK, pdfPageH*pdfK, pdfResourcesObj, content), nil)
+	p.pages = append(p.pages, page)
+	p.page.Reset()
+}
+
+func (p *pdfWriter) setFont(style string, size float64) {
+	p.measure.SetFont("Helvetica", style, size)
+}
+
+// text writes s left-aligned in a cell of height h at the current line, like
+// fpdf's CellFormat
+func (p *pdfWriter) text(x, h float64, style string, size float64, s string) {
+	font := "F1"
+	if style == "B" {
+		font = "F2"
+	}
+	baseline := p.y + h/2 + 0.3*size/pdfK
+	fmt.Fprintf(&p.page, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, (x+pdfCellMargin)*pdfK, (pdfPageH-baseline)*pdfK, pdfEscape(p.tr(s)))
+}
+
+// cell draws a bordered table cell, filled grey for the column header
+func (p *pdfWriter) cell(x, w float64, s string, header bool) {
+	op := "S"
+	if header {
+		op = "B"
+	}
+	fmt.Fprintf(&p.page, "%.2f %.2f %.2f %.2f re %s\n",
+		x*pdfK, (pdfPageH-p.y-pdfRowHeight)*pdfK, w*pdfK, pdfRowHeight*pdfK, op)
+	style := ""
+	if header {
+		style = "B"
+	}
+	p.setFont(style, pdfFontSize)
+	fmt.Fprintf(&p.page, "0 g\n")
+	p.text(x, pdfRowHeight, style, pdfFontSize, p.fit(s, w))
+	if header {
+		fmt.Fprintf(&p.page, "0.902 g\n")
+	}
+}
+
+func (p *pdfWriter) tableHeader() {
+	fmt.Fprintf(&p.page, "0.902 g 0.2 w\n")
+	x := pdfMargin
+	for i, col := range p.columns {
+		p.cell(x, p.widths[i], col, true)
+		x += p.widths[i]
+	}
+	fmt.Fprintf(&p.page, "0 g\n")
+	p.y += pdfRowHeight
+}
+
+func (p *pdfWriter) WriteHeader(columns []string) error {
+	width := (pdfPageW - 2*pdfMargin) / float64(len(columns))
+	p.columns = columns
+	p.widths = make([]float64, len(columns))
+	for i := range p.widths {
+		p.widths[i] = width
+	}
+	p.addPage()
+	return p.out.err
+}
+
+func (p *pdfWriter) WriteRow(values []string) error {
+	if p.y+pdfRowHeight > pdfBottom {
+		p.addPage()
+	}
+	x := pdfMargin
+	for i, v := range values {
+		if i >= len(p.widths) {
+			break
+		}
+		p.cell(x, p.widths[i], v, false)
+		x += p.widths[i]
+	}
+	p.y += pdfRowHeight
+	return p.out.err
+}
+
+// fit truncates s to the cell width; s is translated to the PDF code page
+// when it is written
+func (p *pdfWriter) fit(s string, width float64) string {
+	max := width - 2*pdfCellMargin
+	if p.measure.GetStringWidth(p.tr(s)) <= max {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && p.measure.GetStringWidth(p.tr(string(r)+"...")) > max {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "..."
+}
+
+func (p *pdfWriter) Close() error {
+	if len(p.pages) == 0 && p.page.Len() == 0 {
+		// Nothing was written; still produce a valid single page document
+		p.addPage()
+	}
+	p.finishPage()
+
+	total := []byte(fmt.Sprintf("BT /F1 8 Tf 0 0 Td (%d) Tj ET", len(p.pages)))
+	p.out.object(pdfPageCountObj, fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 -10 100 20] /Resources << /Font << /F1 %d 0 R >> >>",
+		pdfFontObj), total)
+	kids := make([]string, len(p.pages))
+	for i, n := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", n)
+	}
+	p.out.object(pdfPagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)), nil)
+	p.out.object(pdfCatalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObj), nil)
+
+	xref := p.out.n
+	p.out.printf("xref\n0 %d\n0000000000 65535 f \n", p.nextObj)
+	for num := 1; num < p.nextObj; num++ {
+		p.out.printf("%010d 00000 n \n", p.out.offsets[num])
+	}
+	p.out.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextObj, pdfCatalogObj, xref)
+	return p.out.err
+}
+
+// pdfEscape escapes s for a PDF literal string
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s)
+}
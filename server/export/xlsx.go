@@ -0,0 +1,88 @@
+package export
+
+import (
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxSheet = "Register"
+
+// xlsxWriter uses excelize's stream writer, which spills rows to a temp
+// file instead of holding the whole sheet in memory.
+type xlsxWriter struct {
+	out  io.Writer
+	file *excelize.File
+	sw   *excelize.StreamWriter
+	row  int
+	bold int
+}
+
+func newXLSXWriter(w io.Writer, meta Meta) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", xlsxSheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sw, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	x := &xlsxWriter{out: w, file: f, sw: sw, bold: bold}
+
+	// Register metadata above the table, followed by a blank spacer row
+	preamble := [][]interface{}{
+		{excelize.Cell{StyleID: bold, Value: meta.Title}},
+		{"Entity", meta.EntityLabel()},
+		{"Generated at", meta.GeneratedAt.Format("2006-01-02 15:04:05 MST")},
+		{"Generated by", escapeFormula(meta.GeneratedBy)},
+		{},
+	}
+	for _, values := range preamble {
+		if err := x.writeRow(values); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) WriteHeader(columns []string) error {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = excelize.Cell{StyleID: x.bold, Value: col}
+	}
+	return x.writeRow(values)
+}
+
+func (x *xlsxWriter) WriteRow(values []string) error {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = escapeFormula(v)
+	}
+	return x.writeRow(cells)
+}
+
+func (x *xlsxWriter) writeRow(values []interface{}) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.sw.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
@@ -0,0 +1,266 @@
+// Package apitest boots the full HTTP API against a private in-memory SQLite
+// database for end-to-end tests. Each Server is isolated, needs no network
+// or PostgreSQL, and is torn down when the test ends.
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eurofines-server/auth"
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/mail"
+	"eurofines-server/repository"
+	"eurofines-server/routes"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Entities are the three lab entities every archive record belongs to
+var Entities = []string{"adgyl", "agro", "biopharma"}
+
+// Password is the password of every user created by the fixtures
+const Password = "correct-horse-1"
+
+// Server is the API under test
+type Server struct {
+	t      testing.TB
+	Engine *gin.Engine
+	DB     *gorm.DB
+	Config *config.Config
+	Repos  *repository.Repositories
+	// Mail holds every message the API has sent
+	Mail *mail.Recorder
+	// Auth is the sign-in provider chain; tests may add providers
+	Auth *auth.Authenticator
+
+	tokens map[string]string
+}
+
+// New migrates a fresh database and registers every route on a new engine
+func New(t testing.TB) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	database, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	// expected 404s would otherwise fill the test output with "record not found"
+	database.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if _, err := db.MigrateUp(database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Env = config.EnvTest
+	cfg.DBDriver = config.DriverSQLite
+	cfg.DBPath = ":memory:"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+
+	s := &Server{
+		t:      t,
+		Engine: gin.New(),
+		DB:     database,
+		Config: cfg,
+		Repos:  repository.NewSQLite(database),
+		Mail:   &mail.Recorder{},
+		Auth:   &auth.Authenticator{Providers: []auth.Provider{auth.Local{}}},
+		tokens: map[string]string{},
+	}
+	routes.SetupRoutes(s.Engine, s.Repos, s.Auth, s.Mail, cfg)
+	return s
+}
+
+// Response is a recorded response
+type Response struct {
+	*httptest.ResponseRecorder
+	t testing.TB
+}
+
+// Decode unmarshals the JSON body into v, failing the test if it is not JSON
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("decode response %d %q: %v", r.Code, r.Body.String(), err)
+	}
+}
+
+// JSON returns the body as a generic JSON object
+func (r *Response) JSON() map[string]interface{} {
+	r.t.Helper()
+	var m map[string]interface{}
+	r.Decode(&m)
+	return m
+}
+
+// Expect fails the test unless the response has the given status
+func (r *Response) Expect(status int) *Response {
+	r.t.Helper()
+	if r.Code != status {
+		r.t.Fatalf("status = %d, want %d; body: %s", r.Code, status, r.Body.String())
+	}
+	return r
+}
+
+// Header is an extra request header
+type Header struct {
+	Name, Value string
+}
+
+// Bearer authenticates a request with token
+func Bearer(token string) Header {
+	return Header{"Authorization", "Bearer " + token}
+}
+
+// Do sends a request. body is sent as-is when it is a string or []byte and
+// encoded as JSON otherwise; nil sends no body.
+func (s *Server) Do(method, path string, body interface{}, headers ...Header) *Response {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	case []byte:
+		reader = bytes.NewBuffer(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode request body: %v", err)
+		}
+		reader = bytes.NewBuffer(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, h := range headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+	rec := httptest.NewRecorder()
+	s.Engine.ServeHTTP(rec, req)
+	return &Response{ResponseRecorder: rec, t: s.t}
+}
+
+// CreateUser inserts a user with Password directly, bypassing signup
+func (s *Server) CreateUser(email, role string) *db.User {
+	s.t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatalf("hash password: %v", err)
+	}
+	user := &db.User{Email: email, Password: string(hashed), Role: role, Version: 1}
+	if err := s.Repos.Users.Create(context.Background(), user); err != nil {
+		s.t.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+// Login signs in through the API and returns the access token
+func (s *Server) Login(email string) string {
+	s.t.Helper()
+	var out struct {
+		Token string `json:"token"`
+	}
+	s.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": email, "password": Password}).
+		Expect(http.StatusOK).Decode(&out)
+	return out.Token
+}
+
+// AdminToken returns a token for admin@example.com, creating the user once
+func (s *Server) AdminToken() string {
+	return s.roleToken("admin@example.com", "admin")
+}
+
+// UserToken returns a token for user@example.com, creating the user once
+func (s *Server) UserToken() string {
+	return s.roleToken("user@example.com", "user")
+}
+
+func (s *Server) roleToken(email, role string) string {
+	s.t.Helper()
+	if tok, ok := s.tokens[email]; ok {
+		return tok
+	}
+	s.CreateUser(email, role)
+	s.tokens[email] = s.Login(email)
+	return s.tokens[email]
+}
+
+// Fixtures are archive records created through the API, keyed by entity
+type Fixtures struct {
+	TestItems    map[string]*db.TestItem
+	Studies      map[string]*db.Study
+	FacilityDocs map[string]*db.FacilityDoc
+}
+
+// Seed creates one test item, study and facility doc for every entity, as
+// the admin
+func (s *Server) Seed() *Fixtures {
+	s.t.Helper()
+	f := &Fixtures{
+		TestItems:    map[string]*db.TestItem{},
+		Studies:      map[string]*db.Study{},
+		FacilityDocs: map[string]*db.FacilityDoc{},
+	}
+	admin := Bearer(s.AdminToken())
+	for i, entity := range Entities {
+		var ti struct {
+			TestItem *db.TestItem `json:"test_item"`
+		}
+		s.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+			"test_item_name":  fmt.Sprintf("%s reference standard", entity),
+			"test_item_code":  fmt.Sprintf("TI-%03d", i+1),
+			"company_name":    "Acme Pharma",
+			"date_of_receipt": "2024-01-15",
+			"expiry_date":     "2026-01-15",
+			"entity":          entity,
+		}, admin).Expect(http.StatusCreated).Decode(&ti)
+		f.TestItems[entity] = ti.TestItem
+
+		var st struct {
+			Study *db.Study `json:"study"`
+		}
+		s.Do(http.MethodPost, "/api/studies", map[string]interface{}{
+			"study_number":    fmt.Sprintf("ST-%s-%03d", entity, i+1),
+			"study_code":      fmt.Sprintf("SC-%03d", i+1),
+			"sd_or_pi_name":   "Dr. Rao",
+			"date_of_receipt": "2024-02-01",
+			"entity":          entity,
+		}, admin).Expect(http.StatusCreated).Decode(&st)
+		f.Studies[entity] = st.Study
+
+		var fd struct {
+			FacilityDoc *db.FacilityDoc `json:"facility_doc"`
+		}
+		s.Do(http.MethodPost, "/api/facility-docs", map[string]interface{}{
+			"dept_section":      "QA",
+			"date":              "2024-03-10",
+			"particulars":       fmt.Sprintf("%s calibration log", entity),
+			"total_no_of_pages": 12,
+			"submitted_by":      "A. Kumar",
+			"entity":            entity,
+		}, admin).Expect(http.StatusCreated).Decode(&fd)
+		f.FacilityDocs[entity] = fd.FacilityDoc
+	}
+	return f
+}
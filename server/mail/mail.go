@@ -0,0 +1,82 @@
+// Package mail sends the server's outgoing email: password reset links and
+// similar notices. Handlers depend on the Mailer interface so tests can
+// record messages instead of sending them.
+package mail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"eurofines-server/config"
+)
+
+// ErrNotConfigured is returned by the mailer used when no SMTP server is set
+// outside development
+var ErrNotConfigured = errors.New("outgoing mail is not configured")
+
+// Message is a plain-text email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer when smtp_host is set. Without it, development
+// servers log messages so links can be copied from the console, and other
+// environments refuse to send.
+func New(cfg *config.Config) Mailer {
+	switch {
+	case cfg.SMTPHost != "":
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case cfg.IsDevelopment():
+		return logMailer{}
+	default:
+		return disabledMailer{}
+	}
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("📧 mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type disabledMailer struct{}
+
+func (disabledMailer) Send(context.Context, Message) error {
+	return ErrNotConfigured
+}
+
+// Recorder keeps sent messages in memory, for tests
+type Recorder struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (r *Recorder) Send(_ context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (r *Recorder) Messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.messages...)
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
+	"eurofines-server/admin"
+	"eurofines-server/auth"
 	"eurofines-server/config"
 	"eurofines-server/db"
+	"eurofines-server/mail"
+	"eurofines-server/repository"
 	"eurofines-server/routes"
 
 	"github.com/gin-contrib/cors"
@@ -21,27 +26,37 @@ func main() {
 		}
 	}
 
-	// Load configuration
-	cfg := config.LoadConfig()
+	// Load configuration once: defaults < config file < env < flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration: %v", err)
+	}
 
-	// Default port
-	if cfg.Port == "" {
-		cfg.Port = "3001"
-		log.Printf("ℹ️  Using default port: 3001")
+	// ✅ Connect to PostgreSQL (or SQLite) using GORM
+	database, err := db.ConnectDatabase(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
 
-	// ✅ Connect to PostgreSQL using GORM
-	db.ConnectDatabase()
+	// `eurofines-server [flags] migrate ...` manages the schema and exits
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(admin.Migrate(database, "eurofines-server", args[1:], os.Stdout, os.Stderr))
+	}
+
+	// Refuse to serve against a schema this build was not written for
+	if err := db.CheckSchema(database); err != nil {
+		log.Fatalf("❌ %v (run `eurofines-server migrate up`, or deploy the matching build)", err)
+	}
 
 	// --- Gin HTTP server ---
 	r := gin.Default()
 
 	// CORS setup
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173"},
+		AllowOrigins:     cfg.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "Accept", "If-Match", "If-None-Match", "X-Access-Purpose"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -50,15 +65,19 @@ func main() {
 		c.JSON(200, gin.H{
 			"status": "ok",
 			"db":     "connected",
+			"driver": cfg.DBDriver,
 			"name":   cfg.DBName,
 		})
 	})
 
-	// Initialize routes (you’ll add them later)
-	routes.SetupRoutes(r, db.DB)
+	// Initialize routes
+	authenticator, err := auth.New(cfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	routes.SetupRoutes(r, repository.New(database), authenticator, mail.New(cfg), cfg)
 
 	addr := fmt.Sprintf(":%s", cfg.Port)
-	log.Printf("✅ Connected to PostgreSQL (%s)", cfg.DBName)
 	log.Printf("🚀 Server listening on %s", addr)
 
 	if err := r.Run(addr); err != nil {
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessPurposeHeader states why an archive record is read, for the access log
+const AccessPurposeHeader = "X-Access-Purpose"
+
+// AccessPurpose stores the purpose a request gives for reading archive
+// records, from the X-Access-Purpose header or ?purpose=, as
+// "access_purpose". While required reports true, requests without one are
+// refused.
+func AccessPurpose(required func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		purpose := strings.TrimSpace(c.GetHeader(AccessPurposeHeader))
+		if purpose == "" {
+			purpose = strings.TrimSpace(c.Query("purpose"))
+		}
+		if purpose == "" && required() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "state the purpose of this access in the " + AccessPurposeHeader + " header or ?purpose="})
+			c.Abort()
+			return
+		}
+		c.Set("access_purpose", purpose)
+		c.Next()
+	}
+}
@@ -1,16 +1,49 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"eurofines-server/db"
+	"eurofines-server/repository"
 	"eurofines-server/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware requires a valid, unrevoked bearer token issued by tokens
+// for an account that still exists and is neither disabled nor awaiting
+// approval. The role and permissions are read from the account rather than
+// the token, so role changes and deactivation take effect on the next
+// request. Users who must change their password, or whose local password is
+// older than passwordMaxAge (zero for no expiry), are refused until they
+// have changed it.
+func AuthMiddleware(tokens *utils.TokenManager, users repository.UserRepository, passwordMaxAge time.Duration) gin.HandlerFunc {
+	policy := utils.PasswordPolicy{MaxAge: passwordMaxAge}
+	return authenticate(tokens, users, func(user *db.User) bool {
+		return user.HasLocalPassword() && (user.MustChangePassword || policy.Expired(user.PasswordSetAt(), time.Now()))
+	})
+}
+
+// PasswordChangeMiddleware authenticates like AuthMiddleware but also lets
+// through users who must change their password, for the routes that let
+// them do so
+func PasswordChangeMiddleware(tokens *utils.TokenManager, users repository.UserRepository) gin.HandlerFunc {
+	return authenticate(tokens, users, func(*db.User) bool { return false })
+}
+
+// authenticate builds the auth middleware; mustChangePassword reports users
+// who may not proceed until they change their password
+func authenticate(tokens *utils.TokenManager, users repository.UserRepository, mustChangePassword func(*db.User) bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// already authenticated by APIKeyMiddleware on a route that accepts keys
+		if c.GetUint("api_key_id") != 0 {
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -27,31 +60,210 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		claims, err := utils.ValidateToken(token)
+		claims, err := tokens.ValidateToken(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		user, err := users.FindByID(c.Request.Context(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			c.Abort()
+			return
+		}
+		if user.DisabledAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+		if user.PendingApproval {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is pending approval"})
+			c.Abort()
+			return
+		}
+		if mustChangePassword(user) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "password_change_required": true})
+			c.Abort()
+			return
+		}
+
+		grants, err := users.Grants(c.Request.Context(), user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		c.Set("user_id", user.ID)
+		c.Set("user_email", user.Email)
+		c.Set("user_role", user.Role)
+		c.Set("user_sponsor", user.Sponsor)
+		c.Set("grants", grants)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_id", claims.ID)
+		c.Set("mfa_verified", claims.MFA)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
+
+		c.Next()
+	}
+}
+
+// APIKeyMiddleware accepts API keys on routes that machine integrations
+// may call: a key must be usable and grant scope, and the request is then
+// limited to the key's entity. Requests without a key pass through
+// unchanged, so public routes stay public and AuthMiddleware after it still
+// checks user tokens; routes without it refuse keys as invalid tokens.
+func APIKeyMiddleware(keys repository.APIKeyRepository, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || !utils.IsAPIKey(token) {
+			c.Next()
+			return
+		}
+
+		key, err := keys.Authenticate(c.Request.Context(), utils.HashToken(token), c.ClientIP())
+		if err != nil {
+			if errors.Is(err, repository.ErrAPIKeyInvalid) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			c.Abort()
+			return
+		}
+		if !key.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+			c.Abort()
+			return
+		}
 
+		c.Set("api_key_id", key.ID)
+		c.Set("api_key_entity", key.Entity)
+		// recorded as the actor in the audit log and version history
+		c.Set("user_email", "api-key:"+key.Name)
 		c.Next()
 	}
 }
 
-func AdminOnly() gin.HandlerFunc {
+// MFARequirement reports whether the authenticated user must have passed a
+// second factor in this session
+type MFARequirement func(c *gin.Context) (bool, error)
+
+// RequirePermission lets through users who hold perm in at least one
+// entity. If they hold it only in some, those are stored as
+// "permitted_entities" (and perm as "permission") for the handler to limit
+// the request to. Requests
+// made with an API key were checked against the key's scope instead.
+func RequirePermission(perm string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("user_role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		if c.GetUint("api_key_id") != 0 {
+			c.Next()
+			return
+		}
+		grants, _ := c.Get("grants")
+		g, _ := grants.(db.Grants)
+		entities, all := g.Entities(perm)
+		if !all && len(entities) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + perm, "permission": perm})
 			c.Abort()
 			return
 		}
+		if !all {
+			c.Set("permission", perm)
+			c.Set("permitted_entities", entities)
+		}
 		c.Next()
 	}
 }
 
+// RequireOwnPermission is RequirePermission for routes that also serve
+// users who hold own, which limits them to the studies they direct. Where
+// they hold own but not perm, those entities are stored as "own_entities"
+// ("*" for every entity) and the personnel entry linked to the user as
+// "director_id", zero if there is none.
+func RequireOwnPermission(perm, own string, people repository.PersonnelRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("api_key_id") != 0 {
+			c.Next()
+			return
+		}
+		grants, _ := c.Get("grants")
+		g, _ := grants.(db.Grants)
+		entities, all := g.Entities(perm)
+		if all {
+			c.Next()
+			return
+		}
+		mine, allMine := g.Entities(own)
+		if len(entities) == 0 && len(mine) == 0 && !allMine {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + perm, "permission": perm})
+			c.Abort()
+			return
+		}
+		c.Set("permission", perm)
+		c.Set("permitted_entities", append([]string{}, entities...))
+		if allMine {
+			mine = []string{db.AllEntities}
+		}
+		if len(mine) > 0 {
+			var directorID uint
+			person, err := people.FindByUser(c.Request.Context(), c.GetUint("user_id"))
+			switch {
+			case err == nil:
+				directorID = person.ID
+			case !errors.Is(err, repository.ErrNotFound):
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			c.Set("own_entities", mine)
+			c.Set("director_id", directorID)
+		}
+		c.Next()
+	}
+}
+
+// SponsorOnly lets through sponsor portal accounts only. Their company is
+// stored as "user_sponsor" by the auth middleware.
+func SponsorOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_sponsor") == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Sponsor account required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireMFA refuses sessions not verified with a second factor when
+// requireMFA says the user needs one
+func RequireMFA(requireMFA MFARequirement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("api_key_id") != 0 || c.GetBool("mfa_verified") {
+			c.Next()
+			return
+		}
+		required, err := requireMFA(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if required {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required", "mfa_required": true})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
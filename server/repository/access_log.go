@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormAccessLog struct {
+	db *gorm.DB
+}
+
+func (r *gormAccessLog) Record(ctx context.Context, entries []db.AccessLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).CreateInBatches(entries, 500).Error
+}
+
+func (r *gormAccessLog) List(ctx context.Context, filter AccessLogFilter) ([]db.AccessLog, error) {
+	q := r.db.WithContext(ctx).Scopes(scopeFilter(ListFilter{Entity: filter.Entity, Entities: filter.Entities}))
+	if filter.RecordType != "" {
+		q = q.Where("record_type = ?", filter.RecordType)
+	}
+	if filter.RecordID != 0 {
+		q = q.Where("record_id = ?", filter.RecordID)
+	}
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", *filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	entries := []db.AccessLog{}
+	err := q.Order("created_at desc, id desc").Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyUseInterval limits how often last_used_at is written for a busy key
+const apiKeyUseInterval = time.Minute
+
+type gormAPIKeys struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeys) Create(ctx context.Context, key *db.APIKey, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s (%s; %s) until %s", key.Name, key.Entity, key.Scopes, key.ExpiresAt.Format(time.RFC3339))
+		return db.WriteAudit(tx, apiKeyAudit(actor, db.AuditAPIKeyCreate, key.ID, details))
+	})
+}
+
+func (r *gormAPIKeys) Get(ctx context.Context, id uint) (*db.APIKey, error) {
+	var key db.APIKey
+	if err := r.db.WithContext(ctx).First(&key, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeys) List(ctx context.Context) ([]db.APIKey, error) {
+	keys := []db.APIKey{}
+	err := r.db.WithContext(ctx).Order("created_at desc, id desc").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeys) Revoke(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var key db.APIKey
+		if err := tx.First(&key, id).Error; err != nil {
+			return notFound(err)
+		}
+		res := tx.Model(&db.APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAPIKeyRevoked
+		}
+		return db.WriteAudit(tx, apiKeyAudit(actor, db.AuditAPIKeyRevoke, id, key.Name))
+	})
+}
+
+func (r *gormAPIKeys) Authenticate(ctx context.Context, keyHash, ip string) (*db.APIKey, error) {
+	var key db.APIKey
+	err := r.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.Status(now) != db.APIKeyActive {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUseInterval || key.LastUsedIP != ip {
+		err := r.db.WithContext(ctx).Model(&db.APIKey{}).Where("id = ?", key.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt, key.LastUsedIP = &now, ip
+	}
+	return &key, nil
+}
+
+func apiKeyAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypeAPIKey
+	return entry
+}
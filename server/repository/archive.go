@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+// archiveModel is satisfied by *db.TestItem, *db.Study and *db.FacilityDoc
+type archiveModel[T any] interface {
+	*T
+	db.Retainable
+	db.Versioned
+	RecordID() uint
+}
+
+// gormArchive implements ArchiveRepository for any archive model. It only
+// uses SQL that PostgreSQL and SQLite share.
+type gormArchive[T any, PT archiveModel[T]] struct {
+	db         *gorm.DB
+	recordType string
+}
+
+func scopeFilter(f ListFilter) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		if f.Entity != "" {
+			q = q.Where("entity = ?", f.Entity)
+		}
+		if f.DirectorID != nil {
+			directed := q.Session(&gorm.Session{NewDB: true}).Where("study_director_id = ?", *f.DirectorID)
+			if len(f.DirectorEntities) > 0 {
+				directed = directed.Where("entity IN ?", f.DirectorEntities)
+			}
+			if len(f.Entities) > 0 {
+				return q.Where(q.Session(&gorm.Session{NewDB: true}).Where("entity IN ?", f.Entities).Or(directed))
+			}
+			return q.Where(directed)
+		}
+		if len(f.Entities) > 0 {
+			q = q.Where("entity IN ?", f.Entities)
+		}
+		return q
+	}
+}
+
+func (r *gormArchive[T, PT]) List(ctx context.Context, filter ListFilter) ([]T, error) {
+	list := []T{}
+	err := r.db.WithContext(ctx).Scopes(scopeFilter(filter)).Order("created_at desc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormArchive[T, PT]) ListDeleted(ctx context.Context, filter ListFilter) ([]T, error) {
+	list := []T{}
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Scopes(scopeFilter(filter)).
+		Order("deleted_at desc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormArchive[T, PT]) Stream(ctx context.Context, filter ListFilter, fn func(*T) error) error {
+	var model T
+	q := r.db.WithContext(ctx)
+	rows, err := q.Model(&model).Scopes(scopeFilter(filter)).Order("created_at desc").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record T
+		if err := q.ScanRows(rows, &record); err != nil {
+			return err
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportLogBatch is how many records LogExport reads and logs at a time
+const exportLogBatch = 500
+
+func (r *gormArchive[T, PT]) LogExport(ctx context.Context, filter ListFilter, entry db.AccessLog) error {
+	var model T
+	entry.CreatedAt = time.Now()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// read by id in batches, as a cursor held open while writing would
+		// block SQLite's single connection
+		var last uint
+		for {
+			var batch []struct {
+				ID     uint
+				Entity string
+			}
+			err := tx.Model(&model).Scopes(scopeFilter(filter)).Where("id > ?", last).
+				Order("id").Limit(exportLogBatch).Select("id", "entity").Find(&batch).Error
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			entries := make([]db.AccessLog, len(batch))
+			for i, rec := range batch {
+				entries[i] = entry
+				entries[i].RecordID = rec.ID
+				entries[i].Entity = rec.Entity
+			}
+			if err := tx.Create(&entries).Error; err != nil {
+				return err
+			}
+			last = batch[len(batch)-1].ID
+		}
+	})
+}
+
+func (r *gormArchive[T, PT]) Get(ctx context.Context, id uint) (*T, error) {
+	var record T
+	if err := r.db.WithContext(ctx).First(&record, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &record, nil
+}
+
+func (r *gormArchive[T, PT]) Entity(ctx context.Context, id uint) (string, error) {
+	var model T
+	var entities []string
+	err := r.db.WithContext(ctx).Unscoped().Model(&model).Where("id = ?", id).Pluck("entity", &entities).Error
+	if err != nil {
+		return "", err
+	}
+	if len(entities) == 0 {
+		return "", ErrNotFound
+	}
+	return entities[0], nil
+}
+
+func (r *gormArchive[T, PT]) Create(ctx context.Context, record *T, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		return r.saveVersion(tx, actor, PT(record).RecordID(), db.VersionCreate, record, nil)
+	})
+}
+
+func (r *gormArchive[T, PT]) Update(ctx context.Context, id uint, expectedVersion int, updates map[string]interface{}, actor Actor) (*T, error) {
+	var record T
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		before := record
+		updates["version"] = gorm.Expr("version + 1")
+		res := tx.Model(&record).Where("version = ?", expectedVersion).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrStaleVersion
+		}
+		// reload so the version and the caller see the stored state
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		return r.saveVersion(tx, actor, id, db.VersionUpdate, &record, &before)
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &record, nil
+}
+
+func (r *gormArchive[T, PT]) Delete(ctx context.Context, id uint, reason string, actor Actor) error {
+	return notFound(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record T
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		before := record
+		if err := tx.Model(&record).Updates(map[string]interface{}{
+			"deleted_by":      actor.UserID,
+			"deletion_reason": reason,
+			"version":         gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&record).Error; err != nil {
+			return err
+		}
+		if err := db.WriteAudit(tx, r.audit(actor, db.AuditDelete, id, reason)); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().First(&record, id).Error; err != nil {
+			return err
+		}
+		return r.saveVersion(tx, actor, id, db.VersionDelete, &record, &before)
+	}))
+}
+
+func (r *gormArchive[T, PT]) Restore(ctx context.Context, id uint, reason string, actor Actor) (*T, error) {
+	var record T
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&record, id).Error; err != nil {
+			return err
+		}
+		before := record
+		if err := tx.Unscoped().Model(&record).Updates(map[string]interface{}{
+			"deleted_at":      nil,
+			"deleted_by":      nil,
+			"deletion_reason": "",
+			"version":         gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		if err := db.WriteAudit(tx, r.audit(actor, db.AuditRestore, id, reason)); err != nil {
+			return err
+		}
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		return r.saveVersion(tx, actor, id, db.VersionRestore, &record, &before)
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &record, nil
+}
+
+func (r *gormArchive[T, PT]) Purge(ctx context.Context, id uint, reason string, retentionYears int, actor Actor) error {
+	return notFound(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record T
+		if err := tx.Unscoped().First(&record, id).Error; err != nil {
+			return err
+		}
+		var deleted int64
+		if err := tx.Unscoped().Model(&record).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&deleted).Error; err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrNotDeleted
+		}
+		years, err := sponsorRetention(tx, PT(&record), retentionYears)
+		if err != nil {
+			return err
+		}
+		if db.UnderRetention(PT(&record), years, time.Now()) {
+			return UnderRetentionError{Until: db.RetainedUntil(PT(&record), years)}
+		}
+		if err := tx.Unscoped().Delete(&record).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, r.audit(actor, db.AuditPurge, id, reason))
+	}))
+}
+
+func (r *gormArchive[T, PT]) Versions(ctx context.Context, id uint) ([]db.RecordVersion, error) {
+	versions := []db.RecordVersion{}
+	err := r.db.WithContext(ctx).Where("record_type = ? AND record_id = ?", r.recordType, id).
+		Order("version asc").Find(&versions).Error
+	return versions, err
+}
+
+func (r *gormArchive[T, PT]) Version(ctx context.Context, id uint, n int) (*db.RecordVersion, error) {
+	var v db.RecordVersion
+	err := r.db.WithContext(ctx).Where("record_type = ? AND record_id = ? AND version = ?", r.recordType, id, n).
+		First(&v).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &v, nil
+}
+
+func (r *gormArchive[T, PT]) VersionAt(ctx context.Context, id uint, at time.Time) (*db.RecordVersion, error) {
+	var v db.RecordVersion
+	err := r.db.WithContext(ctx).Where("record_type = ? AND record_id = ? AND created_at <= ?", r.recordType, id, at).
+		Order("version desc").First(&v).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &v, nil
+}
+
+func (r *gormArchive[T, PT]) LatestVersion(ctx context.Context, id uint) (int, error) {
+	var latest int
+	err := r.db.WithContext(ctx).Model(&db.RecordVersion{}).
+		Where("record_type = ? AND record_id = ?", r.recordType, id).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error
+	return latest, err
+}
+
+// saveVersion records the state of a record after a save, attributed to actor
+func (r *gormArchive[T, PT]) saveVersion(tx *gorm.DB, actor Actor, id uint, action string, record, before *T) error {
+	in := db.VersionInput{
+		RecordType:     r.recordType,
+		RecordID:       id,
+		Action:         action,
+		Record:         record,
+		ChangedBy:      actor.UserID,
+		ChangedByEmail: actor.Email,
+	}
+	// a typed nil would make SaveVersion store a "null" baseline
+	if before != nil {
+		in.Before = before
+	}
+	_, err := db.SaveVersion(tx, in)
+	return err
+}
+
+// updateTx applies changes to record within tx whatever its version, and
+// deleted or not, saving a version. It is for changes the archive makes on
+// its own account rather than edits a user made to what they read.
+func (r *gormArchive[T, PT]) updateTx(tx *gorm.DB, actor Actor, record *T, changes map[string]interface{}) error {
+	before := *record
+	id := PT(record).RecordID()
+	changes["version"] = gorm.Expr("version + 1")
+	if err := tx.Unscoped().Model(new(T)).Where("id = ?", id).Updates(changes).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().First(record, id).Error; err != nil {
+		return err
+	}
+	return r.saveVersion(tx, actor, id, db.VersionUpdate, record, &before)
+}
+
+func (r *gormArchive[T, PT]) audit(actor Actor, action string, id uint, details string) db.AuditLog {
+	return db.AuditLog{
+		UserID:     actor.UserID,
+		UserEmail:  actor.Email,
+		Action:     action,
+		RecordType: r.recordType,
+		RecordID:   id,
+		Details:    details,
+		IPAddress:  actor.IP,
+	}
+}
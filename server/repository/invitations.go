@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormInvitations struct {
+	db *gorm.DB
+}
+
+func (r *gormInvitations) Create(ctx context.Context, inv *db.Invitation, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(inv).Error; err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s (%s) until %s", inv.Email, inv.Entity, inv.ExpiresAt.Format(time.RFC3339))
+		return db.WriteAudit(tx, invitationAudit(actor, db.AuditInviteCreate, inv.ID, details))
+	})
+}
+
+func (r *gormInvitations) Get(ctx context.Context, id uint) (*db.Invitation, error) {
+	var inv db.Invitation
+	if err := r.db.WithContext(ctx).First(&inv, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &inv, nil
+}
+
+func (r *gormInvitations) List(ctx context.Context) ([]db.Invitation, error) {
+	invitations := []db.Invitation{}
+	err := r.db.WithContext(ctx).Order("created_at desc, id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *gormInvitations) Revoke(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var inv db.Invitation
+		if err := tx.First(&inv, id).Error; err != nil {
+			return notFound(err)
+		}
+		res := tx.Model(&db.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvitationUnusable
+		}
+		return db.WriteAudit(tx, invitationAudit(actor, db.AuditInviteRevoke, id, inv.Email))
+	})
+}
+
+func (r *gormInvitations) Accept(ctx context.Context, tokenHash string, user *db.User, actor Actor) (*db.Invitation, error) {
+	var inv db.Invitation
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", tokenHash).First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvitationUnusable
+			}
+			return err
+		}
+		now := time.Now()
+		if !inv.Usable(now) {
+			return ErrInvitationUnusable
+		}
+		if !strings.EqualFold(strings.TrimSpace(inv.Email), strings.TrimSpace(user.Email)) {
+			return ErrInvitationEmail
+		}
+
+		if err := registerTx(tx, user, inv.Entity, actor, fmt.Sprintf("invitation %d", inv.ID)); err != nil {
+			return err
+		}
+		// the conditional update makes a token redeemable once even under concurrent signups
+		res := tx.Model(&db.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", inv.ID).
+			Updates(map[string]interface{}{"accepted_at": now, "accepted_by": user.ID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvitationUnusable
+		}
+		inv.AcceptedAt, inv.AcceptedBy = &now, &user.ID
+		return db.WriteAudit(tx, invitationAudit(actor, db.AuditInviteAccept, inv.ID, user.Email))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func invitationAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypeInvitation
+	return entry
+}
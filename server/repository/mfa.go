@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormMFA struct {
+	db *gorm.DB
+}
+
+func (r *gormMFA) StartEnrollment(ctx context.Context, id uint, secret string) error {
+	res := r.db.WithContext(ctx).Model(&db.User{}).Where("id = ? AND mfa_enabled_at IS NULL", id).
+		Update("mfa_secret", secret)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMFAEnabled
+	}
+	return nil
+}
+
+func (r *gormMFA) Enable(ctx context.Context, id uint, step int64, codeHashes []string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&db.User{}).Where("id = ? AND mfa_enabled_at IS NULL AND mfa_secret <> ''", id).
+			Updates(map[string]interface{}{"mfa_enabled_at": time.Now(), "mfa_last_step": step})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrMFANotEnrolled
+		}
+		if err := replaceCodesTx(tx, id, codeHashes); err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditMFAEnable, id, ""))
+	})
+}
+
+func (r *gormMFA) Disable(ctx context.Context, id uint, actor Actor) error {
+	action := db.AuditMFAReset
+	if actor.UserID != nil && *actor.UserID == id {
+		action = db.AuditMFADisable
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&db.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		changes := map[string]interface{}{"mfa_secret": "", "mfa_enabled_at": nil, "mfa_last_step": 0}
+		return updateUserTx(tx, id, changes, userAudit(actor, action, id, ""))
+	})
+}
+
+func (r *gormMFA) UseStep(ctx context.Context, id uint, step int64) error {
+	res := r.db.WithContext(ctx).Model(&db.User{}).Where("id = ? AND mfa_last_step < ?", id, step).
+		Update("mfa_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMFACodeInvalid
+	}
+	return nil
+}
+
+func (r *gormMFA) UseRecoveryCode(ctx context.Context, id uint, codeHash string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&db.RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", id, codeHash).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrMFACodeInvalid
+		}
+		var left int64
+		if err := tx.Model(&db.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", id).Count(&left).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditRecoveryUsed, id, fmt.Sprintf("%d codes left", left)))
+	})
+}
+
+func (r *gormMFA) ReplaceRecoveryCodes(ctx context.Context, id uint, codeHashes []string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := replaceCodesTx(tx, id, codeHashes); err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditRecoveryCodes, id, ""))
+	})
+}
+
+func (r *gormMFA) RecoveryCodesLeft(ctx context.Context, id uint) (int64, error) {
+	var left int64
+	err := r.db.WithContext(ctx).Model(&db.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", id).Count(&left).Error
+	return left, err
+}
+
+func replaceCodesTx(tx *gorm.DB, id uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", id).Delete(&db.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	codes := make([]db.RecoveryCode, len(codeHashes))
+	for i, h := range codeHashes {
+		codes[i] = db.RecoveryCode{UserID: id, CodeHash: h, CreatedAt: now}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
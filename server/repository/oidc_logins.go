@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormOIDCLogins struct {
+	db *gorm.DB
+}
+
+func (r *gormOIDCLogins) Create(ctx context.Context, login *db.OIDCLogin) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// abandoned attempts are never taken
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&db.OIDCLogin{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(login).Error
+	})
+}
+
+func (r *gormOIDCLogins) Take(ctx context.Context, stateHash string) (*db.OIDCLogin, error) {
+	var login db.OIDCLogin
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("state_hash = ?", stateHash).First(&login).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOIDCStateInvalid
+		}
+		if err != nil {
+			return err
+		}
+		// a concurrent callback with the same state deletes nothing
+		res := tx.Delete(&db.OIDCLogin{}, login.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || !time.Now().Before(login.ExpiresAt) {
+			return ErrOIDCStateInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
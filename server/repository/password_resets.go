@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormPasswordResets struct {
+	db *gorm.DB
+}
+
+func (r *gormPasswordResets) Create(ctx context.Context, reset *db.PasswordReset, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// only the newest link works
+		err := tx.Where("user_id = ? AND used_at IS NULL", reset.UserID).Delete(&db.PasswordReset{}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(reset).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditForgotPassword, reset.UserID, ""))
+	})
+}
+
+func (r *gormPasswordResets) Lookup(ctx context.Context, tokenHash string) (*db.PasswordReset, error) {
+	return lookupReset(r.db.WithContext(ctx), tokenHash)
+}
+
+func lookupReset(tx *gorm.DB, tokenHash string) (*db.PasswordReset, error) {
+	var reset db.PasswordReset
+	err := tx.Where("token_hash = ?", tokenHash).First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrResetInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reset.UsedAt != nil || !time.Now().Before(reset.ExpiresAt) {
+		return nil, ErrResetInvalid
+	}
+	return &reset, nil
+}
+
+func (r *gormPasswordResets) Redeem(ctx context.Context, tokenHash, passwordHash string, opts PasswordUpdate, actor Actor) (*db.PasswordReset, error) {
+	var reset *db.PasswordReset
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if reset, err = lookupReset(tx, tokenHash); err != nil {
+			return err
+		}
+		now := time.Now()
+		res := tx.Model(&db.PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrResetInvalid
+		}
+		reset.UsedAt = &now
+
+		// whoever knew the old password is signed out, and the owner may sign in again
+		if actor.UserID == nil {
+			actor.UserID = &reset.UserID
+		}
+		err = setPasswordTx(tx, reset.UserID, passwordHash, opts, userAudit(actor, db.AuditResetByEmail, reset.UserID, ""))
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&db.User{}).Where("id = ?", reset.UserID).
+			Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&db.Session{}).Where("user_id = ? AND revoked_at IS NULL", reset.UserID).
+			Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": RevokeReset}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormPersonnel struct {
+	db *gorm.DB
+}
+
+func (r *gormPersonnel) List(ctx context.Context, filter PersonnelFilter) ([]db.Person, error) {
+	q := r.db.WithContext(ctx)
+	if query := strings.TrimSpace(filter.Query); query != "" {
+		q = q.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(query)+"%")
+	}
+	if filter.Role != "" {
+		// roles is a comma separated list
+		q = q.Where("(',' || roles || ',') LIKE ?", "%,"+filter.Role+",%")
+	}
+	people := []db.Person{}
+	err := q.Order("LOWER(name) asc, id asc").Find(&people).Error
+	return people, err
+}
+
+func (r *gormPersonnel) Get(ctx context.Context, id uint) (*db.Person, error) {
+	var person db.Person
+	if err := r.db.WithContext(ctx).First(&person, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &person, nil
+}
+
+func (r *gormPersonnel) FindByUser(ctx context.Context, userID uint) (*db.Person, error) {
+	var person db.Person
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&person).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &person, nil
+}
+
+// userLinked reports whether a person other than id is linked to userID
+func userLinked(tx *gorm.DB, userID *uint, id uint) (bool, error) {
+	if userID == nil {
+		return false, nil
+	}
+	var count int64
+	err := tx.Model(&db.Person{}).Where("user_id = ? AND id <> ?", *userID, id).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormPersonnel) Create(ctx context.Context, person *db.Person, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		linked, err := userLinked(tx, person.UserID, 0)
+		if err != nil {
+			return err
+		}
+		if linked {
+			return ErrPersonUserLinked
+		}
+		if err := tx.Create(person).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, personAudit(actor, db.AuditPersonCreate, person.ID, person.Name+": "+person.Roles))
+	})
+}
+
+func (r *gormPersonnel) Update(ctx context.Context, person *db.Person, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current db.Person
+		if err := tx.First(&current, person.ID).Error; err != nil {
+			return notFound(err)
+		}
+		linked, err := userLinked(tx, person.UserID, person.ID)
+		if err != nil {
+			return err
+		}
+		if linked {
+			return ErrPersonUserLinked
+		}
+		person.CreatedAt = current.CreatedAt
+		if err := tx.Save(person).Error; err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s: %s -> %s", person.Name, current.Roles, person.Roles)
+		return db.WriteAudit(tx, personAudit(actor, db.AuditPersonUpdate, person.ID, details))
+	})
+}
+
+func (r *gormPersonnel) Delete(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var person db.Person
+		if err := tx.First(&person, id).Error; err != nil {
+			return notFound(err)
+		}
+		for _, ref := range []struct {
+			model  interface{}
+			column string
+		}{
+			{&db.Study{}, "study_director_id"},
+			{&db.TestItem{}, "archived_by_id"},
+			{&db.FacilityDoc{}, "submitted_by_id"},
+		} {
+			var count int64
+			if err := tx.Unscoped().Model(ref.model).Where(ref.column+" = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrPersonInUse
+			}
+		}
+		if err := tx.Delete(&person).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, personAudit(actor, db.AuditPersonDelete, id, person.Name))
+	})
+}
+
+func (r *gormPersonnel) Studies(ctx context.Context, id uint, filter ListFilter) ([]db.Study, error) {
+	studies := []db.Study{}
+	err := r.db.WithContext(ctx).Scopes(scopeFilter(filter)).Where("study_director_id = ?", id).
+		Order("created_at desc").Find(&studies).Error
+	return studies, err
+}
+
+func (r *gormPersonnel) Archived(ctx context.Context, id uint, filter ListFilter) ([]db.TestItem, error) {
+	items := []db.TestItem{}
+	err := r.db.WithContext(ctx).Scopes(scopeFilter(filter)).Where("archived_by_id = ?", id).
+		Order("created_at desc").Find(&items).Error
+	return items, err
+}
+
+func personAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypePerson
+	return entry
+}
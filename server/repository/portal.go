@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+// companyMatch compares company_name with companyKey of a sponsor's company
+const companyMatch = "LOWER(TRIM(company_name)) = ?"
+
+func companyKey(company string) string {
+	return strings.ToLower(strings.TrimSpace(company))
+}
+
+type gormPortal struct {
+	db *gorm.DB
+}
+
+// sponsorIDs selects the sponsor records named like company
+func (r *gormPortal) sponsorIDs(company string) *gorm.DB {
+	return r.db.Model(&db.Sponsor{}).Select("id").Where(sponsorNameMatch, companyKey(company))
+}
+
+// ofCompany narrows q to the company's test items, by company name or sponsor
+func (r *gormPortal) ofCompany(q *gorm.DB, company string) *gorm.DB {
+	return q.Where("("+companyMatch+" OR sponsor_id IN (?))", companyKey(company), r.sponsorIDs(company))
+}
+
+func (r *gormPortal) items(ctx context.Context, company string) *gorm.DB {
+	return r.ofCompany(r.db.WithContext(ctx), company)
+}
+
+// studies selects the studies assigned to the company's sponsor record and,
+// among studies without one, those whose test item code is only used by the
+// company's test items in the study's entity. Codes are not unique across
+// companies, so a code another company also uses matches neither.
+func (r *gormPortal) studies(ctx context.Context, company string) *gorm.DB {
+	sameCode := func() *gorm.DB {
+		return r.db.Table("test_items AS ti").Select("1").
+			Where("ti.test_item_code = studies.test_item_code AND ti.entity = studies.entity AND ti.deleted_at IS NULL")
+	}
+	const itemOfCompany = "(LOWER(TRIM(COALESCE(ti.company_name, ''))) = ? OR COALESCE(ti.sponsor_id, 0) IN (?))"
+	ours := sameCode().Where(itemOfCompany, companyKey(company), r.sponsorIDs(company))
+	theirs := sameCode().Where("NOT "+itemOfCompany, companyKey(company), r.sponsorIDs(company))
+	return r.db.WithContext(ctx).Where(`(sponsor_id IN (?) OR
+		(sponsor_id IS NULL AND test_item_code <> '' AND EXISTS (?) AND NOT EXISTS (?)))`,
+		r.sponsorIDs(company), ours, theirs)
+}
+
+func (r *gormPortal) TestItems(ctx context.Context, company string) ([]db.TestItem, error) {
+	list := []db.TestItem{}
+	err := r.items(ctx, company).Order("created_at desc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormPortal) TestItem(ctx context.Context, company string, id uint) (*db.TestItem, error) {
+	var item db.TestItem
+	if err := r.items(ctx, company).First(&item, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &item, nil
+}
+
+func (r *gormPortal) Studies(ctx context.Context, company string) ([]db.Study, error) {
+	list := []db.Study{}
+	err := r.studies(ctx, company).Order("created_at desc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormPortal) Study(ctx context.Context, company string, id uint) (*db.Study, error) {
+	var study db.Study
+	if err := r.studies(ctx, company).First(&study, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &study, nil
+}
+
+type gormDisposals struct {
+	db    *gorm.DB
+	items *gormArchive[db.TestItem, *db.TestItem]
+}
+
+func (r *gormDisposals) Create(ctx context.Context, req *db.DisposalRequest, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var item db.TestItem
+		if err := tx.First(&item, req.TestItemID).Error; err != nil {
+			return notFound(err)
+		}
+		var pending int64
+		err := tx.Model(&db.DisposalRequest{}).Where("test_item_id = ? AND approved_at IS NULL", item.ID).Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrDisposalPending
+		}
+		req.Entity, req.CompanyName = item.Entity, strings.TrimSpace(item.CompanyName)
+		if err := tx.Create(req).Error; err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s test item %d for %s", req.Action, item.ID, req.CompanyName)
+		return db.WriteAudit(tx, disposalAudit(actor, db.AuditDisposalRequest, req.ID, details))
+	})
+}
+
+func (r *gormDisposals) List(ctx context.Context, filter DisposalFilter) ([]db.DisposalRequest, error) {
+	q := r.db.WithContext(ctx)
+	if filter.Company != "" {
+		q = q.Where(companyMatch, companyKey(filter.Company))
+	}
+	if len(filter.Entities) > 0 {
+		q = q.Where("entity IN ?", filter.Entities)
+	}
+	switch filter.Status {
+	case db.DisposalPending:
+		q = q.Where("approved_at IS NULL")
+	case db.DisposalApproved:
+		q = q.Where("approved_at IS NOT NULL")
+	}
+	list := []db.DisposalRequest{}
+	err := q.Order("created_at desc, id desc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormDisposals) Approve(ctx context.Context, id uint, company, note string, actor Actor) (*db.DisposalRequest, error) {
+	var req db.DisposalRequest
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(companyMatch, companyKey(company)).First(&req, id).Error
+		if err != nil {
+			return notFound(err)
+		}
+		if req.ApprovedAt != nil {
+			return ErrDisposalApproved
+		}
+		now := time.Now()
+		res := tx.Model(&db.DisposalRequest{}).Where("id = ? AND approved_at IS NULL", id).Updates(map[string]interface{}{
+			"approved_at":   now,
+			"approved_by":   actor.UserID,
+			"approval_note": note,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDisposalApproved
+		}
+
+		var item db.TestItem
+		if err := tx.First(&item, req.TestItemID).Error; err != nil {
+			return notFound(err)
+		}
+		approved := db.NewDate(now)
+		if err := r.items.updateTx(tx, actor, &item, map[string]interface{}{"sponsor_approval_date": &approved}); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s test item %d", req.Action, item.ID)
+		if err := db.WriteAudit(tx, disposalAudit(actor, db.AuditDisposalApprove, id, details)); err != nil {
+			return err
+		}
+		return tx.First(&req, id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *gormUsers) SetSponsor(ctx context.Context, id uint, company string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user db.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return notFound(err)
+		}
+		entry := userAudit(actor, db.AuditSponsorChange, id, fmt.Sprintf("%q -> %q", user.Sponsor, company))
+		return updateUserTx(tx, id, map[string]interface{}{"sponsor": company}, entry)
+	})
+}
+
+func disposalAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypeDisposal
+	return entry
+}
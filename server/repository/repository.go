@@ -0,0 +1,556 @@
+// Package repository is the data access layer. Handlers depend on the
+// interfaces here rather than on GORM or a particular database, so the API
+// runs against PostgreSQL in production and SQLite in tests and small sites.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when no (visible) record has the requested id
+	ErrNotFound = errors.New("record not found")
+	// ErrStaleVersion is returned when an update's expected version no longer
+	// matches the stored row, i.e. someone else saved first
+	ErrStaleVersion = errors.New("record was modified by someone else")
+	// ErrNotDeleted is returned when purging a record that is not soft-deleted
+	ErrNotDeleted = errors.New("record must be deleted before it can be purged")
+	// ErrNotPending is returned when approving a user who is not awaiting approval
+	ErrNotPending = errors.New("user is not pending approval")
+	// ErrInvitationUnusable is returned for an invitation token that is unknown,
+	// expired, revoked or already used
+	ErrInvitationUnusable = errors.New("invitation is invalid, expired or already used")
+	// ErrInvitationEmail is returned when an invitation is redeemed for a
+	// different email address than it was issued for
+	ErrInvitationEmail = errors.New("invitation was issued for a different email address")
+	// ErrSessionInvalid is returned for a refresh token that is unknown,
+	// expired or belongs to a revoked session
+	ErrSessionInvalid = errors.New("session is invalid or has expired")
+	// ErrRefreshReused is returned when an already rotated refresh token is
+	// presented again; the session is revoked because the token may be stolen
+	ErrRefreshReused = errors.New("refresh token was already used; session revoked")
+	// ErrResetInvalid is returned for a password reset token that is unknown,
+	// expired or already used
+	ErrResetInvalid = errors.New("reset token is invalid or has expired")
+	// ErrMFAEnabled is returned when enrolling a user who already uses MFA
+	ErrMFAEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming without a pending enrollment
+	ErrMFANotEnrolled = errors.New("two-factor enrollment has not been started")
+	// ErrMFACodeInvalid is returned for a wrong, reused or expired second factor
+	ErrMFACodeInvalid = errors.New("invalid two-factor code")
+	// ErrProviderMismatch is returned when an external provider claims an
+	// account that signs in another way
+	ErrProviderMismatch = errors.New("account belongs to another sign-in provider")
+	// ErrOIDCStateInvalid is returned for a single sign-on callback whose
+	// state is unknown, expired or already used
+	ErrOIDCStateInvalid = errors.New("sign-in attempt is invalid or has expired")
+	// ErrAPIKeyInvalid is returned for an API key that is unknown, expired or revoked
+	ErrAPIKeyInvalid = errors.New("API key is invalid, expired or revoked")
+	// ErrAPIKeyRevoked is returned when revoking a key a second time
+	ErrAPIKeyRevoked = errors.New("API key is already revoked")
+	// ErrRoleExists is returned when creating a role whose name is taken
+	ErrRoleExists = errors.New("a role with this name already exists")
+	// ErrRoleUnknown is returned when assigning a role that does not exist
+	ErrRoleUnknown = errors.New("role does not exist")
+	// ErrRoleBuiltin is returned when deleting a built-in role
+	ErrRoleBuiltin = errors.New("built-in roles cannot be deleted")
+	// ErrRoleInUse is returned when deleting a role that users still hold
+	ErrRoleInUse = errors.New("role is still assigned to users")
+	// ErrDisposalPending is returned when requesting disposal of a test item
+	// that already awaits its sponsor's approval
+	ErrDisposalPending = errors.New("a disposal request for this test item is already pending")
+	// ErrDisposalApproved is returned when approving a request a second time
+	ErrDisposalApproved = errors.New("disposal request is already approved")
+	// ErrSponsorExists is returned when a sponsor name is taken, ignoring case
+	ErrSponsorExists = errors.New("a sponsor with this name already exists")
+	// ErrSponsorInUse is returned when deleting a sponsor that records refer to
+	ErrSponsorInUse = errors.New("sponsor is still referenced by test items or studies")
+	// ErrPersonUserLinked is returned when linking a user that another
+	// person is already linked to
+	ErrPersonUserLinked = errors.New("user is already linked to another person")
+	// ErrPersonInUse is returned when deleting a person that records name
+	ErrPersonInUse = errors.New("person is still named by studies, test items or facility docs")
+)
+
+// UnderRetentionError is returned when a purge is attempted before retention ends
+type UnderRetentionError struct {
+	Until time.Time
+}
+
+func (e UnderRetentionError) Error() string {
+	return fmt.Sprintf("record is under retention until %s and cannot be purged", e.Until.Format("2006-01-02"))
+}
+
+// Record types as stored in the audit log, record_versions and search results
+const (
+	RecordTypeTestItem    = "test_item"
+	RecordTypeStudy       = "study"
+	RecordTypeFacilityDoc = "facility_doc"
+	RecordTypeUser        = "user"
+	RecordTypeInvitation  = "invitation"
+	RecordTypeAPIKey      = "api_key"
+	RecordTypeRole        = "role"
+	RecordTypeDisposal    = "disposal_request"
+	RecordTypeSponsor     = "sponsor"
+	RecordTypePerson      = "person"
+)
+
+// Actor identifies who makes a change, for the audit log and version history
+type Actor struct {
+	UserID *uint
+	Email  string
+	IP     string
+}
+
+// ListFilter holds the filters shared by the list and export endpoints
+type ListFilter struct {
+	Entity string
+	// Entities limits the results to these entities when not empty
+	Entities []string
+	// DirectorID, when set, limits studies to Entities (none when empty)
+	// plus those the person directs in DirectorEntities (every entity when
+	// empty). Zero matches no person.
+	DirectorID       *uint
+	DirectorEntities []string
+}
+
+// User statuses accepted in UserFilter.Status
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusPending  = "pending"
+	UserStatusLocked   = "locked"
+)
+
+// UserFilter narrows a user search; empty fields match everything
+type UserFilter struct {
+	// Query matches part of the email, ignoring case
+	Query  string
+	Role   string
+	Status string
+	Entity string
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	Create(ctx context.Context, user *db.User) error
+	FindByID(ctx context.Context, id uint) (*db.User, error)
+	// FindByEmail matches case-insensitively
+	FindByEmail(ctx context.Context, email string) (*db.User, error)
+	List(ctx context.Context) ([]db.User, error)
+	Search(ctx context.Context, filter UserFilter) ([]db.User, error)
+	// CreateAudited creates the user and records who created it
+	CreateAudited(ctx context.Context, user *db.User, actor Actor) error
+	// SetPassword replaces the password, keeping the old hash in the history.
+	// It is audited as a change when actor is the user, else as a reset.
+	SetPassword(ctx context.Context, id uint, hash string, opts PasswordUpdate, actor Actor) error
+	// RecentPasswords returns the current password hash followed by up to
+	// n-1 previous ones, newest first
+	RecentPasswords(ctx context.Context, id uint, n int) ([]string, error)
+	// SetDisabled disables or re-enables an account
+	SetDisabled(ctx context.Context, id uint, disabled bool, actor Actor) error
+	SetEmail(ctx context.Context, id uint, email string, actor Actor) error
+	SetRole(ctx context.Context, id uint, role string, actor Actor) error
+	// Entities returns the entity memberships of the given users
+	Entities(ctx context.Context, ids ...uint) (map[uint][]string, error)
+	// SetEntities replaces a user's entity memberships
+	SetEntities(ctx context.Context, id uint, entities []string, actor Actor) error
+	// EntityRoles returns the per-entity role assignments of the given users
+	EntityRoles(ctx context.Context, ids ...uint) (map[uint][]db.UserRole, error)
+	// SetEntityRoles replaces a user's role assignments; ErrRoleUnknown if
+	// one names a role that does not exist
+	SetEntityRoles(ctx context.Context, id uint, roles []db.UserRole, actor Actor) error
+	// Grants returns the permissions user holds in each entity: those of
+	// the base role in their member entities (every entity if they belong to
+	// none) plus those of their assigned roles. Sponsor accounts hold none.
+	Grants(ctx context.Context, user *db.User) (db.Grants, error)
+	// SetSponsor makes the account a sponsor portal account of company, or
+	// a staff account again when company is empty
+	SetSponsor(ctx context.Context, id uint, company string, actor Actor) error
+	// Register creates a self-service signup as a member of entity
+	Register(ctx context.Context, user *db.User, entity string, actor Actor) error
+	// Approve lets a pending signup sign in, else returns ErrNotPending
+	Approve(ctx context.Context, id uint, actor Actor) error
+	// Provision creates the account of a user who signed in through an
+	// external provider for the first time, or brings its role and entities
+	// in line with the provider. Changes are audited.
+	Provision(ctx context.Context, account ExternalAccount, actor Actor) (*db.User, error)
+
+	// RecordLogin clears the user's failed sign-ins and logs the sign-in
+	RecordLogin(ctx context.Context, id uint, actor Actor) error
+	// RecordFailedLogin logs a failed sign-in attempted as actor.Email. For a
+	// wrong password the user's counter is raised, locking the account when
+	// policy says so; the lock expiry is returned if this attempt locked it.
+	RecordFailedLogin(ctx context.Context, user *db.User, reason string, policy LockoutPolicy, actor Actor) (*time.Time, error)
+	// FailedLoginsFrom counts failed sign-ins from ip since the given time
+	FailedLoginsFrom(ctx context.Context, ip string, since time.Time) (int64, error)
+	// Unlock clears a lockout and the failed sign-in counter
+	Unlock(ctx context.Context, id uint, actor Actor) error
+}
+
+// ExternalAccount is a user as described by an external sign-in provider.
+// An empty Role or nil Entities leave those to be managed locally.
+type ExternalAccount struct {
+	Provider string
+	Email    string
+	Role     string
+	Entities []string
+}
+
+// Reasons recorded for failed sign-ins. Only wrong passwords and second
+// factors count towards an account lockout; every reason counts towards the
+// per-IP limit.
+const (
+	LoginFailedPassword = "wrong password"
+	LoginFailedUnknown  = "unknown email"
+	LoginFailedLocked   = "account locked"
+	LoginFailedMFA      = "wrong two-factor code"
+	LoginFailedDenied   = "refused by provider"
+	LoginFailedSSO      = "single sign-on failed"
+	LoginFailedProvider = "account signs in another way"
+)
+
+// PasswordUpdate controls how SetPassword treats the new password
+type PasswordUpdate struct {
+	// MustChange makes the user choose a new password before doing anything else
+	MustChange bool
+	// Keep is how many previous hashes to retain; older ones are deleted
+	Keep int
+}
+
+// LockoutPolicy locks an account for Duration after Threshold failed sign-ins in a row
+type LockoutPolicy struct {
+	Threshold int
+	Duration  time.Duration
+}
+
+// InvitationRepository stores signup invitations. Tokens are looked up by
+// their hash only.
+type InvitationRepository interface {
+	Create(ctx context.Context, inv *db.Invitation, actor Actor) error
+	Get(ctx context.Context, id uint) (*db.Invitation, error)
+	// List returns every invitation, newest first
+	List(ctx context.Context) ([]db.Invitation, error)
+	// Revoke withdraws an unused invitation, else returns ErrInvitationUnusable
+	Revoke(ctx context.Context, id uint, actor Actor) error
+	// Accept creates user from the invitation with tokenHash and marks it
+	// used, in one transaction
+	Accept(ctx context.Context, tokenHash string, user *db.User, actor Actor) (*db.Invitation, error)
+}
+
+// Reasons recorded when a session is revoked
+const (
+	RevokeLogout = "logout"
+	RevokeReuse  = "refresh_reused"
+	RevokeAdmin  = "admin"
+	RevokeReset  = "password_reset"
+)
+
+// SessionRepository stores sign-in sessions and revoked access tokens. It is
+// the revocation store consulted when validating access tokens.
+type SessionRepository interface {
+	Create(ctx context.Context, session *db.Session) error
+	// Rotate replaces the refresh token with hash oldHash by newHash and
+	// returns the session. Presenting a rotated token revokes the session and
+	// returns ErrRefreshReused.
+	Rotate(ctx context.Context, oldHash, newHash string) (*db.Session, error)
+	Revoke(ctx context.Context, id uint, reason string) error
+	// MarkMFAVerified records that the session's user has just passed a second factor
+	MarkMFAVerified(ctx context.Context, id uint) error
+	// RevokeUser revokes every open session of a user and returns how many
+	RevokeUser(ctx context.Context, userID uint, actor Actor) (int64, error)
+	// RevokeToken withdraws one access token until it would have expired
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string, sessionID uint) (bool, error)
+}
+
+// PasswordResetRepository stores the one-time tokens of the forgotten
+// password flow
+type PasswordResetRepository interface {
+	// Create stores reset and invalidates the user's earlier unused tokens
+	Create(ctx context.Context, reset *db.PasswordReset, actor Actor) error
+	// Lookup returns the usable token with tokenHash, or ErrResetInvalid
+	Lookup(ctx context.Context, tokenHash string) (*db.PasswordReset, error)
+	// Redeem marks the token used and sets the password in one transaction.
+	// It also clears a lockout and revokes the user's sessions.
+	Redeem(ctx context.Context, tokenHash, passwordHash string, opts PasswordUpdate, actor Actor) (*db.PasswordReset, error)
+}
+
+// MFARepository stores TOTP enrollment and recovery codes. Codes are
+// checked by the caller; the repository records their use so none works twice.
+type MFARepository interface {
+	// StartEnrollment stores a new, not yet active secret
+	StartEnrollment(ctx context.Context, id uint, secret string) error
+	// Enable activates the pending secret, records step as used and replaces
+	// the recovery codes with codeHashes
+	Enable(ctx context.Context, id uint, step int64, codeHashes []string, actor Actor) error
+	// Disable removes the secret and recovery codes. It is recorded as
+	// disable_mfa when actor is the user, else reset_mfa.
+	Disable(ctx context.Context, id uint, actor Actor) error
+	// UseStep records a verified TOTP step; ErrMFACodeInvalid if it is not
+	// newer than the last one
+	UseStep(ctx context.Context, id uint, step int64) error
+	// UseRecoveryCode consumes the unused code with codeHash, or returns
+	// ErrMFACodeInvalid
+	UseRecoveryCode(ctx context.Context, id uint, codeHash string, actor Actor) error
+	ReplaceRecoveryCodes(ctx context.Context, id uint, codeHashes []string, actor Actor) error
+	RecoveryCodesLeft(ctx context.Context, id uint) (int64, error)
+}
+
+// OIDCLoginRepository stores single sign-on attempts between the redirect
+// to the provider and the callback
+type OIDCLoginRepository interface {
+	// Create stores login and deletes expired attempts
+	Create(ctx context.Context, login *db.OIDCLogin) error
+	// Take removes and returns the unexpired attempt with stateHash, so each
+	// state works once; ErrOIDCStateInvalid if there is none
+	Take(ctx context.Context, stateHash string) (*db.OIDCLogin, error)
+}
+
+// APIKeyRepository stores the API keys of machine integrations
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *db.APIKey, actor Actor) error
+	Get(ctx context.Context, id uint) (*db.APIKey, error)
+	// List returns every key, newest first
+	List(ctx context.Context) ([]db.APIKey, error)
+	// Revoke withdraws a key at once; ErrAPIKeyRevoked if it already was
+	Revoke(ctx context.Context, id uint, actor Actor) error
+	// Authenticate returns the usable key with keyHash and records that it
+	// was used from ip, or returns ErrAPIKeyInvalid
+	Authenticate(ctx context.Context, keyHash, ip string) (*db.APIKey, error)
+}
+
+// RoleRepository stores the named roles users are given
+type RoleRepository interface {
+	// List returns every role, built-in roles first
+	List(ctx context.Context) ([]db.Role, error)
+	Get(ctx context.Context, name string) (*db.Role, error)
+	// Create adds a role, or returns ErrRoleExists
+	Create(ctx context.Context, role *db.Role, actor Actor) error
+	Update(ctx context.Context, name, description string, permissions []string, actor Actor) (*db.Role, error)
+	// Delete removes a role nobody holds; built-in roles cannot be deleted
+	Delete(ctx context.Context, name string, actor Actor) error
+}
+
+// SponsorRepository stores the sponsor master data that test items and
+// studies refer to
+type SponsorRepository interface {
+	// List returns sponsors by name; query matches part of the name, ignoring case
+	List(ctx context.Context, query string) ([]db.Sponsor, error)
+	Get(ctx context.Context, id uint) (*db.Sponsor, error)
+	// FindByName matches the name ignoring case and surrounding spaces
+	FindByName(ctx context.Context, name string) (*db.Sponsor, error)
+	// Create returns ErrSponsorExists if the name is taken
+	Create(ctx context.Context, sponsor *db.Sponsor, actor Actor) error
+	// Update saves every field of sponsor; ErrSponsorExists if renamed to a
+	// taken name
+	Update(ctx context.Context, sponsor *db.Sponsor, actor Actor) error
+	// Delete removes a sponsor no record refers to, else ErrSponsorInUse
+	Delete(ctx context.Context, id uint, actor Actor) error
+	// CompanyNames counts the free-text company names of test items that
+	// have no sponsor yet, deleted ones included
+	CompanyNames(ctx context.Context) (map[string]int, error)
+	// Link assigns the sponsor to the test items without one whose company
+	// name is one of names (after trimming), renaming their company to the
+	// sponsor's, and to the studies of those test items. Each change saves a
+	// version.
+	Link(ctx context.Context, id uint, names []string, actor Actor) (items, studies int, err error)
+}
+
+// PersonnelFilter narrows the personnel directory; empty fields match everything
+type PersonnelFilter struct {
+	// Query matches part of the name, ignoring case
+	Query string
+	Role  string
+}
+
+// PersonnelRepository stores the personnel directory and finds the records
+// naming a person
+type PersonnelRepository interface {
+	// List returns people by name
+	List(ctx context.Context, filter PersonnelFilter) ([]db.Person, error)
+	Get(ctx context.Context, id uint) (*db.Person, error)
+	// FindByUser returns the person linked to user account userID
+	FindByUser(ctx context.Context, userID uint) (*db.Person, error)
+	// Create returns ErrPersonUserLinked if person.UserID is linked already
+	Create(ctx context.Context, person *db.Person, actor Actor) error
+	// Update saves every field of person, like Create
+	Update(ctx context.Context, person *db.Person, actor Actor) error
+	// Delete removes a person no record names, else ErrPersonInUse
+	Delete(ctx context.Context, id uint, actor Actor) error
+	// Studies returns the studies the person directs, newest first
+	Studies(ctx context.Context, id uint, filter ListFilter) ([]db.Study, error)
+	// Archived returns the test items the person archived, newest first
+	Archived(ctx context.Context, id uint, filter ListFilter) ([]db.TestItem, error)
+}
+
+// PortalRepository reads the records a sponsor company may see: test items
+// whose company name or sponsor record's name matches, ignoring case and
+// surrounding spaces, and the studies of those test items (by test item
+// code) or of that sponsor. ErrNotFound is returned for any other record.
+type PortalRepository interface {
+	TestItems(ctx context.Context, company string) ([]db.TestItem, error)
+	TestItem(ctx context.Context, company string, id uint) (*db.TestItem, error)
+	Studies(ctx context.Context, company string) ([]db.Study, error)
+	Study(ctx context.Context, company string, id uint) (*db.Study, error)
+}
+
+// DisposalFilter narrows a list of disposal requests; empty fields match everything
+type DisposalFilter struct {
+	// Company matches like PortalRepository does
+	Company  string
+	Entities []string
+	Status   string
+}
+
+// DisposalRequestRepository stores requests for sponsors to approve the
+// disposal or return of test items
+type DisposalRequestRepository interface {
+	// Create opens a request for req.TestItemID, copying the test item's
+	// entity and company; ErrDisposalPending if one is already open
+	Create(ctx context.Context, req *db.DisposalRequest, actor Actor) error
+	// List returns matching requests, newest first
+	List(ctx context.Context, filter DisposalFilter) ([]db.DisposalRequest, error)
+	// Approve records company's approval and sets the test item's
+	// SponsorApprovalDate to today, saving a version. Requests of other
+	// companies are ErrNotFound; ErrDisposalApproved if already approved.
+	Approve(ctx context.Context, id uint, company, note string, actor Actor) (*db.DisposalRequest, error)
+}
+
+// AccessLogFilter narrows the access log; empty fields match everything
+type AccessLogFilter struct {
+	RecordType string
+	RecordID   uint
+	UserID     *uint
+	// From and To bound created_at, To exclusive
+	From, To time.Time
+	Entity   string
+	Entities []string
+	Limit    int
+}
+
+// AccessLogRepository records reads of archive records
+type AccessLogRepository interface {
+	// Record appends entries, one per record read
+	Record(ctx context.Context, entries []db.AccessLog) error
+	// List returns matching entries, newest first
+	List(ctx context.Context, filter AccessLogFilter) ([]db.AccessLog, error)
+}
+
+// ArchiveRepository stores one kind of archive record with soft deletion,
+// optimistic locking and version history. Every change is recorded in the
+// audit log and/or record_versions in the same transaction.
+type ArchiveRepository[T any] interface {
+	List(ctx context.Context, filter ListFilter) ([]T, error)
+	ListDeleted(ctx context.Context, filter ListFilter) ([]T, error)
+	// Stream calls fn for each matching record without loading them all
+	Stream(ctx context.Context, filter ListFilter, fn func(*T) error) error
+	// LogExport writes entry to the access log once for every record
+	// matching filter, with the record's id and entity, in one transaction
+	LogExport(ctx context.Context, filter ListFilter, entry db.AccessLog) error
+	Get(ctx context.Context, id uint) (*T, error)
+	// Entity returns the entity of a record, including a deleted one
+	Entity(ctx context.Context, id uint) (string, error)
+	Create(ctx context.Context, record *T, actor Actor) error
+	// Update applies updates if the stored version equals expectedVersion,
+	// else returns ErrStaleVersion
+	Update(ctx context.Context, id uint, expectedVersion int, updates map[string]interface{}, actor Actor) (*T, error)
+	Delete(ctx context.Context, id uint, reason string, actor Actor) error
+	Restore(ctx context.Context, id uint, reason string, actor Actor) (*T, error)
+	// Purge permanently removes a soft-deleted record whose retention has ended
+	Purge(ctx context.Context, id uint, reason string, retentionYears int, actor Actor) error
+
+	Versions(ctx context.Context, id uint) ([]db.RecordVersion, error)
+	Version(ctx context.Context, id uint, n int) (*db.RecordVersion, error)
+	// VersionAt returns the version that was current at the given time
+	VersionAt(ctx context.Context, id uint, at time.Time) (*db.RecordVersion, error)
+	LatestVersion(ctx context.Context, id uint) (int, error)
+}
+
+type (
+	TestItemRepository    = ArchiveRepository[db.TestItem]
+	StudyRepository       = ArchiveRepository[db.Study]
+	FacilityDocRepository = ArchiveRepository[db.FacilityDoc]
+)
+
+// Repositories bundles the repositories handed to the HTTP layer
+type Repositories struct {
+	Users        UserRepository
+	Invitations  InvitationRepository
+	Sessions     SessionRepository
+	Resets       PasswordResetRepository
+	MFA          MFARepository
+	OIDCLogins   OIDCLoginRepository
+	APIKeys      APIKeyRepository
+	Roles        RoleRepository
+	Sponsors     SponsorRepository
+	Personnel    PersonnelRepository
+	Portal       PortalRepository
+	Disposals    DisposalRequestRepository
+	AccessLog    AccessLogRepository
+	TestItems    TestItemRepository
+	Studies      StudyRepository
+	FacilityDocs FacilityDocRepository
+	Search       SearchRepository
+}
+
+// New returns the repositories for database's dialect
+func New(database *gorm.DB) *Repositories {
+	if database.Dialector.Name() == "sqlite" {
+		return NewSQLite(database)
+	}
+	return NewPostgres(database)
+}
+
+// NewPostgres returns repositories backed by PostgreSQL
+func NewPostgres(database *gorm.DB) *Repositories {
+	r := newGormRepositories(database)
+	r.Search = &postgresSearch{db: database}
+	return r
+}
+
+// NewSQLite returns repositories backed by SQLite
+func NewSQLite(database *gorm.DB) *Repositories {
+	r := newGormRepositories(database)
+	r.Search = &sqliteSearch{db: database}
+	return r
+}
+
+// newGormRepositories builds the parts that are portable across dialects
+func newGormRepositories(database *gorm.DB) *Repositories {
+	testItems := &gormArchive[db.TestItem, *db.TestItem]{db: database, recordType: RecordTypeTestItem}
+	studies := &gormArchive[db.Study, *db.Study]{db: database, recordType: RecordTypeStudy}
+	return &Repositories{
+		Users:        &gormUsers{db: database},
+		Invitations:  &gormInvitations{db: database},
+		Sessions:     &gormSessions{db: database},
+		Resets:       &gormPasswordResets{db: database},
+		MFA:          &gormMFA{db: database},
+		OIDCLogins:   &gormOIDCLogins{db: database},
+		APIKeys:      &gormAPIKeys{db: database},
+		Roles:        &gormRoles{db: database},
+		Sponsors:     &gormSponsors{db: database, items: testItems, studies: studies},
+		Personnel:    &gormPersonnel{db: database},
+		Portal:       &gormPortal{db: database},
+		Disposals:    &gormDisposals{db: database, items: testItems},
+		AccessLog:    &gormAccessLog{db: database},
+		TestItems:    testItems,
+		Studies:      studies,
+		FacilityDocs: &gormArchive[db.FacilityDoc, *db.FacilityDoc]{db: database, recordType: RecordTypeFacilityDoc},
+	}
+}
+
+// notFound maps GORM's not-found error onto ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormRoles struct {
+	db *gorm.DB
+}
+
+func (r *gormRoles) List(ctx context.Context) ([]db.Role, error) {
+	roles := []db.Role{}
+	err := r.db.WithContext(ctx).Order("builtin desc, name asc").Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoles) Get(ctx context.Context, name string) (*db.Role, error) {
+	var role db.Role
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &role, nil
+}
+
+func (r *gormRoles) Create(ctx context.Context, role *db.Role, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&db.Role{}).Where("name = ?", role.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleExists
+		}
+		if err := tx.Create(role).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, roleAudit(actor, db.AuditRoleCreate, role.ID, role.Name+": "+role.Permissions))
+	})
+}
+
+func (r *gormRoles) Update(ctx context.Context, name, description string, permissions []string, actor Actor) (*db.Role, error) {
+	var role db.Role
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+			return notFound(err)
+		}
+		perms := strings.Join(permissions, ",")
+		details := role.Name + ": " + role.Permissions + " -> " + perms
+		err := tx.Model(&db.Role{}).Where("id = ?", role.ID).Updates(map[string]interface{}{
+			"description": description,
+			"permissions": perms,
+			"updated_at":  time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := db.WriteAudit(tx, roleAudit(actor, db.AuditRoleUpdate, role.ID, details)); err != nil {
+			return err
+		}
+		return tx.First(&role, role.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *gormRoles) Delete(ctx context.Context, name string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var role db.Role
+		if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+			return notFound(err)
+		}
+		if role.Builtin {
+			return ErrRoleBuiltin
+		}
+		var users, assignments int64
+		if err := tx.Model(&db.User{}).Where("role = ?", name).Count(&users).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&db.UserRole{}).Where("role = ?", name).Count(&assignments).Error; err != nil {
+			return err
+		}
+		if users+assignments > 0 {
+			return ErrRoleInUse
+		}
+		if err := tx.Delete(&db.Role{}, role.ID).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, roleAudit(actor, db.AuditRoleDelete, role.ID, role.Name))
+	})
+}
+
+func (r *gormUsers) EntityRoles(ctx context.Context, ids ...uint) (map[uint][]db.UserRole, error) {
+	out := map[uint][]db.UserRole{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var rows []db.UserRole
+	if err := r.db.WithContext(ctx).Where("user_id IN ?", ids).Order("entity asc, role asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.UserID] = append(out[row.UserID], row)
+	}
+	return out, nil
+}
+
+func (r *gormUsers) SetEntityRoles(ctx context.Context, id uint, roles []db.UserRole, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&db.UserRole{}).Error; err != nil {
+			return err
+		}
+		details := make([]string, len(roles))
+		for i, role := range roles {
+			var count int64
+			if err := tx.Model(&db.Role{}).Where("name = ?", role.Role).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrRoleUnknown
+			}
+			row := db.UserRole{UserID: id, Entity: role.Entity, Role: role.Role, CreatedAt: time.Now()}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			details[i] = role.Entity + ":" + role.Role
+		}
+		entry := userAudit(actor, db.AuditEntityRoles, id, strings.Join(details, ","))
+		return updateUserTx(tx, id, map[string]interface{}{}, entry)
+	})
+}
+
+func (r *gormUsers) Grants(ctx context.Context, user *db.User) (db.Grants, error) {
+	// sponsor accounts only reach the sponsor portal
+	if user.Sponsor != "" {
+		return db.Grants{}, nil
+	}
+	q := r.db.WithContext(ctx)
+	var entities []string
+	if err := q.Model(&db.UserEntity{}).Where("user_id = ?", user.ID).Pluck("entity", &entities).Error; err != nil {
+		return nil, err
+	}
+	var assigned []db.UserRole
+	if err := q.Where("user_id = ?", user.ID).Find(&assigned).Error; err != nil {
+		return nil, err
+	}
+	names := []string{user.Role}
+	for _, a := range assigned {
+		names = append(names, a.Role)
+	}
+	var roles []db.Role
+	if err := q.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	perms := map[string][]string{}
+	for _, role := range roles {
+		perms[role.Name] = role.PermissionList()
+	}
+
+	grants := db.Grants{}
+	// the base role applies where the user is a member, or everywhere
+	if len(entities) == 0 {
+		entities = []string{db.AllEntities}
+	}
+	for _, entity := range entities {
+		grants.Add(entity, perms[user.Role]...)
+	}
+	for _, a := range assigned {
+		grants.Add(a.Entity, perms[a.Role]...)
+	}
+	return grants, nil
+}
+
+func roleAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypeRole
+	return entry
+}
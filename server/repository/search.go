@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+// SearchQuery is a full-text search over one or more registers
+type SearchQuery struct {
+	// Text uses web-search syntax: "quoted phrases", -exclusions, or
+	Text   string
+	Entity string
+	// Entities limits the results to these entities when not empty
+	Entities []string
+	Tables   []db.SearchTable
+	Limit    int
+}
+
+// SearchResult is one ranked hit from any of the archive registers.
+// Snippet is HTML: the record text is escaped and matches are in <mark>.
+type SearchResult struct {
+	Type    string  `json:"type"`
+	ID      uint    `json:"id"`
+	Entity  string  `json:"entity"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SearchRepository runs ranked searches across the archive registers.
+// Deleted records are never returned.
+type SearchRepository interface {
+	Search(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+}
+
+// htmlEscapeSQL wraps the SQL text expression expr so it is HTML escaped.
+// ts_headline only adds the <mark> tags, so the text must be escaped before
+// it is headlined for the snippet to be safe to render.
+func htmlEscapeSQL(expr string) string {
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}} {
+		expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, strings.ReplaceAll(r[0], "'", "''"), r[1])
+	}
+	return expr
+}
+
+// postgresSearch uses tsvector documents backed by the GIN indexes
+type postgresSearch struct {
+	db *gorm.DB
+}
+
+func (s *postgresSearch) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	// One SELECT per register, unioned and ranked together
+	parts := make([]string, 0, len(q.Tables))
+	for _, t := range q.Tables {
+		part := fmt.Sprintf(`SELECT '%s' AS type, id, entity, coalesce(%s, '') AS title,
+			ts_rank(%s, query) AS rank,
+			ts_headline('simple', %s, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+			FROM %s, websearch_to_tsquery('simple', @q) AS query
+			WHERE deleted_at IS NULL AND (%s) @@ query`, t.Type, t.Title, t.Document, htmlEscapeSQL(t.Text), t.Table, t.Document)
+		if q.Entity != "" {
+			part += " AND entity = @entity"
+		}
+		if len(q.Entities) > 0 {
+			part += " AND entity IN @entities"
+		}
+		parts = append(parts, part)
+	}
+	stmt := strings.Join(parts, " UNION ALL ") + " ORDER BY rank DESC, id DESC LIMIT @limit"
+
+	results := []SearchResult{}
+	err := s.db.WithContext(ctx).Raw(stmt,
+		sql.Named("q", q.Text),
+		sql.Named("entity", q.Entity),
+		sql.Named("entities", q.Entities),
+		sql.Named("limit", q.Limit),
+	).Scan(&results).Error
+	return results, err
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sqliteSearch approximates the PostgreSQL search for SQLite, which has no
+// tsvector: terms are matched with LIKE and ranked and highlighted in Go.
+// That scans the registers, which is fine at the sizes SQLite is meant for.
+type sqliteSearch struct {
+	db *gorm.DB
+}
+
+// searchWeights mirrors ts_rank's default weights for A, B and C
+var searchWeights = [3]float64{1.0, 0.4, 0.2}
+
+// searchTerm is a word or quoted phrase; exclude terms must not match
+type searchTerm struct {
+	text    string
+	exclude bool
+}
+
+// parseWebSearch splits web-search syntax into alternatives separated by
+// "or", each a list of terms that must all hold
+func parseWebSearch(q string) [][]searchTerm {
+	var groups [][]searchTerm
+	var group []searchTerm
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		exclude := false
+		if q[0] == '-' {
+			exclude = true
+			q = q[1:]
+		}
+		var text string
+		if strings.HasPrefix(q, `"`) {
+			end := strings.Index(q[1:], `"`)
+			if end < 0 {
+				text, q = q[1:], ""
+			} else {
+				text, q = q[1:end+1], q[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(q, " \t")
+			if end < 0 {
+				end = len(q)
+			}
+			text, q = q[:end], q[end:]
+			if !exclude && strings.EqualFold(text, "or") {
+				if len(group) > 0 {
+					groups = append(groups, group)
+					group = nil
+				}
+				continue
+			}
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			group = append(group, searchTerm{text: text, exclude: exclude})
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// likePattern matches s anywhere, escaping LIKE wildcards
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// concatColumns joins columns with spaces, treating NULL as empty
+func concatColumns(columns []string) string {
+	if len(columns) == 0 {
+		return "''"
+	}
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		parts[i] = "coalesce(" + col + ", '')"
+	}
+	return strings.Join(parts, " || ' ' || ")
+}
+
+type sqliteHit struct {
+	ID     uint
+	Entity string
+	Title  string
+	W0     string
+	W1     string
+	W2     string
+}
+
+func (s *sqliteSearch) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	groups := parseWebSearch(q.Text)
+	if len(groups) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var positive []string
+	for _, g := range groups {
+		for _, t := range g {
+			if !t.exclude {
+				positive = append(positive, regexp.QuoteMeta(t.text))
+			}
+		}
+	}
+	var highlight *regexp.Regexp
+	if len(positive) > 0 {
+		highlight = regexp.MustCompile("(?i)" + strings.Join(positive, "|"))
+	}
+
+	results := []SearchResult{}
+	for _, t := range q.Tables {
+		document := "(" + concatColumns(t.Weights[0]) + " || ' ' || " + concatColumns(t.Weights[1]) +
+			" || ' ' || " + concatColumns(t.Weights[2]) + ")"
+
+		var alternatives []string
+		var args []interface{}
+		for _, g := range groups {
+			var conds []string
+			for _, term := range g {
+				op := "LIKE"
+				if term.exclude {
+					op = "NOT LIKE"
+				}
+				conds = append(conds, fmt.Sprintf(`%s %s ? ESCAPE '\'`, document, op))
+				args = append(args, likePattern(term.text))
+			}
+			alternatives = append(alternatives, "("+strings.Join(conds, " AND ")+")")
+		}
+
+		query := s.db.WithContext(ctx).Table(t.Table).
+			Select(fmt.Sprintf("id, entity, coalesce(%s, '') AS title, %s AS w0, %s AS w1, %s AS w2",
+				t.Title, concatColumns(t.Weights[0]), concatColumns(t.Weights[1]), concatColumns(t.Weights[2]))).
+			Where("deleted_at IS NULL").
+			Where(strings.Join(alternatives, " OR "), args...)
+		if q.Entity != "" {
+			query = query.Where("entity = ?", q.Entity)
+		}
+		if len(q.Entities) > 0 {
+			query = query.Where("entity IN ?", q.Entities)
+		}
+
+		var hits []sqliteHit
+		if err := query.Scan(&hits).Error; err != nil {
+			return nil, err
+		}
+		for _, h := range hits {
+			fields := [3]string{h.W0, h.W1, h.W2}
+			results = append(results, SearchResult{
+				Type:    t.Type,
+				ID:      h.ID,
+				Entity:  h.Entity,
+				Title:   h.Title,
+				Rank:    rankFields(fields, highlight),
+				Snippet: snippet(fields, highlight),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID > results[j].ID
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// rankFields weighs each match by the weight of the field it occurs in
+func rankFields(fields [3]string, terms *regexp.Regexp) float64 {
+	if terms == nil {
+		return 0
+	}
+	var rank float64
+	for i, f := range fields {
+		rank += float64(len(terms.FindAllStringIndex(f, -1))) * searchWeights[i]
+	}
+	return rank
+}
+
+// snippetWords is roughly ts_headline's MaxWords
+const snippetWords = 20
+
+// snippet returns up to snippetWords words around the first match as HTML,
+// with every match wrapped in <mark> like ts_headline
+func snippet(fields [3]string, terms *regexp.Regexp) string {
+	var parts []string
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			parts = append(parts, f)
+		}
+	}
+	words := strings.Fields(strings.Join(parts, " | "))
+
+	start := 0
+	if terms != nil {
+		for i, w := range words {
+			if terms.MatchString(w) {
+				start = max(0, i-snippetWords/4)
+				break
+			}
+		}
+	}
+	end := min(len(words), start+snippetWords)
+	text := strings.Join(words[start:end], " ")
+	if terms == nil {
+		return html.EscapeString(text)
+	}
+	// the record text is escaped around the matches, not the markup
+	var b strings.Builder
+	last := 0
+	for _, m := range terms.FindAllStringIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		b.WriteString("<mark>" + html.EscapeString(text[m[0]:m[1]]) + "</mark>")
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormSessions struct {
+	db *gorm.DB
+}
+
+func (r *gormSessions) Create(ctx context.Context, session *db.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *gormSessions) Rotate(ctx context.Context, oldHash, newHash string) (*db.Session, error) {
+	var session db.Session
+	reused := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("refresh_hash = ?", oldHash).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// a rotated token coming back means two clients hold it
+			err = tx.Where("previous_hash = ? AND revoked_at IS NULL", oldHash).First(&session).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionInvalid
+			}
+			if err != nil {
+				return err
+			}
+			reused = true
+			return revokeSession(tx, session.ID, RevokeReuse)
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			return ErrSessionInvalid
+		}
+		res := tx.Model(&db.Session{}).
+			Where("id = ? AND refresh_hash = ?", session.ID, oldHash).
+			Updates(map[string]interface{}{"refresh_hash": newHash, "previous_hash": oldHash, "last_used_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSessionInvalid
+		}
+		session.RefreshHash, session.PreviousHash, session.LastUsedAt = newHash, oldHash, &now
+		return nil
+	})
+	if reused {
+		// the revocation above committed; report the reuse to the caller
+		return nil, ErrRefreshReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessions) Revoke(ctx context.Context, id uint, reason string) error {
+	return revokeSession(r.db.WithContext(ctx), id, reason)
+}
+
+func (r *gormSessions) MarkMFAVerified(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&db.Session{}).Where("id = ?", id).Update("mfa_verified", true).Error
+}
+
+func revokeSession(tx *gorm.DB, id uint, reason string) error {
+	return tx.Model(&db.Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+func (r *gormSessions) RevokeUser(ctx context.Context, userID uint, actor Actor) (int64, error) {
+	var revoked int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&db.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": RevokeAdmin})
+		if res.Error != nil {
+			return res.Error
+		}
+		revoked = res.RowsAffected
+		return db.WriteAudit(tx, userAudit(actor, db.AuditRevokeSessions, userID, fmt.Sprintf("%d sessions", revoked)))
+	})
+	return revoked, err
+}
+
+func (r *gormSessions) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// expired tokens fail validation anyway, so their rows are no longer needed
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&db.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&db.RevokedToken{JTI: tokenID, ExpiresAt: expiresAt, CreatedAt: time.Now()}).Error
+	})
+}
+
+func (r *gormSessions) IsRevoked(ctx context.Context, tokenID string, sessionID uint) (bool, error) {
+	var count int64
+	if tokenID != "" {
+		if err := r.db.WithContext(ctx).Model(&db.RevokedToken{}).Where("jti = ?", tokenID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	if sessionID != 0 {
+		err := r.db.WithContext(ctx).Model(&db.Session{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		return count == 0, nil
+	}
+	return false, nil
+}
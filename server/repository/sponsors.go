@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormSponsors struct {
+	db      *gorm.DB
+	items   *gormArchive[db.TestItem, *db.TestItem]
+	studies *gormArchive[db.Study, *db.Study]
+}
+
+func (r *gormSponsors) List(ctx context.Context, query string) ([]db.Sponsor, error) {
+	q := r.db.WithContext(ctx)
+	if query = strings.TrimSpace(query); query != "" {
+		q = q.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(query)+"%")
+	}
+	list := []db.Sponsor{}
+	err := q.Order("LOWER(name) asc").Find(&list).Error
+	return list, err
+}
+
+func (r *gormSponsors) Get(ctx context.Context, id uint) (*db.Sponsor, error) {
+	var sponsor db.Sponsor
+	if err := r.db.WithContext(ctx).First(&sponsor, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sponsor, nil
+}
+
+func (r *gormSponsors) FindByName(ctx context.Context, name string) (*db.Sponsor, error) {
+	var sponsor db.Sponsor
+	if err := r.db.WithContext(ctx).Where(sponsorNameMatch, companyKey(name)).First(&sponsor).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sponsor, nil
+}
+
+// sponsorNameMatch compares sponsors.name with companyKey of a name
+const sponsorNameMatch = "LOWER(TRIM(name)) = ?"
+
+// nameTaken reports whether another sponsor than id has name
+func nameTaken(tx *gorm.DB, name string, id uint) (bool, error) {
+	var count int64
+	err := tx.Model(&db.Sponsor{}).Where(sponsorNameMatch, companyKey(name)).Where("id <> ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormSponsors) Create(ctx context.Context, sponsor *db.Sponsor, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		taken, err := nameTaken(tx, sponsor.Name, 0)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrSponsorExists
+		}
+		if err := tx.Create(sponsor).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, sponsorAudit(actor, db.AuditSponsorCreate, sponsor.ID, sponsor.Name))
+	})
+}
+
+func (r *gormSponsors) Update(ctx context.Context, sponsor *db.Sponsor, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current db.Sponsor
+		if err := tx.First(&current, sponsor.ID).Error; err != nil {
+			return notFound(err)
+		}
+		taken, err := nameTaken(tx, sponsor.Name, sponsor.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrSponsorExists
+		}
+		sponsor.CreatedAt = current.CreatedAt
+		if err := tx.Save(sponsor).Error; err != nil {
+			return err
+		}
+		details := sponsor.Name
+		if current.Name != sponsor.Name {
+			details = fmt.Sprintf("%q -> %q", current.Name, sponsor.Name)
+			// linked test items carry the sponsor's name as their company
+			var linked []db.TestItem
+			if err := tx.Unscoped().Where("sponsor_id = ?", sponsor.ID).Order("id").Find(&linked).Error; err != nil {
+				return err
+			}
+			for i := range linked {
+				if err := r.items.updateTx(tx, actor, &linked[i], map[string]interface{}{"company_name": sponsor.Name}); err != nil {
+					return err
+				}
+			}
+		}
+		return db.WriteAudit(tx, sponsorAudit(actor, db.AuditSponsorUpdate, sponsor.ID, details))
+	})
+}
+
+func (r *gormSponsors) Delete(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sponsor db.Sponsor
+		if err := tx.First(&sponsor, id).Error; err != nil {
+			return notFound(err)
+		}
+		for _, model := range []interface{}{&db.TestItem{}, &db.Study{}} {
+			var count int64
+			if err := tx.Unscoped().Model(model).Where("sponsor_id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrSponsorInUse
+			}
+		}
+		if err := tx.Delete(&sponsor).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, sponsorAudit(actor, db.AuditSponsorDelete, id, sponsor.Name))
+	})
+}
+
+func (r *gormSponsors) CompanyNames(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		CompanyName string
+		Count       int
+	}
+	err := r.db.WithContext(ctx).Unscoped().Model(&db.TestItem{}).
+		Select("TRIM(company_name) AS company_name, COUNT(*) AS count").
+		Where("sponsor_id IS NULL AND TRIM(company_name) <> ''").
+		Group("TRIM(company_name)").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]int, len(rows))
+	for _, row := range rows {
+		names[row.CompanyName] += row.Count
+	}
+	return names, nil
+}
+
+func (r *gormSponsors) Link(ctx context.Context, id uint, names []string, actor Actor) (items, studies int, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sponsor db.Sponsor
+		if err := tx.First(&sponsor, id).Error; err != nil {
+			return notFound(err)
+		}
+		trimmed := make([]string, len(names))
+		for i, name := range names {
+			trimmed[i] = strings.TrimSpace(name)
+		}
+
+		var found []db.TestItem
+		if err := tx.Unscoped().Where("sponsor_id IS NULL AND TRIM(company_name) IN ?", trimmed).Order("id").Find(&found).Error; err != nil {
+			return err
+		}
+		codes := []string{}
+		for i := range found {
+			item := &found[i]
+			changes := map[string]interface{}{"sponsor_id": id, "company_name": sponsor.Name}
+			if err := r.items.updateTx(tx, actor, item, changes); err != nil {
+				return err
+			}
+			if code := strings.TrimSpace(item.TestItemCode); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		items = len(found)
+
+		if len(codes) > 0 {
+			// as gormPortal.studies: a study follows the code only if one of
+			// the sponsor's test items in its entity has it and no other
+			// company's does
+			sameCode := func() *gorm.DB {
+				return tx.Session(&gorm.Session{NewDB: true}).Table("test_items AS ti").Select("1").
+					Where("TRIM(ti.test_item_code) = TRIM(studies.test_item_code) AND ti.entity = studies.entity AND ti.deleted_at IS NULL")
+			}
+			ours := sameCode().Where("ti.sponsor_id = ?", id)
+			theirs := sameCode().Where("COALESCE(ti.sponsor_id, 0) <> ? AND LOWER(TRIM(COALESCE(ti.company_name, ''))) <> ?",
+				id, companyKey(sponsor.Name))
+			var linked []db.Study
+			err := tx.Unscoped().Where("sponsor_id IS NULL AND TRIM(test_item_code) IN ? AND EXISTS (?) AND NOT EXISTS (?)", codes, ours, theirs).
+				Order("id").Find(&linked).Error
+			if err != nil {
+				return err
+			}
+			for i := range linked {
+				if err := r.studies.updateTx(tx, actor, &linked[i], map[string]interface{}{"sponsor_id": id}); err != nil {
+					return err
+				}
+			}
+			studies = len(linked)
+		}
+
+		details := fmt.Sprintf("%d test items, %d studies from %s", items, studies, strings.Join(trimmed, "; "))
+		return db.WriteAudit(tx, sponsorAudit(actor, db.AuditSponsorLink, id, details))
+	})
+	return items, studies, err
+}
+
+// sponsorRetention returns the retention period for record: years, or its
+// sponsor's retention terms when they are longer
+func sponsorRetention(tx *gorm.DB, record interface{}, years int) (int, error) {
+	s, ok := record.(db.Sponsored)
+	if !ok || s.SponsorRef() == nil {
+		return years, nil
+	}
+	var sponsor db.Sponsor
+	if err := tx.First(&sponsor, *s.SponsorRef()).Error; err != nil {
+		return years, notFound(err)
+	}
+	if sponsor.RetentionYears != nil && *sponsor.RetentionYears > years {
+		return *sponsor.RetentionYears, nil
+	}
+	return years, nil
+}
+
+func sponsorAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	entry := userAudit(actor, action, id, details)
+	entry.RecordType = RecordTypeSponsor
+	return entry
+}
@@ -0,0 +1,405 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+
+	"gorm.io/gorm"
+)
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *db.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUsers) FindByID(ctx context.Context, id uint) (*db.User, error) {
+	var user db.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) FindByEmail(ctx context.Context, email string) (*db.User, error) {
+	var user db.User
+	err := r.db.WithContext(ctx).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) List(ctx context.Context) ([]db.User, error) {
+	users := []db.User{}
+	err := r.db.WithContext(ctx).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUsers) Search(ctx context.Context, filter UserFilter) ([]db.User, error) {
+	q := r.db.WithContext(ctx).Model(&db.User{})
+	if filter.Query != "" {
+		q = q.Where("LOWER(email) LIKE ? ESCAPE '\\'", likePattern(strings.ToLower(filter.Query)))
+	}
+	if filter.Role != "" {
+		q = q.Where("role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case UserStatusActive:
+		q = q.Where("disabled_at IS NULL AND pending_approval = ?", false)
+	case UserStatusDisabled:
+		q = q.Where("disabled_at IS NOT NULL")
+	case UserStatusPending:
+		q = q.Where("pending_approval = ?", true)
+	case UserStatusLocked:
+		q = q.Where("locked_until > ?", time.Now())
+	}
+	if filter.Entity != "" {
+		q = q.Where("id IN (?)", r.db.Model(&db.UserEntity{}).Select("user_id").Where("entity = ?", filter.Entity))
+	}
+
+	users := []db.User{}
+	err := q.Order("email asc").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUsers) CreateAudited(ctx context.Context, user *db.User, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditUserCreate, user.ID, user.Email+" ("+user.Role+")"))
+	})
+}
+
+func (r *gormUsers) SetPassword(ctx context.Context, id uint, hash string, opts PasswordUpdate, actor Actor) error {
+	action := db.AuditPasswordReset
+	if actor.UserID != nil && *actor.UserID == id {
+		action = db.AuditPasswordChange
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setPasswordTx(tx, id, hash, opts, userAudit(actor, action, id, ""))
+	})
+}
+
+// setPasswordTx moves the current hash into the history, trimmed to opts.Keep
+// entries, and stores the new one
+func setPasswordTx(tx *gorm.DB, id uint, hash string, opts PasswordUpdate, entry db.AuditLog) error {
+	var user db.User
+	if err := tx.Select("id", "password").First(&user, id).Error; err != nil {
+		return notFound(err)
+	}
+	now := time.Now()
+	if err := tx.Create(&db.PasswordHistory{UserID: id, PasswordHash: user.Password, CreatedAt: now}).Error; err != nil {
+		return err
+	}
+	var stale []uint
+	err := tx.Model(&db.PasswordHistory{}).Where("user_id = ?", id).
+		Order("created_at desc, id desc").Offset(opts.Keep).Pluck("id", &stale).Error
+	if err != nil {
+		return err
+	}
+	if len(stale) > 0 {
+		if err := tx.Delete(&db.PasswordHistory{}, stale).Error; err != nil {
+			return err
+		}
+	}
+
+	changes := map[string]interface{}{
+		"password":             hash,
+		"password_changed_at":  now,
+		"must_change_password": opts.MustChange,
+	}
+	return updateUserTx(tx, id, changes, entry)
+}
+
+func (r *gormUsers) RecentPasswords(ctx context.Context, id uint, n int) ([]string, error) {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []string{user.Password}
+	if n <= 1 {
+		return hashes, nil
+	}
+	var previous []string
+	err = r.db.WithContext(ctx).Model(&db.PasswordHistory{}).Where("user_id = ?", id).
+		Order("created_at desc, id desc").Limit(n-1).Pluck("password_hash", &previous).Error
+	return append(hashes, previous...), err
+}
+
+func (r *gormUsers) SetDisabled(ctx context.Context, id uint, disabled bool, actor Actor) error {
+	if disabled {
+		return r.update(ctx, id, map[string]interface{}{"disabled_at": time.Now()}, userAudit(actor, db.AuditUserDisable, id, ""))
+	}
+	return r.update(ctx, id, map[string]interface{}{"disabled_at": nil}, userAudit(actor, db.AuditUserEnable, id, ""))
+}
+
+func (r *gormUsers) SetEmail(ctx context.Context, id uint, email string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user db.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return notFound(err)
+		}
+		entry := userAudit(actor, db.AuditEmailChange, id, user.Email+" -> "+email)
+		return updateUserTx(tx, id, map[string]interface{}{"email": email}, entry)
+	})
+}
+
+func (r *gormUsers) SetRole(ctx context.Context, id uint, role string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user db.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return notFound(err)
+		}
+		entry := userAudit(actor, db.AuditRoleChange, id, user.Role+" -> "+role)
+		return updateUserTx(tx, id, map[string]interface{}{"role": role}, entry)
+	})
+}
+
+func (r *gormUsers) Entities(ctx context.Context, ids ...uint) (map[uint][]string, error) {
+	out := map[uint][]string{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var rows []db.UserEntity
+	if err := r.db.WithContext(ctx).Where("user_id IN ?", ids).Order("entity asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.UserID] = append(out[row.UserID], row.Entity)
+	}
+	return out, nil
+}
+
+func (r *gormUsers) SetEntities(ctx context.Context, id uint, entities []string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&db.UserEntity{}).Error; err != nil {
+			return err
+		}
+		if err := createMemberships(tx, id, entities); err != nil {
+			return err
+		}
+		entry := userAudit(actor, db.AuditEntityChange, id, strings.Join(entities, ","))
+		return updateUserTx(tx, id, map[string]interface{}{}, entry)
+	})
+}
+
+func (r *gormUsers) Register(ctx context.Context, user *db.User, entity string, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return registerTx(tx, user, entity, actor, "")
+	})
+}
+
+func (r *gormUsers) Provision(ctx context.Context, account ExternalAccount, actor Actor) (*db.User, error) {
+	var user db.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		email := strings.ToLower(strings.TrimSpace(account.Email))
+		err := tx.Where("LOWER(email) = ?", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return provisionTx(tx, &user, email, account, actor)
+		}
+		if err != nil {
+			return err
+		}
+		if user.AuthProvider != account.Provider {
+			return ErrProviderMismatch
+		}
+
+		if account.Role != "" && account.Role != user.Role {
+			entry := userAudit(actor, db.AuditRoleChange, user.ID, user.Role+" -> "+account.Role+" via "+account.Provider)
+			if err := updateUserTx(tx, user.ID, map[string]interface{}{"role": account.Role}, entry); err != nil {
+				return err
+			}
+		}
+		if account.Entities == nil {
+			return tx.First(&user, user.ID).Error
+		}
+		var current []string
+		if err := tx.Model(&db.UserEntity{}).Where("user_id = ?", user.ID).Order("entity asc").Pluck("entity", &current).Error; err != nil {
+			return err
+		}
+		wanted := append([]string(nil), account.Entities...)
+		sort.Strings(wanted)
+		if strings.Join(current, ",") != strings.Join(wanted, ",") {
+			if err := tx.Where("user_id = ?", user.ID).Delete(&db.UserEntity{}).Error; err != nil {
+				return err
+			}
+			if err := createMemberships(tx, user.ID, wanted); err != nil {
+				return err
+			}
+			entry := userAudit(actor, db.AuditEntityChange, user.ID, strings.Join(wanted, ",")+" via "+account.Provider)
+			if err := updateUserTx(tx, user.ID, map[string]interface{}{}, entry); err != nil {
+				return err
+			}
+		}
+		return tx.First(&user, user.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provisionTx creates the local account for a first external sign-in. It has
+// no usable local password.
+func provisionTx(tx *gorm.DB, user *db.User, email string, account ExternalAccount, actor Actor) error {
+	*user = db.User{Email: email, Role: account.Role, AuthProvider: account.Provider}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	if err := createMemberships(tx, user.ID, account.Entities); err != nil {
+		return err
+	}
+	details := user.Email + " (" + user.Role + ") via " + account.Provider
+	return db.WriteAudit(tx, userAudit(actor, db.AuditUserCreate, user.ID, details))
+}
+
+func createMemberships(tx *gorm.DB, id uint, entities []string) error {
+	for _, entity := range entities {
+		if err := tx.Create(&db.UserEntity{UserID: id, Entity: entity, CreatedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerTx creates user as a member of entity and records the signup
+func registerTx(tx *gorm.DB, user *db.User, entity string, actor Actor, via string) error {
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&db.UserEntity{UserID: user.ID, Entity: entity, CreatedAt: time.Now()}).Error; err != nil {
+		return err
+	}
+	details := user.Email + " (" + entity + ")"
+	if via != "" {
+		details += " via " + via
+	} else if user.PendingApproval {
+		details += " pending approval"
+	}
+	return db.WriteAudit(tx, userAudit(actor, db.AuditSignup, user.ID, details))
+}
+
+func (r *gormUsers) Approve(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user db.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return notFound(err)
+		}
+		if !user.PendingApproval {
+			return ErrNotPending
+		}
+		entry := userAudit(actor, db.AuditUserApprove, id, user.Email)
+		return updateUserTx(tx, id, map[string]interface{}{"pending_approval": false}, entry)
+	})
+}
+
+func (r *gormUsers) RecordLogin(ctx context.Context, id uint, actor Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&db.User{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+		if err != nil {
+			return err
+		}
+		return db.WriteAudit(tx, userAudit(actor, db.AuditLogin, id, ""))
+	})
+}
+
+func (r *gormUsers) RecordFailedLogin(ctx context.Context, user *db.User, reason string, policy LockoutPolicy, actor Actor) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		entry := userAudit(actor, db.AuditLoginFailed, 0, reason)
+		if user == nil {
+			return db.WriteAudit(tx, entry)
+		}
+		entry.RecordID = user.ID
+		if err := db.WriteAudit(tx, entry); err != nil {
+			return err
+		}
+		if reason != LoginFailedPassword && reason != LoginFailedMFA {
+			return nil
+		}
+
+		// a lock that has run out starts a fresh count
+		now := time.Now()
+		err := tx.Model(&db.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"failed_logins": gorm.Expr("CASE WHEN locked_until IS NOT NULL AND locked_until <= ? THEN 1 ELSE failed_logins + 1 END", now),
+			"locked_until":  gorm.Expr("CASE WHEN locked_until IS NOT NULL AND locked_until <= ? THEN NULL ELSE locked_until END", now),
+		}).Error
+		if err != nil {
+			return err
+		}
+		var current db.User
+		if err := tx.Select("failed_logins", "locked_until").First(&current, user.ID).Error; err != nil {
+			return notFound(err)
+		}
+		if current.FailedLogins < policy.Threshold || current.LockedUntil != nil {
+			return nil
+		}
+
+		until := now.Add(policy.Duration)
+		if err := tx.Model(&db.User{}).Where("id = ?", user.ID).Update("locked_until", until).Error; err != nil {
+			return err
+		}
+		lockedUntil = &until
+		details := fmt.Sprintf("%d failed sign-ins; locked until %s", current.FailedLogins, until.Format(time.RFC3339))
+		return db.WriteAudit(tx, userAudit(actor, db.AuditAccountLock, user.ID, details))
+	})
+	return lockedUntil, err
+}
+
+func (r *gormUsers) FailedLoginsFrom(ctx context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&db.AuditLog{}).
+		Where("action = ? AND ip_address = ? AND created_at >= ?", db.AuditLoginFailed, ip, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsers) Unlock(ctx context.Context, id uint, actor Actor) error {
+	changes := map[string]interface{}{"failed_logins": 0, "locked_until": nil}
+	return r.update(ctx, id, changes, userAudit(actor, db.AuditAccountUnlock, id, ""))
+}
+
+// update applies changes to one user and writes the audit entry in the same transaction
+func (r *gormUsers) update(ctx context.Context, id uint, changes map[string]interface{}, entry db.AuditLog) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updateUserTx(tx, id, changes, entry)
+	})
+}
+
+func updateUserTx(tx *gorm.DB, id uint, changes map[string]interface{}, entry db.AuditLog) error {
+	changes["version"] = gorm.Expr("version + 1")
+	res := tx.Model(&db.User{}).Where("id = ?", id).Updates(changes)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return db.WriteAudit(tx, entry)
+}
+
+func userAudit(actor Actor, action string, id uint, details string) db.AuditLog {
+	return db.AuditLog{
+		UserID:     actor.UserID,
+		UserEmail:  actor.Email,
+		Action:     action,
+		RecordType: RecordTypeUser,
+		RecordID:   id,
+		Details:    details,
+		IPAddress:  actor.IP,
+	}
+}
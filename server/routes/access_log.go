@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogHandler owns the QA report of who read which archive record
+type AccessLogHandler struct {
+	AccessLog repository.AccessLogRepository
+}
+
+const (
+	defaultAccessLogLimit = 100
+	maxAccessLogLimit     = 1000
+)
+
+// accessedRecord is satisfied by pointers to archive models
+type accessedRecord interface {
+	RecordID() uint
+	RecordEntity() string
+}
+
+// accessEntry describes a read of one record by the requesting user or API
+// key, with the purpose AccessPurpose stored
+func accessEntry(c *gin.Context, kind recordKind, access string, id uint, entity string) db.AccessLog {
+	return db.AccessLog{
+		UserID:      currentUserID(c),
+		UserEmail:   c.GetString("user_email"),
+		RecordType:  kind.Type,
+		RecordID:    id,
+		Entity:      entity,
+		Access:     access,
+		Purpose:    c.GetString("access_purpose"),
+		IPAddress:  c.ClientIP(),
+	}
+}
+
+// recordView logs a read of record before it is returned, answering 500
+// instead if the read cannot be logged
+func recordView(c *gin.Context, accessLog repository.AccessLogRepository, kind recordKind, record accessedRecord) bool {
+	entry := accessEntry(c, kind, db.AccessView, record.RecordID(), record.RecordEntity())
+	if err := accessLog.Record(c.Request.Context(), []db.AccessLog{entry}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// recordHistoryView is recordView for a version, or the list of versions
+// ending in v. The entity is taken from the snapshot, as versions outlive a
+// purge.
+func recordHistoryView(c *gin.Context, accessLog repository.AccessLogRepository, kind recordKind, v *db.RecordVersion) bool {
+	var snapshot struct {
+		Entity string `json:"entity"`
+	}
+	// a snapshot without an entity is still logged, under none
+	_ = json.Unmarshal([]byte(v.Data), &snapshot)
+	entry := accessEntry(c, kind, db.AccessHistory, v.RecordID, snapshot.Entity)
+	if err := accessLog.Record(c.Request.Context(), []db.AccessLog{entry}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// recordExport logs every record matching filter as exported before the
+// export starts, answering 500 instead if the export cannot be logged
+func recordExport[T any](c *gin.Context, repo repository.ArchiveRepository[T], kind recordKind, filter repository.ListFilter) bool {
+	entry := accessEntry(c, kind, db.AccessExport, 0, "")
+	query := c.Request.URL.Query()
+	query.Del("purpose")
+	entry.Filter = query.Encode()
+	if err := repo.LogExport(c.Request.Context(), filter, entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// ListAccessLog handles GET /api/access-log?record_type=&record_id=&user_id=&from=&to=&entity=&limit=,
+// the reads of archive records newest first: filter by record for its
+// access history, by user for everything they read
+func (h *AccessLogHandler) ListAccessLog(c *gin.Context) {
+	list, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := repository.AccessLogFilter{
+		RecordType: c.Query("record_type"),
+		Entity:     list.Entity,
+		Entities:   list.Entities,
+		Limit:      defaultAccessLogLimit,
+	}
+	switch filter.RecordType {
+	case "", repository.RecordTypeTestItem, repository.RecordTypeStudy, repository.RecordTypeFacilityDoc:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record_type: " + filter.RecordType + ", expected test_item, study or facility_doc"})
+		return
+	}
+	if s := c.Query("record_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || id == 0 || filter.RecordType == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "record_id must be a positive integer, with record_type"})
+			return
+		}
+		filter.RecordID = uint(id)
+	}
+	if s := c.Query("user_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID := uint(id)
+		filter.UserID = &userID
+	}
+	for _, bound := range []struct {
+		param string
+		into  *time.Time
+		days  int
+	}{{"from", &filter.From, 0}, {"to", &filter.To, 1}} {
+		s := strings.TrimSpace(c.Query(bound.param))
+		if s == "" {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be YYYY-MM-DD"})
+			return
+		}
+		*bound.into = day.AddDate(0, 0, bound.days)
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		filter.Limit = min(n, maxAccessLogLimit)
+	}
+
+	entries, err := h.AccessLog.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"access_log": entries})
+}
@@ -0,0 +1,102 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func TestAccessLog(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+	audit := apitest.Header{Name: "X-Access-Purpose", Value: "GLP audit 2024-07"}
+	itemPath := fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID)
+	studyPath := fmt.Sprintf("/api/studies/%d", fx.Studies["agro"].ID)
+
+	srv.Do(http.MethodGet, itemPath, nil, user, audit).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, studyPath+"?purpose=retrieval", nil, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/studies/export?format=csv&entity=agro", nil, user).Expect(http.StatusOK)
+	// lists and failed reads are not record accesses
+	srv.Do(http.MethodGet, "/api/test-items", nil, user).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/test-items/9999", nil, user).Expect(http.StatusNotFound)
+
+	history := func(query string) []map[string]interface{} {
+		t.Helper()
+		var out struct {
+			AccessLog []map[string]interface{} `json:"access_log"`
+		}
+		srv.Do(http.MethodGet, "/api/access-log"+query, nil, admin).Expect(http.StatusOK).Decode(&out)
+		return out.AccessLog
+	}
+	item := history(fmt.Sprintf("?record_type=test_item&record_id=%d", fx.TestItems["agro"].ID))
+	if len(item) != 1 || item[0]["user_email"] != "user@example.com" || item[0]["purpose"] != "GLP audit 2024-07" ||
+		item[0]["access"] != "view" || item[0]["ip_address"] == "" {
+		t.Fatalf("test item history = %v", item)
+	}
+	study := history(fmt.Sprintf("?record_type=study&record_id=%d", fx.Studies["agro"].ID))
+	if len(study) != 2 || study[0]["access"] != "export" || study[0]["entity"] != "agro" || study[0]["filter"] != "entity=agro&format=csv" ||
+		study[1]["user_email"] != "admin@example.com" || study[1]["purpose"] != "retrieval" {
+		t.Fatalf("study history = %v", study)
+	}
+	byUser := history(fmt.Sprintf("?user_id=%v", item[0]["user_id"]))
+	if len(byUser) != 2 {
+		t.Fatalf("user history = %v", byUser)
+	}
+	if n := len(history("?entity=adgyl")); n != 0 {
+		t.Fatalf("adgyl history has %d entries", n)
+	}
+	if n := len(history("?limit=1")); n != 1 {
+		t.Fatalf("limited history has %d entries", n)
+	}
+
+	// earlier versions are reads of the record too
+	srv.Do(http.MethodGet, itemPath+"/versions", nil, user).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, itemPath+"/versions?as_of="+url.QueryEscape(time.Now().Add(time.Minute).Format(time.RFC3339)), nil, user).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, itemPath+"/versions/1", nil, user).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, itemPath+"/diff?from=1&to=1", nil, user).Expect(http.StatusOK)
+	item = history(fmt.Sprintf("?record_type=test_item&record_id=%d", fx.TestItems["agro"].ID))
+	if len(item) != 5 {
+		t.Fatalf("test item history = %v", item)
+	}
+	for _, e := range item[:4] {
+		if e["access"] != "history" || e["entity"] != "agro" || e["user_email"] != "user@example.com" {
+			t.Fatalf("history entry = %v", e)
+		}
+	}
+	srv.Do(http.MethodGet, "/api/access-log?record_id=1", nil, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, "/api/access-log?from=yesterday", nil, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, "/api/access-log", nil).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, itemPath, nil).Expect(http.StatusUnauthorized)
+
+	srv.Config.AccessPurposeRequired = true
+	srv.Do(http.MethodGet, itemPath, nil, user).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, itemPath+"/versions", nil, user).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, itemPath, nil, user, audit).Expect(http.StatusOK)
+
+	// an export of every entity is logged per record, so QA limited to one
+	// entity sees the part of it in theirs
+	srv.Do(http.MethodGet, "/api/facility-docs/export?format=csv", nil, user, audit).Expect(http.StatusOK)
+	account := srv.CreateUser("qa@example.com", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/entities", account.ID), map[string][]string{"entities": {"adgyl"}}, admin).
+		Expect(http.StatusOK)
+	var qaView struct {
+		AccessLog []map[string]interface{} `json:"access_log"`
+	}
+	srv.Do(http.MethodGet, "/api/access-log?record_type=facility_doc", nil, apitest.Bearer(srv.Login("qa@example.com"))).
+		Expect(http.StatusOK).Decode(&qaView)
+	if len(qaView.AccessLog) != 1 || qaView.AccessLog[0]["entity"] != "adgyl" ||
+		qaView.AccessLog[0]["record_id"] != float64(fx.FacilityDocs["adgyl"].ID) {
+		t.Fatalf("adgyl QA sees %v", qaView.AccessLog)
+	}
+
+	// an export that cannot be logged is refused
+	srv.DB.Exec("DROP TABLE access_logs")
+	srv.Do(http.MethodGet, "/api/studies/export?format=csv", nil, user, audit).Expect(http.StatusInternalServerError)
+}
@@ -0,0 +1,587 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserAdminHandler owns the admin-only user management endpoints
+type UserAdminHandler struct {
+	Users    repository.UserRepository
+	Sessions repository.SessionRepository
+	MFA      repository.MFARepository
+	Config   *config.Config
+}
+
+// userView is a user together with their entity memberships and roles
+type userView struct {
+	db.User
+	Entities    []string      `json:"entities"`
+	EntityRoles []db.UserRole `json:"entity_roles"`
+}
+
+func (h *UserAdminHandler) views(c *gin.Context, users []db.User) ([]userView, error) {
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	memberships, err := h.Users.Entities(c.Request.Context(), ids...)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := h.Users.EntityRoles(c.Request.Context(), ids...)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]userView, len(users))
+	for i, u := range users {
+		views[i] = userView{User: u, Entities: memberships[u.ID], EntityRoles: roles[u.ID]}
+		if views[i].Entities == nil {
+			views[i].Entities = []string{}
+		}
+		if views[i].EntityRoles == nil {
+			views[i].EntityRoles = []db.UserRole{}
+		}
+	}
+	return views, nil
+}
+
+// respondUser reloads a user and writes it with its memberships
+func (h *UserAdminHandler) respondUser(c *gin.Context, id uint) {
+	user, err := h.Users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	views, err := h.views(c, []db.User{*user})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": views[0]})
+}
+
+func writeUserError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// ListUsers handles GET /api/admin/users?q=&role=&status=&entity=
+func (h *UserAdminHandler) ListUsers(c *gin.Context) {
+	filter := repository.UserFilter{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+		Entity: strings.ToLower(c.Query("entity")),
+	}
+	if filter.Role != "" && filter.Role != "user" && filter.Role != "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role: " + filter.Role})
+		return
+	}
+	switch filter.Status {
+	case "", repository.UserStatusActive, repository.UserStatusDisabled, repository.UserStatusPending, repository.UserStatusLocked:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + filter.Status + ", expected active, disabled, pending or locked"})
+		return
+	}
+	if filter.Entity != "" && !validEntities[filter.Entity] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entity: " + filter.Entity})
+		return
+	}
+
+	users, err := h.Users.Search(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	views, err := h.views(c, users)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": views})
+}
+
+// GetUser handles GET /api/admin/users/:id
+func (h *UserAdminHandler) GetUser(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	h.respondUser(c, id)
+}
+
+type setRoleReq struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// SetUserRole handles PUT /api/admin/users/:id/role. Only admins of every
+// entity may change base roles, and nobody their own.
+func (h *UserAdminHandler) SetUserRole(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req setRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if isSelf(c, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own role"})
+		return
+	}
+	// the base role applies in every entity the user belongs to
+	if !managesAllEntities(c) {
+		return
+	}
+	user, err := h.Users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	if req.Role == "admin" && user.Sponsor != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sponsor accounts cannot be admins"})
+		return
+	}
+
+	if err := h.Users.SetRole(c.Request.Context(), id, req.Role, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+// DeactivateUser handles POST /api/admin/users/:id/deactivate. The user's
+// tokens stop working immediately.
+func (h *UserAdminHandler) DeactivateUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// ActivateUser handles POST /api/admin/users/:id/activate
+func (h *UserAdminHandler) ActivateUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *UserAdminHandler) setDisabled(c *gin.Context, disabled bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if disabled && isSelf(c, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot deactivate your own account"})
+		return
+	}
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+
+	if err := h.Users.SetDisabled(c.Request.Context(), id, disabled, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+// ApproveUser handles POST /api/admin/users/:id/approve, letting a pending
+// signup sign in. Admins who belong to entities may only approve signups for
+// those entities.
+func (h *UserAdminHandler) ApproveUser(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	memberships, err := h.Users.Entities(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !managesEntity(c, memberships[id]...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only approve users of entities you administer"})
+		return
+	}
+
+	switch err := h.Users.Approve(c.Request.Context(), id, requestActor(c)); {
+	case errors.Is(err, repository.ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+type setEntitiesReq struct {
+	Entities []string `json:"entities" binding:"required"`
+}
+
+// SetUserEntities handles PUT /api/admin/users/:id/entities, replacing the
+// user's memberships; an empty list removes them all, which gives the user
+// their base role in every entity. Admins must administer the entities the
+// user has and gets, and nobody may change their own.
+func (h *UserAdminHandler) SetUserEntities(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req setEntitiesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if isSelf(c, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own entities"})
+		return
+	}
+
+	seen := map[string]bool{}
+	entities := []string{}
+	for _, e := range req.Entities {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !validEntities[e] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entity: " + e})
+			return
+		}
+		if !seen[e] {
+			seen[e] = true
+			entities = append(entities, e)
+		}
+	}
+	sort.Strings(entities)
+
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+	if len(entities) == 0 && !managesAllEntities(c) {
+		return
+	}
+	for _, e := range entities {
+		if !managesEntity(c, e) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only manage users of entities you administer"})
+			return
+		}
+	}
+	if err := h.Users.SetEntities(c.Request.Context(), id, entities, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+type entityRoleReq struct {
+	Entity string `json:"entity" binding:"required"`
+	Role   string `json:"role" binding:"required"`
+}
+
+type setEntityRolesReq struct {
+	Roles []entityRoleReq `json:"roles" binding:"required,dive"`
+}
+
+// SetUserEntityRoles handles PUT /api/admin/users/:id/roles, replacing the
+// roles the user holds in particular entities ("*" for every entity) on top
+// of their base role. Only admins of every entity the user belongs to may
+// change them, only in entities they administer, and nobody their own.
+func (h *UserAdminHandler) SetUserEntityRoles(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req setEntityRolesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if isSelf(c, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own roles"})
+		return
+	}
+
+	seen := map[string]bool{}
+	wanted := []db.UserRole{}
+	for _, r := range req.Roles {
+		entity := strings.ToLower(strings.TrimSpace(r.Entity))
+		if entity != db.AllEntities && !validEntities[entity] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entity: " + entity})
+			return
+		}
+		key := entity + ":" + r.Role
+		if !seen[key] {
+			seen[key] = true
+			wanted = append(wanted, db.UserRole{Entity: entity, Role: r.Role})
+		}
+	}
+	sort.Slice(wanted, func(i, j int) bool {
+		if wanted[i].Entity != wanted[j].Entity {
+			return wanted[i].Entity < wanted[j].Entity
+		}
+		return wanted[i].Role < wanted[j].Role
+	})
+
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+	current, err := h.Users.EntityRoles(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	had := map[string]bool{}
+	for _, r := range current[id] {
+		had[r.Entity+":"+r.Role] = true
+		if !seen[r.Entity+":"+r.Role] && !managesEntity(c, r.Entity) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only change roles in entities you administer"})
+			return
+		}
+	}
+	for _, r := range wanted {
+		if !had[r.Entity+":"+r.Role] && !managesEntity(c, r.Entity) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only change roles in entities you administer"})
+			return
+		}
+	}
+
+	switch err := h.Users.SetEntityRoles(c.Request.Context(), id, wanted, requestActor(c)); {
+	case errors.Is(err, repository.ErrRoleUnknown):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+type setSponsorReq struct {
+	Sponsor *string `json:"sponsor" binding:"required"`
+}
+
+// SetUserSponsor handles PUT /api/admin/users/:id/sponsor. A sponsor account
+// only reaches the sponsor portal, for the records of its company; an empty
+// sponsor makes it a staff account again.
+func (h *UserAdminHandler) SetUserSponsor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req setSponsorReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// sponsor accounts see every entity's records of their company
+	if !managesAllEntities(c) {
+		return
+	}
+	if isSelf(c, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own sponsor"})
+		return
+	}
+	sponsor := strings.TrimSpace(*req.Sponsor)
+	user, err := h.Users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	if sponsor != "" && user.Role == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot be sponsor accounts"})
+		return
+	}
+
+	if err := h.Users.SetSponsor(c.Request.Context(), id, sponsor, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+type resetPasswordReq struct {
+	Password string `json:"password"`
+}
+
+// ResetUserPassword handles POST /api/admin/users/:id/reset-password. Without
+// a password in the body a temporary one is generated and returned once.
+// Either way the user must change it at their next sign-in.
+func (h *UserAdminHandler) ResetUserPassword(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req resetPasswordReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, ok := h.managesUser(c, id)
+	if !ok {
+		return
+	}
+	if !user.HasLocalPassword() {
+		c.JSON(http.StatusConflict, gin.H{"error": "password is managed by the user's " + user.AuthProvider + " directory account"})
+		return
+	}
+
+	policy := h.Config.PasswordPolicy()
+	password, generated := req.Password, false
+	if password != "" && !checkNewPassword(c, h.Users, policy, id, password) {
+		return
+	}
+	if password == "" {
+		var err error
+		if password, err = utils.GeneratePassword(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate password"})
+			return
+		}
+		generated = true
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	opts := repository.PasswordUpdate{MustChange: true, Keep: policy.History - 1}
+	if err := h.Users.SetPassword(c.Request.Context(), id, hash, opts, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	resp := gin.H{"message": "password reset"}
+	if generated {
+		resp["temporary_password"] = password
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UnlockUser handles POST /api/admin/users/:id/unlock, lifting a lockout
+// caused by failed sign-ins
+func (h *UserAdminHandler) UnlockUser(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+	if err := h.Users.Unlock(c.Request.Context(), id, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+// ResetUserMFA handles POST /api/admin/users/:id/reset-mfa for a user who
+// lost their authenticator and recovery codes. They sign in with the
+// password alone and, if MFA is required for them, must enroll again.
+func (h *UserAdminHandler) ResetUserMFA(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+	if err := h.MFA.Disable(c.Request.Context(), id, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	h.respondUser(c, id)
+}
+
+// RevokeUserSessions handles POST /api/admin/users/:id/revoke-sessions,
+// signing the user out everywhere. Their access tokens stop working at once.
+func (h *UserAdminHandler) RevokeUserSessions(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := h.managesUser(c, id); !ok {
+		return
+	}
+	revoked, err := h.Sessions.RevokeUser(c.Request.Context(), id, requestActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked_sessions": revoked})
+}
+
+// managesUser loads user id and checks that the requesting user administers
+// every entity the user holds permissions in: their memberships and entity
+// roles. Users without memberships hold their base role everywhere, so only
+// admins of every entity manage them. It answers 404 or 403 otherwise.
+func (h *UserAdminHandler) managesUser(c *gin.Context, id uint) (*db.User, bool) {
+	user, err := h.Users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		writeUserError(c, err)
+		return nil, false
+	}
+	memberships, err := h.Users.Entities(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	roles, err := h.Users.EntityRoles(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	entities := memberships[id]
+	if len(entities) == 0 {
+		entities = []string{db.AllEntities}
+	}
+	for _, r := range roles[id] {
+		entities = append(entities, r.Entity)
+	}
+	for _, e := range entities {
+		if e == db.AllEntities {
+			if !managesAllEntities(c) {
+				return nil, false
+			}
+			continue
+		}
+		if !managesEntity(c, e) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only manage users of entities you administer"})
+			return nil, false
+		}
+	}
+	return user, true
+}
+
+// isSelf reports whether id is the requesting user
+func isSelf(c *gin.Context, id uint) bool {
+	current := currentUserID(c)
+	return current != nil && *current == id
+}
+
+// managesEntity reports whether the requesting user may manage users in any
+// of entities: those where they hold the manage-users permission, which
+// users holding it in every entity may do anywhere
+func managesEntity(c *gin.Context, entities ...string) bool {
+	permitted, limited := permittedEntities(c)
+	if !limited {
+		return true
+	}
+	for _, e := range entities {
+		if slices.Contains(permitted, e) {
+			return true
+		}
+	}
+	return false
+}
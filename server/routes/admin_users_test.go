@@ -0,0 +1,222 @@
+package routes_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+)
+
+func userPath(id uint, suffix string) string {
+	return "/api/admin/users/" + strconv.FormatUint(uint64(id), 10) + suffix
+}
+
+func TestAdminUsersRequireAdmin(t *testing.T) {
+	srv := apitest.New(t)
+
+	srv.Do(http.MethodGet, "/api/admin/users", nil).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusForbidden)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(srv.AdminToken())).Expect(http.StatusOK)
+}
+
+func TestListAndSearchUsers(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	alice := srv.CreateUser("alice@agro.example.com", "user")
+	srv.CreateUser("bob@biopharma.example.com", "user")
+	srv.Do(http.MethodPut, userPath(alice.ID, "/entities"), map[string][]string{"entities": {"agro"}}, admin).
+		Expect(http.StatusOK)
+
+	count := func(query string) int {
+		t.Helper()
+		return len(srv.Do(http.MethodGet, "/api/admin/users"+query, nil, admin).Expect(http.StatusOK).
+			JSON()["users"].([]interface{}))
+	}
+	if n := count(""); n != 3 {
+		t.Fatalf("all users = %d, want 3", n)
+	}
+	if n := count("?q=AGRO"); n != 1 {
+		t.Fatalf("q=AGRO matched %d, want 1", n)
+	}
+	if n := count("?role=admin"); n != 1 {
+		t.Fatalf("role=admin matched %d, want 1", n)
+	}
+	if n := count("?entity=agro"); n != 1 {
+		t.Fatalf("entity=agro matched %d, want 1", n)
+	}
+	if n := count("?q=100%25"); n != 0 {
+		t.Fatalf("LIKE wildcard in q matched %d, want 0", n)
+	}
+
+	srv.Do(http.MethodGet, "/api/admin/users?status=gone", nil, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, "/api/admin/users?entity=pharma", nil, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, "/api/admin/users/9999", nil, admin).Expect(http.StatusNotFound)
+}
+
+func TestChangeRoleTakesEffectImmediately(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+	u, _ := srv.Repos.Users.FindByEmail(t.Context(), "user@example.com")
+
+	srv.Do(http.MethodGet, "/api/studies/deleted", nil, user).Expect(http.StatusForbidden)
+	res := srv.Do(http.MethodPut, userPath(u.ID, "/role"), map[string]string{"role": "admin"}, admin).
+		Expect(http.StatusOK).JSON()["user"].(map[string]interface{})
+	if res["role"] != "admin" {
+		t.Fatalf("role = %v", res["role"])
+	}
+	// the token issued while the user was a plain user now carries admin rights
+	srv.Do(http.MethodGet, "/api/studies/deleted", nil, user).Expect(http.StatusOK)
+
+	srv.Do(http.MethodPut, userPath(u.ID, "/role"), map[string]string{"role": "root"}, admin).Expect(http.StatusBadRequest)
+}
+
+func TestDeactivatedUsersTokensAreRejected(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+	u, _ := srv.Repos.Users.FindByEmail(t.Context(), "user@example.com")
+
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, user).Expect(http.StatusOK)
+	res := srv.Do(http.MethodPost, userPath(u.ID, "/deactivate"), nil, admin).Expect(http.StatusOK).
+		JSON()["user"].(map[string]interface{})
+	if res["disabled_at"] == nil {
+		t.Fatalf("deactivated user has no disabled_at: %v", res)
+	}
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, user).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": "user@example.com", "password": apitest.Password}).
+		Expect(http.StatusForbidden)
+
+	srv.Do(http.MethodPost, userPath(u.ID, "/activate"), nil, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, user).Expect(http.StatusOK)
+
+	if n := len(srv.Do(http.MethodGet, "/api/admin/users?status=disabled", nil, admin).JSON()["users"].([]interface{})); n != 0 {
+		t.Fatalf("%d disabled users after reactivation", n)
+	}
+}
+
+func TestAdminsCannotLockThemselvesOut(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	me, _ := srv.Repos.Users.FindByEmail(t.Context(), "admin@example.com")
+
+	srv.Do(http.MethodPost, userPath(me.ID, "/deactivate"), nil, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPut, userPath(me.ID, "/role"), map[string]string{"role": "user"}, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPut, userPath(me.ID, "/role"), map[string]string{"role": "admin"}, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPut, userPath(me.ID, "/entities"), map[string][]string{"entities": {"agro"}}, admin).Expect(http.StatusBadRequest)
+}
+
+func TestEntityMembership(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	u := srv.CreateUser("member@example.com", "user")
+
+	res := srv.Do(http.MethodPut, userPath(u.ID, "/entities"), map[string][]string{"entities": {"Biopharma", "adgyl", "adgyl"}}, admin).
+		Expect(http.StatusOK).JSON()["user"].(map[string]interface{})
+	if got := res["entities"].([]interface{}); len(got) != 2 || got[0] != "adgyl" || got[1] != "biopharma" {
+		t.Fatalf("entities = %v", got)
+	}
+
+	res = srv.Do(http.MethodPut, userPath(u.ID, "/entities"), map[string][]string{"entities": {}}, admin).
+		Expect(http.StatusOK).JSON()["user"].(map[string]interface{})
+	if got := res["entities"].([]interface{}); len(got) != 0 {
+		t.Fatalf("entities after clearing = %v", got)
+	}
+
+	srv.Do(http.MethodPut, userPath(u.ID, "/entities"), map[string][]string{"entities": {"pharma"}}, admin).
+		Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPut, userPath(9999, "/entities"), map[string][]string{"entities": {"agro"}}, admin).
+		Expect(http.StatusNotFound)
+}
+
+func TestForcedPasswordReset(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	u := srv.CreateUser("forgetful@example.com", "user")
+
+	res := srv.Do(http.MethodPost, userPath(u.ID, "/reset-password"), nil, admin).Expect(http.StatusOK).JSON()
+	temp, _ := res["temporary_password"].(string)
+	if temp == "" {
+		t.Fatalf("no temporary password returned: %v", res)
+	}
+	srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": u.Email, "password": apitest.Password}).
+		Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": u.Email, "password": temp}).
+		Expect(http.StatusOK)
+
+	res = srv.Do(http.MethodPost, userPath(u.ID, "/reset-password"), map[string]string{"password": "Chosen-by-admin-1"}, admin).
+		Expect(http.StatusOK).JSON()
+	if _, ok := res["temporary_password"]; ok {
+		t.Fatal("temporary password returned for an explicit password")
+	}
+	srv.Do(http.MethodPost, userPath(u.ID, "/reset-password"), map[string]string{"password": "short"}, admin).
+		Expect(http.StatusBadRequest)
+}
+
+func TestEntityAdminsOnlyManageTheirUsers(t *testing.T) {
+	srv := apitest.New(t)
+	global := apitest.Bearer(srv.AdminToken())
+	member := func(email, role string, entities ...string) uint {
+		u := srv.CreateUser(email, role)
+		srv.Do(http.MethodPut, userPath(u.ID, "/entities"), map[string][]string{"entities": entities}, global).
+			Expect(http.StatusOK)
+		return u.ID
+	}
+	lead := member("agro-lead@example.com", "admin", "agro")
+	agroAdmin := apitest.Bearer(srv.Login("agro-lead@example.com"))
+	agroUser := member("agro@example.com", "user", "agro")
+	adgylUser := member("adgyl@example.com", "user", "adgyl")
+	everywhere := srv.CreateUser("everywhere@example.com", "user").ID
+	// a member of agro holding a role in adgyl as well
+	mixed := member("mixed@example.com", "user", "agro")
+	srv.Do(http.MethodPut, userPath(mixed, "/roles"), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "adgyl", "role": "archivist"}},
+	}, global).Expect(http.StatusOK)
+
+	for _, action := range []struct{ method, suffix string }{
+		{http.MethodPost, "/deactivate"},
+		{http.MethodPost, "/activate"},
+		{http.MethodPost, "/reset-password"},
+		{http.MethodPost, "/unlock"},
+		{http.MethodPost, "/reset-mfa"},
+		{http.MethodPost, "/revoke-sessions"},
+	} {
+		for _, id := range []uint{adgylUser, everywhere, mixed} {
+			srv.Do(action.method, userPath(id, action.suffix), nil, agroAdmin).Expect(http.StatusForbidden)
+		}
+		srv.Do(action.method, userPath(agroUser, action.suffix), nil, agroAdmin).Expect(http.StatusOK)
+		srv.Do(action.method, userPath(adgylUser, action.suffix), nil, global).Expect(http.StatusOK)
+	}
+
+	// base roles apply in every entity of the user
+	srv.Do(http.MethodPut, userPath(agroUser, "/role"), map[string]string{"role": "admin"}, agroAdmin).Expect(http.StatusForbidden)
+	srv.Do(http.MethodPut, userPath(lead, "/role"), map[string]string{"role": "admin"}, agroAdmin).Expect(http.StatusBadRequest)
+
+	// memberships may only move between entities the admin administers;
+	// none at all means every entity
+	entities := func(id uint, tok apitest.Header, status int, list ...string) {
+		t.Helper()
+		srv.Do(http.MethodPut, userPath(id, "/entities"), map[string][]string{"entities": append([]string{}, list...)}, tok).Expect(status)
+	}
+	entities(agroUser, agroAdmin, http.StatusForbidden, "agro", "adgyl")
+	entities(agroUser, agroAdmin, http.StatusForbidden)
+	entities(adgylUser, agroAdmin, http.StatusForbidden, "agro")
+	entities(everywhere, agroAdmin, http.StatusForbidden, "agro")
+	entities(lead, agroAdmin, http.StatusBadRequest, "agro", "adgyl")
+	entities(agroUser, agroAdmin, http.StatusOK, "agro")
+
+	// entity roles likewise, even in an entity the admin administers
+	roles := func(id uint, status int) {
+		t.Helper()
+		srv.Do(http.MethodPut, userPath(id, "/roles"), map[string]interface{}{
+			"roles": []map[string]string{{"entity": "agro", "role": "archivist"}},
+		}, agroAdmin).Expect(status)
+	}
+	roles(everywhere, http.StatusForbidden)
+	roles(adgylUser, http.StatusForbidden)
+	roles(mixed, http.StatusForbidden)
+	roles(agroUser, http.StatusOK)
+
+	entities(agroUser, global, http.StatusOK)
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler owns the admin-only API key endpoints
+type APIKeyHandler struct {
+	Keys   repository.APIKeyRepository
+	Users  repository.UserRepository
+	Config *config.Config
+}
+
+// apiKeyView is a key with its scopes and its status at the time of the request
+type apiKeyView struct {
+	db.APIKey
+	Scopes []string `json:"scopes"`
+	Status string   `json:"status"`
+}
+
+func newAPIKeyView(key db.APIKey, now time.Time) apiKeyView {
+	return apiKeyView{APIKey: key, Scopes: key.ScopeList(), Status: key.Status(now)}
+}
+
+type createAPIKeyReq struct {
+	Name      string     `json:"name" binding:"required"`
+	Entity    string     `json:"entity" binding:"required,oneof=adgyl agro biopharma"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=test_items:read test_items:write export"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey handles POST /api/admin/api-keys. The key is returned only in
+// this response, for the admin to configure in the integration.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if !managesEntity(c, req.Entity) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only create API keys for entities you administer"})
+		return
+	}
+
+	now := time.Now()
+	latest := now.Add(h.Config.APIKeyMaxAge)
+	expiresAt := latest
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) || req.ExpiresAt.After(latest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future and within " + h.Config.APIKeyMaxAge.String()})
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	secret, hash, prefix, err := utils.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate key"})
+		return
+	}
+	key := db.APIKey{
+		Name:      name,
+		Entity:    req.Entity,
+		Scopes:    strings.Join(canonicalScopes(req.Scopes), ","),
+		Prefix:    prefix,
+		KeyHash:   hash,
+		CreatedBy: currentUserID(c),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if err := h.Keys.Create(c.Request.Context(), &key, requestActor(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"api_key": newAPIKeyView(key, now), "key": secret})
+}
+
+// ListAPIKeys handles GET /api/admin/api-keys?status=, limited to the
+// entities the admin administers
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", db.APIKeyActive, db.APIKeyRevoked, db.APIKeyExpired:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + status + ", expected active, revoked or expired"})
+		return
+	}
+
+	keys, err := h.Keys.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	views := []apiKeyView{}
+	for _, key := range keys {
+		v := newAPIKeyView(key, now)
+		if managesEntity(c, key.Entity) && (status == "" || v.Status == status) {
+			views = append(views, v)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": views})
+}
+
+// RevokeAPIKey handles DELETE /api/admin/api-keys/:id. The key is refused
+// from the next request on.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	key, err := h.Keys.Get(c.Request.Context(), id)
+	if err != nil {
+		writeAPIKeyError(c, err)
+		return
+	}
+	if !managesEntity(c, key.Entity) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only revoke API keys of entities you administer"})
+		return
+	}
+
+	if err := h.Keys.Revoke(c.Request.Context(), id, requestActor(c)); err != nil {
+		writeAPIKeyError(c, err)
+		return
+	}
+	if key, err = h.Keys.Get(c.Request.Context(), id); err != nil {
+		writeAPIKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_key": newAPIKeyView(*key, time.Now())})
+}
+
+// canonicalScopes returns the requested scopes once each, in the order of
+// db.APIKeyScopes
+func canonicalScopes(requested []string) []string {
+	var scopes []string
+	for _, s := range db.APIKeyScopes {
+		for _, r := range requested {
+			if r == s {
+				scopes = append(scopes, s)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+func writeAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+	case errors.Is(err, repository.ErrAPIKeyRevoked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,130 @@
+package routes_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+	"eurofines-server/repository"
+)
+
+// createAPIKey has an admin create a key and returns its id and secret
+func createAPIKey(t *testing.T, srv *apitest.Server, entity string, scopes ...string) (uint, string) {
+	t.Helper()
+	var res struct {
+		APIKey struct {
+			ID     uint     `json:"id"`
+			Prefix string   `json:"prefix"`
+			Scopes []string `json:"scopes"`
+			Status string   `json:"status"`
+		} `json:"api_key"`
+		Key string `json:"key"`
+	}
+	srv.Do(http.MethodPost, "/api/admin/api-keys", map[string]interface{}{"name": "LIMS", "entity": entity, "scopes": scopes},
+		apitest.Bearer(srv.AdminToken())).Expect(http.StatusCreated).Decode(&res)
+	if !strings.HasPrefix(res.Key, res.APIKey.Prefix) || res.APIKey.Status != db.APIKeyActive || len(res.APIKey.Scopes) != len(scopes) {
+		t.Fatalf("created %+v", res)
+	}
+	return res.APIKey.ID, res.Key
+}
+
+func TestAPIKeyReadsOwnEntity(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	_, secret := createAPIKey(t, srv, "agro", db.ScopeTestItemsRead, db.ScopeExport)
+	key := apitest.Bearer(secret)
+
+	list := srv.Do(http.MethodGet, "/api/test-items", nil, key).Expect(http.StatusOK).JSON()["test_items"].([]interface{})
+	if len(list) != 1 || list[0].(map[string]interface{})["entity"] != "agro" {
+		t.Fatalf("key listed %v", list)
+	}
+	srv.Do(http.MethodGet, "/api/test-items?entity=adgyl", nil, key).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID), nil, key).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/test-items/%d", fx.TestItems["adgyl"].ID), nil, key).Expect(http.StatusNotFound)
+
+	rows, err := csv.NewReader(srv.Do(http.MethodGet, "/api/studies/export?format=csv", nil, key).Expect(http.StatusOK).Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("export: %v, %v", rows, err)
+	}
+
+	// keys only work where a scope allows them
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "x", "entity": "agro"}, key).
+		Expect(http.StatusForbidden)
+	srv.Do(http.MethodGet, "/api/search?q=calibration", nil, key).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, key).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(secret+"x")).Expect(http.StatusUnauthorized)
+
+	// user tokens are unchanged on the same routes, and a token is required
+	srv.Do(http.MethodGet, "/api/test-items", nil).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/test-items/export?format=csv", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusOK)
+}
+
+func TestAPIKeyWritesAreAudited(t *testing.T) {
+	srv := apitest.New(t)
+	_, secret := createAPIKey(t, srv, "agro", db.ScopeTestItemsWrite)
+	key := apitest.Bearer(secret)
+
+	created := srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "Scanned", "entity": "agro"}, key).
+		Expect(http.StatusCreated).JSON()["test_item"].(map[string]interface{})
+	path := fmt.Sprintf("/api/test-items/%d", uint(created["id"].(float64)))
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "Other", "entity": "adgyl"}, key).
+		Expect(http.StatusForbidden)
+	srv.Do(http.MethodPatch, path, map[string]interface{}{"entity": "adgyl", "version": 1}, key).Expect(http.StatusForbidden)
+	srv.Do(http.MethodPatch, path, map[string]interface{}{"storage": "Shelf 4", "version": 1}, key).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, path, nil, key).Expect(http.StatusForbidden)
+
+	versions, err := srv.Repos.TestItems.Versions(context.Background(), uint(created["id"].(float64)))
+	if err != nil || len(versions) != 2 || versions[1].ChangedByEmail != "api-key:LIMS" {
+		t.Fatalf("versions %+v, %v", versions, err)
+	}
+}
+
+func TestAPIKeyExpiryAndRevocation(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	srv.Do(http.MethodPost, "/api/admin/api-keys", map[string]interface{}{"name": "old", "entity": "agro",
+		"scopes": []string{db.ScopeExport}, "expires_at": time.Now().Add(-time.Hour)}, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, "/api/admin/api-keys", map[string]interface{}{"name": "bad", "entity": "agro",
+		"scopes": []string{"delete_everything"}}, admin).Expect(http.StatusBadRequest)
+
+	id, secret := createAPIKey(t, srv, "agro", db.ScopeTestItemsRead)
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(secret)).Expect(http.StatusOK)
+	listed := srv.Do(http.MethodGet, "/api/admin/api-keys?status=active", nil, admin).Expect(http.StatusOK).
+		JSON()["api_keys"].([]interface{})
+	if len(listed) != 1 || listed[0].(map[string]interface{})["last_used_at"] == nil || listed[0].(map[string]interface{})["key_hash"] != nil {
+		t.Fatalf("listed %v", listed)
+	}
+
+	srv.Do(http.MethodDelete, fmt.Sprintf("/api/admin/api-keys/%d", id), nil, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, fmt.Sprintf("/api/admin/api-keys/%d", id), nil, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(secret)).Expect(http.StatusUnauthorized)
+
+	_, expiring := createAPIKey(t, srv, "agro", db.ScopeTestItemsRead)
+	srv.DB.Model(&db.APIKey{}).Where("key_hash <> ''").Update("expires_at", time.Now().Add(-time.Minute))
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(expiring)).Expect(http.StatusUnauthorized)
+}
+
+func TestAPIKeysAreScopedToEntityAdmins(t *testing.T) {
+	srv := apitest.New(t)
+	createAPIKey(t, srv, "adgyl", db.ScopeExport)
+	agroAdmin := srv.CreateUser("agro-admin@example.com", "admin")
+	if err := srv.Repos.Users.SetEntities(context.Background(), agroAdmin.ID, []string{"agro"}, repository.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	token := apitest.Bearer(srv.Login(agroAdmin.Email))
+
+	srv.Do(http.MethodPost, "/api/admin/api-keys", map[string]interface{}{"name": "printer", "entity": "adgyl",
+		"scopes": []string{db.ScopeExport}}, token).Expect(http.StatusForbidden)
+	listed := srv.Do(http.MethodGet, "/api/admin/api-keys", nil, token).Expect(http.StatusOK).JSON()["api_keys"].([]interface{})
+	if len(listed) != 0 {
+		t.Fatalf("agro admin sees %v", listed)
+	}
+	srv.Do(http.MethodGet, "/api/admin/api-keys", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusForbidden)
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID returns the authenticated user's id, or nil on public routes
+func currentUserID(c *gin.Context) *uint {
+	if v, ok := c.Get("user_id"); ok {
+		if id, ok := v.(uint); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// requestActor attributes a change to the requesting user for the audit log
+// and version history
+func requestActor(c *gin.Context) repository.Actor {
+	return repository.Actor{
+		UserID: currentUserID(c),
+		Email:  c.GetString("user_email"),
+		IP:     c.ClientIP(),
+	}
+}
@@ -1,29 +1,66 @@
 package routes
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"eurofines-server/auth"
+	"eurofines-server/config"
 	"eurofines-server/db"
+	"eurofines-server/mail"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type signupReq struct {
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
-	Role      string `json:"role" binding:"required,oneof=user admin"`
-	FullName  string `json:"full_name"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	// Role is accepted for older clients; signup only ever creates plain users
+	Role        string `json:"role" binding:"omitempty,oneof=user"`
+	FullName    string `json:"full_name"`
+	Entity      string `json:"entity" binding:"omitempty,oneof=adgyl agro biopharma"`
+	InviteToken string `json:"invite_token"`
 }
 
-// SignUp creates a new user (password hashed)
+// SignUp creates a plain user account as allowed by the signup mode: with an
+// invitation token, or (in approval mode) as a request an admin must approve
 func (h *AuthHandler) SignUp(c *gin.Context) {
+	if h.Config.SignupMode == config.SignupDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "self-service signup is disabled; ask an administrator for an account"})
+		return
+	}
+
 	var req signupReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkNewPassword(c, h.Users, h.Config.PasswordPolicy(), 0, req.Password) {
+		return
+	}
+
+	if req.InviteToken == "" && h.Config.SignupMode == config.SignupInvite {
+		c.JSON(http.StatusForbidden, gin.H{"error": "an invitation is required to sign up"})
+		return
+	}
+	if req.InviteToken == "" && req.Entity == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entity is required"})
+		return
+	}
+
+	if _, err := h.Users.FindByEmail(c.Request.Context(), req.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already registered"})
+		return
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// hash password
 	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -32,21 +69,38 @@ func (h *AuthHandler) SignUp(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
 	user := db.User{
 		Email: req.Email,
 		Password: string(hashed),
-		Role: req.Role,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Role: "user",
+		Version: 1,
+		PasswordChangedAt: &now,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	if err := db.DB.Create(&user).Error; err != nil {
+	if req.InviteToken != "" {
+		_, err = h.Invitations.Accept(c.Request.Context(), utils.HashToken(req.InviteToken), &user, requestActor(c))
+	} else {
+		user.PendingApproval = true
+		err = h.Users.Register(c.Request.Context(), &user, req.Entity, requestActor(c))
+	}
+	switch {
+	case errors.Is(err, repository.ErrInvitationUnusable), errors.Is(err, repository.ErrInvitationEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// hide password
 	user.Password = ""
+	if user.PendingApproval {
+		c.JSON(http.StatusCreated, gin.H{"user": user, "message": "account created; an administrator must approve it before you can sign in"})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"user": user})
 }
 
@@ -55,7 +109,11 @@ type signinReq struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// SignIn verifies credentials and returns user info (or token if you implement JWT)
+// SignIn verifies credentials with the configured providers and returns user
+// info with a JWT. A first sign-in through an external provider creates the
+// local account. Failed attempts are throttled per IP address and lock the
+// account after LockoutThreshold wrong passwords in a row; every attempt is
+// audited.
 func (h *AuthHandler) SignIn(c *gin.Context) {
 	var req signinReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -63,28 +121,322 @@ func (h *AuthHandler) SignIn(c *gin.Context) {
 		return
 	}
 
-	var user db.User
-	if err := db.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error":"invalid credentials"})
+	ctx := c.Request.Context()
+	actor := requestActor(c)
+	actor.Email = req.Email
+	policy := repository.LockoutPolicy{Threshold: h.Config.LockoutThreshold, Duration: h.Config.LockoutDuration}
+
+	if h.throttled(c, actor.IP) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	user, err := h.Users.FindByEmail(ctx, req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// not yet known here, but an external provider may know them
+		user = nil
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user != nil {
+		actor.UserID = &user.ID
+		if h.locked(c, user, policy, actor) {
+			return
+		}
+	}
+
+	identity, err := h.Auth.Authenticate(ctx, req.Email, req.Password, user)
+	switch {
+	case errors.Is(err, auth.ErrUnknownUser), errors.Is(err, auth.ErrInvalidCredentials):
+		reason := repository.LoginFailedPassword
+		if user == nil {
+			reason = repository.LoginFailedUnknown
+		}
+		if _, err := h.Users.RecordFailedLogin(ctx, user, reason, policy, actor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error":"invalid credentials"})
 		return
+	case errors.Is(err, auth.ErrNotPermitted):
+		if _, err := h.Users.RecordFailedLogin(ctx, user, repository.LoginFailedDenied, policy, actor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("sign-in for %s: %v", req.Email, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sign-in service is unavailable; try again later"})
+		return
+	}
+
+	if identity.Provider != db.ProviderLocal {
+		account := repository.ExternalAccount{
+			Provider: identity.Provider,
+			Email:    identity.Email,
+			Role:     identity.Role,
+			Entities: identity.Entities,
+		}
+		provisioned, err := h.Users.Provision(ctx, account, actor)
+		if errors.Is(err, repository.ErrProviderMismatch) {
+			// as for single sign-on, the provider may not take over the account
+			if _, err := h.Users.RecordFailedLogin(ctx, user, repository.LoginFailedProvider, policy, actor); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "an account with this email address already signs in another way"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user = provisioned
+		actor.UserID = &user.ID
+	}
+	h.finishSignIn(c, user, actor)
+}
+
+// finishSignIn admits a user whose credentials were accepted: it refuses
+// disabled and unapproved accounts, asks for the second factor if enrolled
+// and otherwise opens a session
+func (h *AuthHandler) finishSignIn(c *gin.Context, user *db.User, actor repository.Actor) {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+		return
+	}
+	if user.PendingApproval {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is pending approval"})
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		h.challengeMFA(c, user)
+		return
+	}
+
+	if err := h.Users.RecordLogin(c.Request.Context(), user.ID, actor); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	user.FailedLogins, user.LockedUntil = 0, nil
+	h.startSession(c, user, false)
+}
+
+// throttled answers 429 and returns true after too many failed sign-ins from
+// ip, whichever accounts they targeted
+func (h *AuthHandler) throttled(c *gin.Context, ip string) bool {
+	failures, err := h.Users.FailedLoginsFrom(c.Request.Context(), ip, time.Now().Add(-h.Config.LoginIPWindow))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if failures >= int64(h.Config.LoginIPLimit) {
+		c.Header("Retry-After", strconv.Itoa(int(h.Config.LoginIPWindow.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed sign-in attempts; try again later"})
+		return true
+	}
+	return false
+}
+
+// locked answers 423 and returns true if user is locked out; the attempt is audited
+func (h *AuthHandler) locked(c *gin.Context, user *db.User, policy repository.LockoutPolicy, actor repository.Actor) bool {
+	if user.LockedUntil == nil || !time.Now().Before(*user.LockedUntil) {
+		return false
+	}
+	if _, err := h.Users.RecordFailedLogin(c.Request.Context(), user, repository.LoginFailedLocked, policy, actor); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(*user.LockedUntil).Seconds())+1))
+	c.JSON(http.StatusLocked, gin.H{"error": "account is temporarily locked after too many failed sign-ins", "locked_until": user.LockedUntil})
+	return true
+}
+
+// startSession opens a session for user and responds with its tokens; mfa
+// records that the user passed a second factor
+func (h *AuthHandler) startSession(c *gin.Context, user *db.User, mfa bool) {
+	refresh, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	session := db.Session{
+		UserID:      user.ID,
+		RefreshHash: hash,
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(h.Config.RefreshExpiry),
+		MFAVerified: mfa,
+	}
+	if err := h.Sessions.Create(c.Request.Context(), &session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.Tokens.GenerateToken(user.ID, user.Email, user.Role, session.ID, mfa)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	mfaRequired, err := mfaRequired(c.Request.Context(), h.Users, h.Config, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// if you have JWT: create token here and return it
 	user.Password = ""
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{
+		"user":          user,
+		"token":         token,
+		"refresh_token": refresh,
+		"expires_in":    int(h.Tokens.Expiry().Seconds()),
+		// until it is changed the token only works for change-password and logout
+		"must_change_password": user.HasLocalPassword() && (user.MustChangePassword || h.Config.PasswordPolicy().Expired(user.PasswordSetAt(), time.Now())),
+		"mfa_verified":         mfa,
+		// admin endpoints stay closed until a second factor is set up
+		"mfa_enrollment_required": mfaRequired && user.MFAEnabledAt == nil,
+	})
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword handles POST /api/auth/change-password for the signed-in
+// user. The new password must meet the policy and differ from the recent
+// ones; a successful change clears must_change_password and restarts expiry.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id := c.GetUint("user_id")
+	user, err := h.Users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	if !user.HasLocalPassword() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is managed by your " + user.AuthProvider + " directory account"})
+		return
+	}
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	policy := h.Config.PasswordPolicy()
+	if !checkNewPassword(c, h.Users, policy, id, req.NewPassword) {
+		return
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+	opts := repository.PasswordUpdate{Keep: policy.History - 1}
+	if err := h.Users.SetPassword(c.Request.Context(), id, hash, opts, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
 }
 
-// GetCurrentUser returns the current user (stub — replace with auth middleware)
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token; the old refresh token stops working. Reusing an old refresh token
+// revokes the whole session.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req refreshReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refresh, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	session, err := h.Sessions.Rotate(c.Request.Context(), utils.HashToken(req.RefreshToken), hash)
+	switch {
+	case errors.Is(err, repository.ErrSessionInvalid), errors.Is(err, repository.ErrRefreshReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.Users.FindByID(c.Request.Context(), session.UserID)
+	if err != nil || user.DisabledAt != nil || user.PendingApproval {
+		if err == nil || errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "account is no longer active"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.Tokens.GenerateToken(user.ID, user.Email, user.Role, session.ID, session.MFAVerified)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refresh,
+		"expires_in":    int(h.Tokens.Expiry().Seconds()),
+	})
+}
+
+// Logout ends the caller's session: its refresh token and every access token
+// issued for it stop working, including the one used for this request
+func (h *AuthHandler) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	if sid := c.GetUint("session_id"); sid != 0 {
+		if err := h.Sessions.Revoke(ctx, sid, repository.RevokeLogout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if jti := c.GetString("token_id"); jti != "" {
+		if err := h.Sessions.RevokeToken(ctx, jti, c.GetTime("token_expires_at")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetCurrentUser handles GET /api/auth/me: the signed-in account and the
+// permissions it holds in each entity
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
-	// If you use middleware to set userID in context, read it here.
-	// For now, return a sample or require created_by in body.
-	c.JSON(http.StatusOK, gin.H{"message": "implement auth middleware to return current user"})
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	grants, _ := c.Get("grants")
+	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"user": user, "grants": grants})
 }
 
-// optional: handler struct (not strictly necessary but consistent)
-type AuthHandler struct{}
+// AuthHandler owns sign-up, sign-in and sessions; Tokens issues the JWTs
+type AuthHandler struct {
+	Users       repository.UserRepository
+	Invitations repository.InvitationRepository
+	Sessions    repository.SessionRepository
+	Resets      repository.PasswordResetRepository
+	MFA         repository.MFARepository
+	OIDCLogins  repository.OIDCLoginRepository
+	Auth        *auth.Authenticator
+	Tokens      *utils.TokenManager
+	Mailer      mail.Mailer
+	Config      *config.Config
+}
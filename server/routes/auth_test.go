@@ -0,0 +1,120 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"eurofines-server/config"
+	"eurofines-server/internal/apitest"
+)
+
+func TestSignUpAwaitsApproval(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.SignupMode = config.SignupApproval
+
+	res := srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "new@example.com", "password": apitest.Password, "role": "user", "entity": "agro",
+	}).Expect(http.StatusCreated).JSON()
+	user := res["user"].(map[string]interface{})
+	if user["email"] != "new@example.com" || user["role"] != "user" || user["pending_approval"] != true {
+		t.Fatalf("signup returned %v", user)
+	}
+	if _, ok := user["password"]; ok {
+		t.Fatal("signup response exposes the password hash")
+	}
+
+	signin := map[string]string{"email": "NEW@example.com", "password": apitest.Password}
+	srv.Do(http.MethodPost, "/api/auth/signin", signin).Expect(http.StatusForbidden)
+
+	admin := apitest.Bearer(srv.AdminToken())
+	pending := srv.Do(http.MethodGet, "/api/admin/users?status=pending", nil, admin).Expect(http.StatusOK).
+		JSON()["users"].([]interface{})
+	if len(pending) != 1 {
+		t.Fatalf("pending users = %v", pending)
+	}
+	id := uint(pending[0].(map[string]interface{})["id"].(float64))
+	srv.Do(http.MethodPost, userPath(id, "/approve"), nil, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodPost, userPath(id, "/approve"), nil, admin).Expect(http.StatusConflict)
+
+	res = srv.Do(http.MethodPost, "/api/auth/signin", signin).Expect(http.StatusOK).JSON()
+	if tok, _ := res["token"].(string); tok == "" {
+		t.Fatalf("signin returned no token: %v", res)
+	}
+}
+
+func TestSignUpCannotRequestAdmin(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.SignupMode = config.SignupApproval
+
+	srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "sneaky@example.com", "password": apitest.Password, "role": "admin", "entity": "agro",
+	}).Expect(http.StatusBadRequest)
+	if _, err := srv.Repos.Users.FindByEmail(t.Context(), "sneaky@example.com"); err == nil {
+		t.Fatal("signup with role admin created an account")
+	}
+}
+
+func TestSignUpModes(t *testing.T) {
+	srv := apitest.New(t)
+	body := map[string]string{"email": "new@example.com", "password": apitest.Password, "entity": "agro"}
+
+	srv.Config.SignupMode = config.SignupDisabled
+	srv.Do(http.MethodPost, "/api/auth/signup", body).Expect(http.StatusForbidden)
+
+	srv.Config.SignupMode = config.SignupInvite
+	srv.Do(http.MethodPost, "/api/auth/signup", body).Expect(http.StatusForbidden)
+
+	srv.Config.SignupMode = config.SignupApproval
+	srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{"email": "new@example.com", "password": apitest.Password}).
+		Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, "/api/auth/signup", body).Expect(http.StatusCreated)
+	srv.Do(http.MethodPost, "/api/auth/signup", body).Expect(http.StatusConflict)
+}
+
+func TestSignInRejectsBadCredentials(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("someone@example.com", "user")
+
+	for name, body := range map[string]map[string]string{
+		"wrong password": {"email": "someone@example.com", "password": "not-the-password"},
+		"unknown email":  {"email": "nobody@example.com", "password": apitest.Password},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv.Do(http.MethodPost, "/api/auth/signin", body).Expect(http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestSignUpValidation(t *testing.T) {
+	srv := apitest.New(t)
+
+	for name, body := range map[string]interface{}{
+		"invalid email":  map[string]string{"email": "not-an-email", "password": apitest.Password, "role": "user"},
+		"short password": map[string]string{"email": "a@example.com", "password": "123", "role": "user"},
+		"unknown role":   map[string]string{"email": "a@example.com", "password": apitest.Password, "role": "root"},
+		"admin role":     map[string]string{"email": "a@example.com", "password": apitest.Password, "role": "admin"},
+		"missing fields": map[string]string{},
+		"malformed json": `{"email":`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv.Do(http.MethodPost, "/api/auth/signup", body).Expect(http.StatusBadRequest)
+		})
+	}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	srv := apitest.New(t)
+
+	srv.Do(http.MethodGet, "/api/test-items/export", nil).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Header{Name: "Authorization", Value: "Token abc"}).
+		Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer("not.a.jwt")).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusOK)
+}
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	srv := apitest.New(t)
+
+	srv.Do(http.MethodGet, "/api/studies/deleted", nil, apitest.Bearer(srv.UserToken())).Expect(http.StatusForbidden)
+	srv.Do(http.MethodGet, "/api/studies/deleted", nil, apitest.Bearer(srv.AdminToken())).Expect(http.StatusOK)
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionedModel is satisfied by pointers to archive models with an
+// optimistic-locking version
+type versionedModel[T any] interface {
+	*T
+	db.Versioned
+	RecordID() uint
+	RecordEntity() string
+}
+
+// etag formats a record version as a strong entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// writeETag sets the ETag header for a record and reports whether the
+// client's If-None-Match already matches it
+func writeETag(c *gin.Context, version int) (notModified bool) {
+	tag := etag(version)
+	c.Header("ETag", tag)
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		if strings.TrimSpace(candidate) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion returns the version the client based its edit on, taken
+// from If-Match or else the body's "version" field. Updates without either
+// are rejected with 428 so that blind overwrites cannot happen.
+func expectedVersion(c *gin.Context, bodyVersion *int) (int, bool) {
+	if h := strings.TrimSpace(c.GetHeader("If-Match")); h != "" {
+		h = strings.Trim(strings.TrimPrefix(h, "W/"), `"`)
+		n, err := strconv.Atoi(h)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+			return 0, false
+		}
+		return n, true
+	}
+	if bodyVersion != nil {
+		return *bodyVersion, true
+	}
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header or version field is required"})
+	return 0, false
+}
+
+// getRecord handles GET /:id, answering 304 when If-None-Match matches the
+// ETag. Every read is logged in accessLog, including revalidations.
+func getRecord[T any, PT versionedModel[T]](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T], accessLog repository.AccessLogRepository) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	record, err := repo.Get(c.Request.Context(), id)
+	if err != nil {
+		writeRecordError(c, kind, err)
+		return
+	}
+	if !recordAllowed(c, PT(record)) {
+		writeRecordError(c, kind, repository.ErrNotFound)
+		return
+	}
+	if !recordView(c, accessLog, kind, PT(record)) {
+		return
+	}
+	if writeETag(c, PT(record).CurrentVersion()) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{kind.Singular: record})
+}
+
+// writeConflict answers a stale write with 409 and the current server state
+func writeConflict(c *gin.Context, kind recordKind, current interface{}, version int) {
+	c.Header("ETag", etag(version))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":       repository.ErrStaleVersion.Error(),
+		"current":     current,
+		"version":     version,
+		"record_type": kind.Type,
+	})
+}
+
+// updateRecord applies updates only if the stored row is still at the
+// expected version; the repository bumps the version and saves a snapshot.
+// A stale write gets 409 with the current state so the client can merge.
+func updateRecord[T any, PT versionedModel[T]](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T], id uint, expected int, updates map[string]interface{}) {
+	record, err := repo.Update(c.Request.Context(), id, expected, updates, requestActor(c))
+	if errors.Is(err, repository.ErrStaleVersion) {
+		current, err := repo.Get(c.Request.Context(), id)
+		if err != nil {
+			writeRecordError(c, kind, err)
+			return
+		}
+		writeConflict(c, kind, current, PT(current).CurrentVersion())
+		return
+	}
+	if err != nil {
+		writeRecordError(c, kind, err)
+		return
+	}
+
+	c.Header("ETag", etag(PT(record).CurrentVersion()))
+	c.JSON(http.StatusOK, gin.H{kind.Singular: record})
+}
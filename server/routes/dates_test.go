@@ -0,0 +1,53 @@
+package routes_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func TestDatesRoundTripThroughAPIAndDatabase(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	item := fx.TestItems["adgyl"]
+
+	// JSON in -> JSON out
+	if got := item.DateOfReceipt; got == nil || got.Time().Format("2006-01-02") != "2024-01-15" {
+		t.Fatalf("created date_of_receipt = %v", got)
+	}
+	if item.RetestDate != nil {
+		t.Fatalf("unset retest_date = %v, want null", item.RetestDate)
+	}
+
+	// JSON in -> SQL -> Go
+	var stored db.TestItem
+	if err := srv.DB.First(&stored, item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ExpiryDate == nil || stored.ExpiryDate.Time().Format("2006-01-02") != "2026-01-15" {
+		t.Fatalf("stored expiry_date = %v", stored.ExpiryDate)
+	}
+
+	// RFC3339 input is accepted and normalised to a date; "" clears
+	path := "/api/studies/" + strconv.FormatUint(uint64(fx.Studies["agro"].ID), 10)
+	user := apitest.Bearer(srv.UserToken())
+	res := srv.Do(http.MethodPatch, path, map[string]interface{}{
+		"study_completion_date": "2024-06-30T00:00:00Z",
+		"date_of_receipt":       "",
+		"version":               1,
+	}, user).Expect(http.StatusOK).JSON()["study"].(map[string]interface{})
+	if res["study_completion_date"] != "2024-06-30" || res["date_of_receipt"] != nil {
+		t.Fatalf("updated dates = %v / %v", res["study_completion_date"], res["date_of_receipt"])
+	}
+
+	reread := srv.Do(http.MethodGet, path, nil, user).Expect(http.StatusOK).JSON()["study"].(map[string]interface{})
+	if reread["study_completion_date"] != "2024-06-30" || reread["date_of_receipt"] != nil {
+		t.Fatalf("re-read dates = %v / %v", reread["study_completion_date"], reread["date_of_receipt"])
+	}
+
+	srv.Do(http.MethodPatch, path, map[string]interface{}{"study_completion_date": "30/06/2024", "version": 2}, user).
+		Expect(http.StatusBadRequest)
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DisposalHandler owns the staff side of disposal requests: asking a test
+// item's sponsor to approve its disposal or return, and following up on
+// the answers
+type DisposalHandler struct {
+	Disposals repository.DisposalRequestRepository
+	TestItems repository.TestItemRepository
+}
+
+// disposalView is a request with its status
+type disposalView struct {
+	db.DisposalRequest
+	Status string `json:"status"`
+}
+
+func newDisposalViews(list []db.DisposalRequest) []disposalView {
+	views := make([]disposalView, len(list))
+	for i, r := range list {
+		views[i] = disposalView{DisposalRequest: r, Status: r.Status()}
+	}
+	return views
+}
+
+type disposalReq struct {
+	Action string `json:"action" binding:"required,oneof=dispose return"`
+	Note   string `json:"note"`
+}
+
+// RequestDisposal handles POST /api/test-items/:id/disposal-requests. The
+// request goes to the sponsor named in the test item's company name.
+func (h *DisposalHandler) RequestDisposal(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req disposalReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkRecordEntity(c, testItemKind, h.TestItems, id) {
+		return
+	}
+	item, err := h.TestItems.Get(c.Request.Context(), id)
+	if err != nil {
+		writeRecordError(c, testItemKind, err)
+		return
+	}
+	if strings.TrimSpace(item.CompanyName) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "test item has no company name to ask for approval"})
+		return
+	}
+
+	request := db.DisposalRequest{
+		TestItemID:  id,
+		Action:      req.Action,
+		Note:        strings.TrimSpace(req.Note),
+		RequestedBy: currentUserID(c),
+	}
+	if err := h.Disposals.Create(c.Request.Context(), &request, requestActor(c)); err != nil {
+		writeDisposalError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"disposal_request": disposalView{DisposalRequest: request, Status: request.Status()}})
+}
+
+// ListDisposals handles GET /api/disposal-requests?status=&entity=
+func (h *DisposalHandler) ListDisposals(c *gin.Context) {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status, ok := parseDisposalStatus(c)
+	if !ok {
+		return
+	}
+	entities := filter.Entities
+	if filter.Entity != "" {
+		entities = []string{filter.Entity}
+	}
+
+	list, err := h.Disposals.List(c.Request.Context(), repository.DisposalFilter{Entities: entities, Status: status})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disposal_requests": newDisposalViews(list)})
+}
+
+func parseDisposalStatus(c *gin.Context) (string, bool) {
+	status := c.Query("status")
+	switch status {
+	case "", db.DisposalPending, db.DisposalApproved:
+		return status, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + status + ", expected pending or approved"})
+	return "", false
+}
+
+func writeDisposalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "disposal request not found"})
+	case errors.Is(err, repository.ErrDisposalPending), errors.Is(err, repository.ErrDisposalApproved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,118 @@
+package routes_test
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func TestListsAreScopedByEntity(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	user := apitest.Bearer(srv.UserToken())
+
+	for _, reg := range registers {
+		all := srv.Do(http.MethodGet, reg.path, nil, user).Expect(http.StatusOK).JSON()[reg.plural].([]interface{})
+		if len(all) != len(apitest.Entities) {
+			t.Fatalf("%s: unfiltered list has %d records, want %d", reg.plural, len(all), len(apitest.Entities))
+		}
+		for _, entity := range apitest.Entities {
+			list := srv.Do(http.MethodGet, reg.path+"?entity="+strings.ToUpper(entity), nil, user).Expect(http.StatusOK).
+				JSON()[reg.plural].([]interface{})
+			if len(list) != 1 || list[0].(map[string]interface{})["entity"] != entity {
+				t.Fatalf("%s?entity=%s returned %v", reg.plural, entity, list)
+			}
+		}
+	}
+}
+
+func TestExportIsScopedByEntity(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+
+	res := srv.Do(http.MethodGet, "/api/test-items/export?format=csv&entity=agro", nil, apitest.Bearer(srv.UserToken())).
+		Expect(http.StatusOK)
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("export has %d rows, want header and one record: %v", len(rows), rows)
+	}
+	if rows[1][1] != fx.TestItems["agro"].TestItemName {
+		t.Fatalf("exported %v, want the agro test item", rows[1])
+	}
+}
+
+func TestListsRequireIndexPermission(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	account := srv.CreateUser("viewer@acme.example", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/sponsor", account.ID), map[string]string{"sponsor": "Acme Pharma"}, admin).
+		Expect(http.StatusOK)
+	sponsor := apitest.Bearer(srv.Login("viewer@acme.example"))
+
+	for _, reg := range registers {
+		srv.Do(http.MethodGet, reg.path, nil).Expect(http.StatusUnauthorized)
+		srv.Do(http.MethodGet, reg.path, nil, sponsor).Expect(http.StatusForbidden)
+	}
+
+	srv.Do(http.MethodGet, "/api/auth/me", nil).Expect(http.StatusUnauthorized)
+	me := srv.Do(http.MethodGet, "/api/auth/me", nil, sponsor).Expect(http.StatusOK).JSON()["user"].(map[string]interface{})
+	if me["email"] != "viewer@acme.example" {
+		t.Fatalf("me = %v", me)
+	}
+}
+
+func TestSearchIsScopedByEntity(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	user := apitest.Bearer(srv.UserToken())
+
+	results := srv.Do(http.MethodGet, "/api/search?q=calibration", nil, user).Expect(http.StatusOK).
+		JSON()["results"].([]interface{})
+	if len(results) != len(apitest.Entities) {
+		t.Fatalf("search found %d facility docs, want %d", len(results), len(apitest.Entities))
+	}
+
+	results = srv.Do(http.MethodGet, "/api/search?q=calibration&entity=biopharma", nil, user).Expect(http.StatusOK).
+		JSON()["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("scoped search returned %v", results)
+	}
+	hit := results[0].(map[string]interface{})
+	if hit["entity"] != "biopharma" || hit["type"] != "facility_doc" ||
+		!strings.Contains(hit["snippet"].(string), "<mark>calibration</mark>") {
+		t.Fatalf("unexpected hit %v", hit)
+	}
+
+	srv.Do(http.MethodGet, "/api/search?q=calibration&entity=pharma", nil, user).Expect(http.StatusBadRequest)
+}
+
+func TestSearchSnippetIsEscaped(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	srv.Do(http.MethodPost, "/api/facility-docs", map[string]interface{}{
+		"particulars": `Balance <script>alert("x")</script> calibration & check`, "dept_section": "QC", "entity": "agro",
+	}, admin).Expect(http.StatusCreated)
+
+	results := srv.Do(http.MethodGet, "/api/search?q=calibration", nil, admin).Expect(http.StatusOK).
+		JSON()["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("results = %v", results)
+	}
+	snippet := results[0].(map[string]interface{})["snippet"].(string)
+	if strings.Contains(snippet, "<script>") || !strings.Contains(snippet, "&lt;script&gt;") ||
+		!strings.Contains(snippet, "<mark>calibration</mark> &amp; check") {
+		t.Fatalf("snippet = %q", snippet)
+	}
+}
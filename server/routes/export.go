@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/export"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportColumn maps one register column to a value of record type T
+type exportColumn[T any] struct {
+	Header string
+	Value  func(*T) string
+}
+
+func formatDate(d *db.Date) string {
+	if d == nil || d.IsZero() {
+		return ""
+	}
+	return d.Time().Format("2006-01-02")
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+func formatIntPtr(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+var testItemExportColumns = []exportColumn[db.TestItem]{
+	{"ID", func(t *db.TestItem) string { return strconv.FormatUint(uint64(t.ID), 10) }},
+	{"Test Item Name", func(t *db.TestItem) string { return t.TestItemName }},
+	{"Test Item Code", func(t *db.TestItem) string { return t.TestItemCode }},
+	{"Company Name", func(t *db.TestItem) string { return t.CompanyName }},
+	{"Date of Receipt", func(t *db.TestItem) string { return formatDate(t.DateOfReceipt) }},
+	{"Batch No", func(t *db.TestItem) string { return t.BatchNo }},
+	{"ARC No", func(t *db.TestItem) string { return t.ArcNo }},
+	{"Rack No", func(t *db.TestItem) string { return t.RackNo }},
+	{"Index No", func(t *db.TestItem) string { return t.IndexNo }},
+	{"Storage", func(t *db.TestItem) string { return t.Storage }},
+	{"Expiry Date", func(t *db.TestItem) string { return formatDate(t.ExpiryDate) }},
+	{"Retest Date", func(t *db.TestItem) string { return formatDate(t.RetestDate) }},
+	{"Quantity", func(t *db.TestItem) string { return t.Quantity }},
+	{"Date of Archive", func(t *db.TestItem) string { return formatDate(t.DateOfArchive) }},
+	{"Archived By", func(t *db.TestItem) string { return t.ArchivedBy }},
+	{"Disposed/Returned", func(t *db.TestItem) string { return t.DisposedOrReturned }},
+	{"Sponsor Approval Date", func(t *db.TestItem) string { return formatDate(t.SponsorApprovalDate) }},
+	{"Remark", func(t *db.TestItem) string { return t.Remark }},
+	{"Entity", func(t *db.TestItem) string { return t.Entity }},
+}
+
+var studyExportColumns = []exportColumn[db.Study]{
+	{"ID", func(s *db.Study) string { return strconv.FormatUint(uint64(s.ID), 10) }},
+	{"Study Number", func(s *db.Study) string { return s.StudyNumber }},
+	{"Study Code", func(s *db.Study) string { return s.StudyCode }},
+	{"Test Item Code", func(s *db.Study) string { return s.TestItemCode }},
+	{"SD/PI Name", func(s *db.Study) string { return s.SdOrPiName }},
+	{"Date of Receipt", func(s *db.Study) string { return formatDate(s.DateOfReceipt) }},
+	{"RD Index", func(s *db.Study) string { return s.RdIndex }},
+	{"FR Index", func(s *db.Study) string { return s.FrIndex }},
+	{"Block/Slides Index", func(s *db.Study) string { return s.BlockSlidesIndex }},
+	{"Tissues Index", func(s *db.Study) string { return s.TissuesIndex }},
+	{"Carcass Index", func(s *db.Study) string { return s.CarcassIndex }},
+	{"Raw Data Count", func(s *db.Study) string { return strconv.Itoa(s.RawDataCount) }},
+	{"Final/Terminated Report", func(s *db.Study) string { return s.FinalOrTerminatedReport }},
+	{"Electronic Data", func(s *db.Study) string { return formatBool(s.ElectronicDataArchivedUsingArchiveSystem) }},
+	{"Study Completion Date", func(s *db.Study) string { return formatDate(s.StudyCompletionDate) }},
+	{"Remarks", func(s *db.Study) string { return s.Remarks }},
+	{"Entity", func(s *db.Study) string { return s.Entity }},
+}
+
+var facilityDocExportColumns = []exportColumn[db.FacilityDoc]{
+	{"ID", func(f *db.FacilityDoc) string { return strconv.FormatUint(uint64(f.ID), 10) }},
+	{"Dept/Section", func(f *db.FacilityDoc) string { return f.DeptSection }},
+	{"Date", func(f *db.FacilityDoc) string { return formatDate(f.Date) }},
+	{"Particulars", func(f *db.FacilityDoc) string { return f.Particulars }},
+	{"Total Pages", func(f *db.FacilityDoc) string { return formatIntPtr(f.TotalNoOfPages) }},
+	{"Submitted By", func(f *db.FacilityDoc) string { return f.SubmittedBy }},
+	{"Admin Index No", func(f *db.FacilityDoc) string { return f.AdminIndexNo }},
+	{"Admin Date of Receipt", func(f *db.FacilityDoc) string { return formatDate(f.AdminDateOfReceipt) }},
+	{"Admin Date of Indexing", func(f *db.FacilityDoc) string { return formatDate(f.AdminDateOfIndexing) }},
+	{"Admin Remarks", func(f *db.FacilityDoc) string { return f.AdminRemarks }},
+	{"Entity", func(f *db.FacilityDoc) string { return f.Entity }},
+}
+
+// ExportTestItems handles GET /api/test-items/export?format=csv|xlsx|pdf
+func (h *TestItemHandler) ExportTestItems(c *gin.Context) {
+	streamExport(c, h.Repo, testItemKind, "Test Item Register", "test-items", testItemExportColumns)
+}
+
+// ExportStudies handles GET /api/studies/export?format=csv|xlsx|pdf
+func (h *StudyHandler) ExportStudies(c *gin.Context) {
+	streamExport(c, h.Repo, studyKind, "Study Register", "studies", studyExportColumns)
+}
+
+// ExportFacilityDocs handles GET /api/facility-docs/export?format=csv|xlsx|pdf
+func (h *FacilityDocHandler) ExportFacilityDocs(c *gin.Context) {
+	streamExport(c, h.Repo, facilityDocKind, "Facility Document Register", "facility-docs", facilityDocExportColumns)
+}
+
+// streamExport writes every record matching the list filters in the
+// requested format. Records are read from a cursor and handed to the writer
+// one at a time, so the result set is never loaded into memory at once.
+// Every record is logged as exported before the export starts, and the
+// export is refused if it cannot be.
+func streamExport[T any](c *gin.Context, repo repository.ArchiveRepository[T], kind recordKind, title, filePrefix string, columns []exportColumn[T]) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !recordExport(c, repo, kind, filter) {
+		return
+	}
+
+	meta := export.Meta{
+		Title:       title,
+		Entity:      filter.Entity,
+		GeneratedAt: time.Now(),
+		GeneratedBy: c.GetString("user_email"),
+	}
+
+	w, err := export.NewWriter(format, c.Writer, meta)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The status line only goes out with the first bytes the writer flushes,
+	// so until then a failure can still be answered with a JSON error.
+	filename := fmt.Sprintf("%s-%s.%s", filePrefix, meta.GeneratedAt.Format("20060102-150405"), format.Extension())
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.Header
+	}
+	if err = w.WriteHeader(headers); err == nil {
+		values := make([]string, len(columns))
+		err = repo.Stream(c.Request.Context(), filter, func(record *T) error {
+			for i, col := range columns {
+				values[i] = col.Value(record)
+			}
+			return w.WriteRow(values)
+		})
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		// Once rows have reached the client the status line is already sent,
+		// so failures can only be logged and the response cut short.
+		log.Printf("export %s failed: %v", filePrefix, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		c.Abort()
+	}
+}
@@ -0,0 +1,139 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportCSV(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	user := apitest.Bearer(srv.UserToken())
+
+	res := srv.Do(http.MethodGet, "/api/test-items/export?entity=agro", nil, user).Expect(http.StatusOK)
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("content type = %q", ct)
+	}
+	if cd := res.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="test-items-`) {
+		t.Fatalf("content disposition = %q", cd)
+	}
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 2 || rows[0][1] != "Test Item Name" || rows[1][1] != "agro reference standard" {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	srv.Do(http.MethodGet, "/api/studies/export?format=doc", nil, user).Expect(http.StatusBadRequest)
+}
+
+func TestExportXLSX(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	user := apitest.Bearer(srv.UserToken())
+
+	res := srv.Do(http.MethodGet, "/api/studies/export?format=xlsx", nil, user).Expect(http.StatusOK)
+	f, err := excelize.OpenReader(res.Body)
+	if err != nil {
+		t.Fatalf("open xlsx: %v", err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Register")
+	if err != nil {
+		t.Fatalf("read rows: %v", err)
+	}
+	// title, entity, generated at and by, spacer, column header, one study per entity
+	if len(rows) != 6+len(apitest.Entities) || rows[0][0] != "Study Register" || rows[1][1] != "All entities" {
+		t.Fatalf("rows = %v", rows)
+	}
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+		"test_item_name": "+1 buffer", "company_name": `=HYPERLINK("http://evil.example","x")`, "remark": "@SUM(A1)", "entity": "agro",
+	}, admin).Expect(http.StatusCreated)
+	want := map[string]string{
+		"Test Item Name": "'+1 buffer",
+		"Company Name":   `'=HYPERLINK("http://evil.example","x")`,
+		"Remark":         "'@SUM(A1)",
+		"Entity":         "agro",
+	}
+	check := func(format string, header, row []string) {
+		t.Helper()
+		for i, col := range header {
+			if v, ok := want[col]; ok && row[i] != v {
+				t.Errorf("%s %s = %q, want %q", format, col, row[i], v)
+			}
+		}
+	}
+
+	res := srv.Do(http.MethodGet, "/api/test-items/export?format=csv", nil, admin).Expect(http.StatusOK)
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("csv rows = %v, %v", rows, err)
+	}
+	check("csv", rows[0], rows[1])
+
+	res = srv.Do(http.MethodGet, "/api/test-items/export?format=xlsx", nil, admin).Expect(http.StatusOK)
+	f, err := excelize.OpenReader(res.Body)
+	if err != nil {
+		t.Fatalf("open xlsx: %v", err)
+	}
+	defer f.Close()
+	rows, err = f.GetRows("Register")
+	if err != nil || len(rows) != 7 {
+		t.Fatalf("xlsx rows = %v, %v", rows, err)
+	}
+	check("xlsx", rows[5], rows[6])
+}
+
+func TestExportPDF(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+
+	res := srv.Do(http.MethodGet, "/api/facility-docs/export?format=pdf", nil, user).Expect(http.StatusOK)
+	body := res.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Fatalf("empty export is not a PDF: %q", body)
+	}
+	if !bytes.Contains(body, []byte("/Count 1 ")) {
+		t.Fatalf("empty export should have one page")
+	}
+
+	// more rows than fit on one page
+	for i := 0; i < 40; i++ {
+		srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+			"test_item_name": fmt.Sprintf("Item (%d)", i), "test_item_code": fmt.Sprintf("TI-%03d", i), "entity": "agro",
+		}, admin).Expect(http.StatusCreated)
+	}
+	res = srv.Do(http.MethodGet, "/api/test-items/export?format=pdf&entity=agro", nil, user).Expect(http.StatusOK)
+	if ct := res.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Fatalf("content type = %q", ct)
+	}
+	body = res.Body.Bytes()
+	for _, want := range []string{"/Count 2 ", "(Page 1 of ) Tj", "(Page 2 of ) Tj", "(2) Tj", `(Item \(39\)) Tj`, "(Test Item Register - AGRO) Tj"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Fatalf("PDF does not contain %q", want)
+		}
+	}
+	// the cross-reference table must point at the objects
+	var xref int
+	if _, err := fmt.Sscanf(string(body[bytes.LastIndex(body, []byte("startxref\n")):]), "startxref\n%d", &xref); err != nil {
+		t.Fatalf("startxref: %v", err)
+	}
+	if !bytes.HasPrefix(body[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+}
@@ -4,12 +4,19 @@ import (
 	"net/http"
 	"time"
 
+	"eurofines-server/config"
 	"eurofines-server/db"
+	"eurofines-server/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-type FacilityDocHandler struct{}
+type FacilityDocHandler struct {
+	Repo      repository.FacilityDocRepository
+	Personnel repository.PersonnelRepository
+	AccessLog repository.AccessLogRepository
+	Config    *config.Config
+}
 
 type createFacilityReq struct {
 	DeptSection    string  `json:"dept_section"`
@@ -17,6 +24,7 @@ type createFacilityReq struct {
 	Particulars    string  `json:"particulars"`
 	TotalNoOfPages *int    `json:"total_no_of_pages"`
 	SubmittedBy    string  `json:"submitted_by"`
+	SubmittedByID  *uint   `json:"submitted_by_id"`
 	Entity         string  `json:"entity" binding:"required,oneof=adgyl agro biopharma"`
 	CreatedBy      *uint   `json:"created_by"`
 }
@@ -28,6 +36,11 @@ func (h *FacilityDocHandler) CreateFacilityDoc(c *gin.Context) {
 		return
 	}
 
+	if !entityAllowed(c, req.Entity) {
+		writeEntityDenied(c, req.Entity)
+		return
+	}
+
 	fd := db.FacilityDoc{
 		DeptSection: req.DeptSection,
 		Particulars: req.Particulars,
@@ -35,9 +48,17 @@ func (h *FacilityDocHandler) CreateFacilityDoc(c *gin.Context) {
 		SubmittedBy: req.SubmittedBy,
 		Entity: req.Entity,
 		CreatedBy: req.CreatedBy,
+		Version: 1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if req.SubmittedByID != nil {
+		person, ok := personFor(c, h.Personnel, *req.SubmittedByID, "submitted_by_id")
+		if !ok {
+			return
+		}
+		fd.SubmittedByID, fd.SubmittedBy = &person.ID, person.Name
+	}
 
 	if req.Date != nil && *req.Date != "" {
 		var d db.Date
@@ -46,7 +67,7 @@ func (h *FacilityDocHandler) CreateFacilityDoc(c *gin.Context) {
 		}
 	}
 
-	if err := db.DB.Create(&fd).Error; err != nil {
+	if err := h.Repo.Create(c.Request.Context(), &fd, requestActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -54,10 +75,129 @@ func (h *FacilityDocHandler) CreateFacilityDoc(c *gin.Context) {
 }
 
 func (h *FacilityDocHandler) GetFacilityDocs(c *gin.Context) {
-	var docs []db.FacilityDoc
-	if err := db.DB.Order("created_at desc").Find(&docs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	listRecords(c, facilityDocKind, h.Repo)
+}
+
+// GetFacilityDoc handles GET /api/facility-docs/:id
+func (h *FacilityDocHandler) GetFacilityDoc(c *gin.Context) {
+	getRecord(c, facilityDocKind, h.Repo, h.AccessLog)
+}
+
+type updateFacilityReq struct {
+	DeptSection         *string `json:"dept_section"`
+	Date                *string `json:"date"`
+	Particulars         *string `json:"particulars"`
+	TotalNoOfPages      *int    `json:"total_no_of_pages"`
+	SubmittedBy         *string `json:"submitted_by"`
+	SubmittedByID       *uint   `json:"submitted_by_id"`
+	AdminIndexNo        *string `json:"admin_index_no"`
+	AdminDateOfReceipt  *string `json:"admin_date_of_receipt"`
+	AdminDateOfIndexing *string `json:"admin_date_of_indexing"`
+	AdminRemarks        *string `json:"admin_remarks"`
+	Entity              *string `json:"entity" binding:"omitempty,oneof=adgyl agro biopharma"`
+	Version             *int    `json:"version"`
+}
+
+// UpdateFacilityDoc handles PUT/PATCH /api/facility-docs/:id. The client must
+// send the version it edited via If-Match or the version field.
+func (h *FacilityDocHandler) UpdateFacilityDoc(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	current, err := h.Repo.Get(c.Request.Context(), id)
+	if err != nil {
+		writeRecordError(c, facilityDocKind, err)
+		return
+	}
+	if !entityAllowed(c, current.Entity) {
+		writeRecordError(c, facilityDocKind, repository.ErrNotFound)
+		return
+	}
+
+	var req updateFacilityReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"facility_docs": docs})
+
+	u := partialUpdate{}
+	u.setString("dept_section", req.DeptSection)
+	u.setString("particulars", req.Particulars)
+	u.setInt("total_no_of_pages", req.TotalNoOfPages)
+	u.setString("submitted_by", req.SubmittedBy)
+	// submitted_by_id 0 unlinks the person, keeping the name
+	if req.SubmittedByID != nil && *req.SubmittedByID == 0 {
+		u["submitted_by_id"] = nil
+	} else if req.SubmittedByID != nil {
+		person, ok := personFor(c, h.Personnel, *req.SubmittedByID, "submitted_by_id")
+		if !ok {
+			return
+		}
+		u["submitted_by_id"], u["submitted_by"] = person.ID, person.Name
+	}
+	u.setString("admin_index_no", req.AdminIndexNo)
+	u.setString("admin_remarks", req.AdminRemarks)
+	if req.Entity != nil && !entityAllowed(c, *req.Entity) {
+		writeEntityDenied(c, *req.Entity)
+		return
+	}
+	u.setString("entity", req.Entity)
+	for column, v := range map[string]*string{
+		"date":                   req.Date,
+		"admin_date_of_receipt":  req.AdminDateOfReceipt,
+		"admin_date_of_indexing": req.AdminDateOfIndexing,
+	} {
+		if err := u.setDate(column, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if len(u) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+		return
+	}
+
+	updateRecord(c, facilityDocKind, h.Repo, id, expected, u)
+}
+
+// DeleteFacilityDoc handles DELETE /api/facility-docs/:id (soft delete, reason required)
+func (h *FacilityDocHandler) DeleteFacilityDoc(c *gin.Context) {
+	softDeleteRecord(c, facilityDocKind, h.Repo)
+}
+
+// GetDeletedFacilityDocs handles GET /api/facility-docs/deleted
+func (h *FacilityDocHandler) GetDeletedFacilityDocs(c *gin.Context) {
+	listDeleted(c, facilityDocKind, h.Repo)
+}
+
+// RestoreFacilityDoc handles POST /api/facility-docs/:id/restore
+func (h *FacilityDocHandler) RestoreFacilityDoc(c *gin.Context) {
+	restoreRecord(c, facilityDocKind, h.Repo)
+}
+
+// PurgeFacilityDoc handles DELETE /api/facility-docs/:id/purge
+func (h *FacilityDocHandler) PurgeFacilityDoc(c *gin.Context) {
+	purgeRecord(c, facilityDocKind, h.Repo, h.Config.RetentionYears)
+}
+
+// GetFacilityDocVersions handles GET /api/facility-docs/:id/versions
+func (h *FacilityDocHandler) GetFacilityDocVersions(c *gin.Context) {
+	listVersions(c, facilityDocKind, h.Repo, h.AccessLog)
+}
+
+// GetFacilityDocVersion handles GET /api/facility-docs/:id/versions/:n
+func (h *FacilityDocHandler) GetFacilityDocVersion(c *gin.Context) {
+	getVersion(c, facilityDocKind, h.Repo, h.AccessLog)
+}
+
+// DiffFacilityDoc handles GET /api/facility-docs/:id/diff?from=&to=
+func (h *FacilityDocHandler) DiffFacilityDoc(c *gin.Context) {
+	diffVersions(c, facilityDocKind, h.Repo, h.AccessLog)
 }
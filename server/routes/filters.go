@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+var validEntities = map[string]bool{"adgyl": true, "agro": true, "biopharma": true}
+
+// parseListFilter reads the query-string filters shared by the list and
+// export endpoints (?entity=) from the request. Requests made with an API
+// key only see the key's entity, users only the entities where they hold the
+// permission the route requires, and the studies they direct where they
+// hold index-own.
+func parseListFilter(c *gin.Context) (repository.ListFilter, error) {
+	f := repository.ListFilter{Entity: strings.ToLower(strings.TrimSpace(c.Query("entity")))}
+	if f.Entity != "" && !validEntities[f.Entity] {
+		return f, fmt.Errorf("invalid entity: %s", f.Entity)
+	}
+	if keyEntity := c.GetString("api_key_entity"); keyEntity != "" {
+		if f.Entity != "" && f.Entity != keyEntity {
+			return f, fmt.Errorf("API key is limited to entity %s", keyEntity)
+		}
+		f.Entity = keyEntity
+	}
+	own, directs := ownEntities(c)
+	if permitted, ok := permittedEntities(c); ok {
+		if f.Entity != "" && !slices.Contains(permitted, f.Entity) && !ownsEntity(own, f.Entity) {
+			return f, fmt.Errorf("%s permission is not granted in entity %s", c.GetString("permission"), f.Entity)
+		}
+		f.Entities = permitted
+	}
+	if directs {
+		directorID := c.GetUint("director_id")
+		f.DirectorID = &directorID
+		if !slices.Contains(own, db.AllEntities) {
+			f.DirectorEntities = own
+		}
+	}
+	return f, nil
+}
+
+// ownEntities returns the entities where RequireOwnPermission admitted the
+// request to the studies the user directs; ok is false when it did not
+func ownEntities(c *gin.Context) (entities []string, ok bool) {
+	v, ok := c.Get("own_entities")
+	if !ok {
+		return nil, false
+	}
+	entities, ok = v.([]string)
+	return entities, ok
+}
+
+func ownsEntity(own []string, entity string) bool {
+	return slices.Contains(own, db.AllEntities) || slices.Contains(own, entity)
+}
+
+// recordAllowed is entityAllowed for a record just read, also admitting
+// studies the requesting user directs in their own entities
+func recordAllowed(c *gin.Context, record accessedRecord) bool {
+	if entityAllowed(c, record.RecordEntity()) {
+		return true
+	}
+	own, ok := ownEntities(c)
+	study, isStudy := record.(*db.Study)
+	return ok && isStudy && study.StudyDirectorID != nil && *study.StudyDirectorID == c.GetUint("director_id") &&
+		ownsEntity(own, study.Entity)
+}
+
+// permittedEntities returns the entities RequirePermission limited the
+// request to; ok is false when it is not limited
+func permittedEntities(c *gin.Context) (entities []string, ok bool) {
+	v, ok := c.Get("permitted_entities")
+	if !ok {
+		return nil, false
+	}
+	entities, ok = v.([]string)
+	return entities, ok
+}
+
+// entityAllowed reports whether the request may act on records of entity:
+// API keys are limited to their own entity, users to the entities where
+// they hold the permission the route requires
+func entityAllowed(c *gin.Context, entity string) bool {
+	if keyEntity := c.GetString("api_key_entity"); keyEntity != "" && keyEntity != entity {
+		return false
+	}
+	if permitted, ok := permittedEntities(c); ok {
+		return slices.Contains(permitted, entity)
+	}
+	return true
+}
+
+// writeEntityDenied answers 403 for a write to an entity outside those the
+// request may act on
+func writeEntityDenied(c *gin.Context, entity string) {
+	if keyEntity := c.GetString("api_key_entity"); keyEntity != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is limited to entity " + keyEntity})
+		return
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": c.GetString("permission") + " permission is not granted in entity " + entity})
+}
+
+// entityLookup finds the entity of an archive record, deleted or not
+type entityLookup interface {
+	Entity(ctx context.Context, id uint) (string, error)
+}
+
+// checkRecordEntity answers 404 unless record id is in an entity the request
+// may act on. The record is only read when the request is limited.
+func checkRecordEntity(c *gin.Context, kind recordKind, repo entityLookup, id uint) bool {
+	_, limited := permittedEntities(c)
+	if !limited && c.GetString("api_key_entity") == "" {
+		return true
+	}
+	entity, err := repo.Entity(c.Request.Context(), id)
+	if err != nil {
+		writeRecordError(c, kind, err)
+		return false
+	}
+	if !entityAllowed(c, entity) {
+		writeRecordError(c, kind, repository.ErrNotFound)
+		return false
+	}
+	return true
+}
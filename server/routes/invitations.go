@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvitationHandler owns the admin-only signup invitation endpoints
+type InvitationHandler struct {
+	Invitations repository.InvitationRepository
+	Users       repository.UserRepository
+	Config      *config.Config
+}
+
+// invitationView is an invitation with its status at the time of the request
+type invitationView struct {
+	db.Invitation
+	Status string `json:"status"`
+}
+
+func newInvitationView(inv db.Invitation, now time.Time) invitationView {
+	return invitationView{Invitation: inv, Status: inv.Status(now)}
+}
+
+type createInvitationReq struct {
+	Email  string `json:"email" binding:"required,email"`
+	Entity string `json:"entity" binding:"required,oneof=adgyl agro biopharma"`
+}
+
+// CreateInvitation handles POST /api/admin/invitations. The token is returned
+// only in this response, for the admin to pass on to the invitee.
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req createInvitationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	if !managesEntity(c, req.Entity) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only invite users to entities you administer"})
+		return
+	}
+	if _, err := h.Users.FindByEmail(c.Request.Context(), email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already registered"})
+		return
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	now := time.Now()
+	inv := db.Invitation{
+		TokenHash: hash,
+		Email:     email,
+		Entity:    req.Entity,
+		InvitedBy: currentUserID(c),
+		ExpiresAt: now.Add(h.Config.InviteExpiry),
+		CreatedAt: now,
+	}
+	if err := h.Invitations.Create(c.Request.Context(), &inv, requestActor(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"invitation": newInvitationView(inv, now), "token": token})
+}
+
+// ListInvitations handles GET /api/admin/invitations?status=, limited to the
+// entities the admin administers
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", db.InvitationPending, db.InvitationAccepted, db.InvitationRevoked, db.InvitationExpired:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + status + ", expected pending, accepted, revoked or expired"})
+		return
+	}
+
+	invitations, err := h.Invitations.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	views := []invitationView{}
+	for _, inv := range invitations {
+		v := newInvitationView(inv, now)
+		if managesEntity(c, inv.Entity) && (status == "" || v.Status == status) {
+			views = append(views, v)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": views})
+}
+
+// RevokeInvitation handles DELETE /api/admin/invitations/:id
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	inv, err := h.Invitations.Get(c.Request.Context(), id)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	if !managesEntity(c, inv.Entity) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only revoke invitations to entities you administer"})
+		return
+	}
+
+	if err := h.Invitations.Revoke(c.Request.Context(), id, requestActor(c)); err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	if inv, err = h.Invitations.Get(c.Request.Context(), id); err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation": newInvitationView(*inv, time.Now())})
+}
+
+func writeInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+	case errors.Is(err, repository.ErrInvitationUnusable):
+		c.JSON(http.StatusConflict, gin.H{"error": "invitation has already been used or revoked"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
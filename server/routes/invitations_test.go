@@ -0,0 +1,130 @@
+package routes_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func invite(t *testing.T, srv *apitest.Server, token, email, entity string) (uint, string) {
+	t.Helper()
+	res := srv.Do(http.MethodPost, "/api/admin/invitations", map[string]string{"email": email, "entity": entity},
+		apitest.Bearer(token)).Expect(http.StatusCreated).JSON()
+	inv := res["invitation"].(map[string]interface{})
+	if inv["status"] != db.InvitationPending || inv["entity"] != entity {
+		t.Fatalf("invitation = %v", inv)
+	}
+	if _, ok := inv["token_hash"]; ok {
+		t.Fatal("invitation exposes the token hash")
+	}
+	return uint(inv["id"].(float64)), res["token"].(string)
+}
+
+func TestSignUpWithInvitation(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.AdminToken()
+	_, token := invite(t, srv, admin, "Invitee@Example.com", "biopharma")
+
+	signup := map[string]string{"email": "other@example.com", "password": apitest.Password, "invite_token": token}
+	srv.Do(http.MethodPost, "/api/auth/signup", signup).Expect(http.StatusBadRequest)
+	signup["email"] = "invitee@example.com"
+	signup["invite_token"] = "not-a-token"
+	srv.Do(http.MethodPost, "/api/auth/signup", signup).Expect(http.StatusBadRequest)
+
+	signup["invite_token"] = token
+	user := srv.Do(http.MethodPost, "/api/auth/signup", signup).Expect(http.StatusCreated).
+		JSON()["user"].(map[string]interface{})
+	if user["role"] != "user" || user["pending_approval"] != false {
+		t.Fatalf("invited user = %v", user)
+	}
+	id := uint(user["id"].(float64))
+	got := srv.Do(http.MethodGet, userPath(id, ""), nil, apitest.Bearer(admin)).Expect(http.StatusOK).
+		JSON()["user"].(map[string]interface{})
+	if e := got["entities"].([]interface{}); len(e) != 1 || e[0] != "biopharma" {
+		t.Fatalf("invited user entities = %v", e)
+	}
+	srv.Login("invitee@example.com")
+
+	// tokens are single use
+	signup["email"] = "invitee2@example.com"
+	srv.Do(http.MethodPost, "/api/auth/signup", signup).Expect(http.StatusBadRequest)
+
+	accepted := srv.Do(http.MethodGet, "/api/admin/invitations?status=accepted", nil, apitest.Bearer(admin)).
+		Expect(http.StatusOK).JSON()["invitations"].([]interface{})
+	if len(accepted) != 1 || accepted[0].(map[string]interface{})["accepted_by"] != float64(id) {
+		t.Fatalf("accepted invitations = %v", accepted)
+	}
+
+	var approvals int64
+	srv.DB.Model(&db.AuditLog{}).Where("action IN ?", []string{db.AuditInviteCreate, db.AuditInviteAccept}).Count(&approvals)
+	if approvals != 2 {
+		t.Fatalf("invitation audit entries = %d, want 2", approvals)
+	}
+}
+
+func TestExpiredAndRevokedInvitations(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.AdminToken()
+
+	expiredID, expired := invite(t, srv, admin, "late@example.com", "agro")
+	srv.DB.Model(&db.Invitation{}).Where("id = ?", expiredID).Update("expires_at", time.Now().Add(-time.Minute))
+	srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "late@example.com", "password": apitest.Password, "invite_token": expired,
+	}).Expect(http.StatusBadRequest)
+
+	revokedID, revoked := invite(t, srv, admin, "revoked@example.com", "agro")
+	path := "/api/admin/invitations/" + strconv.FormatUint(uint64(revokedID), 10)
+	inv := srv.Do(http.MethodDelete, path, nil, apitest.Bearer(admin)).Expect(http.StatusOK).
+		JSON()["invitation"].(map[string]interface{})
+	if inv["status"] != db.InvitationRevoked {
+		t.Fatalf("revoked invitation = %v", inv)
+	}
+	srv.Do(http.MethodDelete, path, nil, apitest.Bearer(admin)).Expect(http.StatusConflict)
+	srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "revoked@example.com", "password": apitest.Password, "invite_token": revoked,
+	}).Expect(http.StatusBadRequest)
+
+	list := srv.Do(http.MethodGet, "/api/admin/invitations?status=expired", nil, apitest.Bearer(admin)).
+		Expect(http.StatusOK).JSON()["invitations"].([]interface{})
+	if len(list) != 1 {
+		t.Fatalf("expired invitations = %v", list)
+	}
+}
+
+func TestInvitationsAreScopedToEntityAdmins(t *testing.T) {
+	srv := apitest.New(t)
+	global := srv.AdminToken()
+	lead := srv.CreateUser("agro-lead@example.com", "admin")
+	srv.Do(http.MethodPut, userPath(lead.ID, "/entities"), map[string][]string{"entities": {"agro"}}, apitest.Bearer(global)).
+		Expect(http.StatusOK)
+	agroAdmin := srv.Login(lead.Email)
+
+	invite(t, srv, agroAdmin, "a@example.com", "agro")
+	srv.Do(http.MethodPost, "/api/admin/invitations", map[string]string{"email": "b@example.com", "entity": "adgyl"},
+		apitest.Bearer(agroAdmin)).Expect(http.StatusForbidden)
+	invite(t, srv, global, "c@example.com", "adgyl")
+
+	list := srv.Do(http.MethodGet, "/api/admin/invitations", nil, apitest.Bearer(agroAdmin)).Expect(http.StatusOK).
+		JSON()["invitations"].([]interface{})
+	if len(list) != 1 {
+		t.Fatalf("agro admin sees %d invitations, want 1", len(list))
+	}
+
+	srv.Config.SignupMode = config.SignupApproval
+	res := srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "pending@example.com", "password": apitest.Password, "entity": "adgyl",
+	}).Expect(http.StatusCreated).JSON()
+	id := uint(res["user"].(map[string]interface{})["id"].(float64))
+	srv.Do(http.MethodPost, userPath(id, "/approve"), nil, apitest.Bearer(agroAdmin)).Expect(http.StatusForbidden)
+	srv.Do(http.MethodPost, userPath(id, "/approve"), nil, apitest.Bearer(global)).Expect(http.StatusOK)
+
+	user := srv.UserToken()
+	srv.Do(http.MethodGet, "/api/admin/invitations", nil, apitest.Bearer(user)).Expect(http.StatusForbidden)
+	srv.Do(http.MethodPost, "/api/admin/invitations", map[string]string{"email": "USER@example.com", "entity": "agro"},
+		apitest.Bearer(global)).Expect(http.StatusConflict)
+}
@@ -0,0 +1,100 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func attempt(srv *apitest.Server, email, password string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": email, "password": password})
+}
+
+func TestAccountLocksAfterFailedSignIns(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.LockoutThreshold = 3
+	u := srv.CreateUser("target@example.com", "user")
+
+	attempt(srv, u.Email, "wrong-1").Expect(http.StatusUnauthorized)
+	attempt(srv, u.Email, "wrong-2").Expect(http.StatusUnauthorized)
+	// a success in between resets the count
+	attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK)
+	for i := 0; i < 3; i++ {
+		attempt(srv, u.Email, "wrong").Expect(http.StatusUnauthorized)
+	}
+
+	res := attempt(srv, u.Email, apitest.Password).Expect(http.StatusLocked)
+	if res.Header().Get("Retry-After") == "" || res.JSON()["locked_until"] == nil {
+		t.Fatalf("locked response: %v %s", res.Header(), res.Body.String())
+	}
+
+	admin := apitest.Bearer(srv.AdminToken())
+	locked := srv.Do(http.MethodGet, "/api/admin/users?status=locked", nil, admin).Expect(http.StatusOK).
+		JSON()["users"].([]interface{})
+	if len(locked) != 1 {
+		t.Fatalf("locked users = %v", locked)
+	}
+	user := srv.Do(http.MethodPost, userPath(u.ID, "/unlock"), nil, admin).Expect(http.StatusOK).
+		JSON()["user"].(map[string]interface{})
+	if user["locked_until"] != nil || user["failed_logins"] != float64(0) {
+		t.Fatalf("unlocked user = %v", user)
+	}
+	attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK)
+
+	for action, want := range map[string]int64{
+		db.AuditLoginFailed:   6,
+		db.AuditAccountLock:   1,
+		db.AuditAccountUnlock: 1,
+	} {
+		var n int64
+		srv.DB.Model(&db.AuditLog{}).Where("action = ? AND record_id = ?", action, u.ID).Count(&n)
+		if n != want {
+			t.Errorf("%s audit entries = %d, want %d", action, n, want)
+		}
+	}
+	var logins int64
+	srv.DB.Model(&db.AuditLog{}).Where("action = ? AND user_id = ?", db.AuditLogin, u.ID).Count(&logins)
+	if logins != 2 {
+		t.Errorf("login audit entries = %d, want 2", logins)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.LockoutThreshold = 2
+	u := srv.CreateUser("target@example.com", "user")
+
+	attempt(srv, u.Email, "wrong").Expect(http.StatusUnauthorized)
+	attempt(srv, u.Email, "wrong").Expect(http.StatusUnauthorized)
+	attempt(srv, u.Email, apitest.Password).Expect(http.StatusLocked)
+
+	srv.DB.Model(&db.User{}).Where("id = ?", u.ID).Update("locked_until", time.Now().Add(-time.Second))
+	// the first failure after the lock ran out starts a new count rather than re-locking
+	attempt(srv, u.Email, "wrong").Expect(http.StatusUnauthorized)
+	attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK)
+}
+
+func TestSignInThrottledPerIP(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.LoginIPLimit = 3
+	srv.CreateUser("someone@example.com", "user")
+
+	attempt(srv, "nobody@example.com", "x").Expect(http.StatusUnauthorized)
+	attempt(srv, "nobody-else@example.com", "x").Expect(http.StatusUnauthorized)
+	attempt(srv, "someone@example.com", "x").Expect(http.StatusUnauthorized)
+
+	// even correct credentials are refused from this address until the window passes
+	res := attempt(srv, "someone@example.com", apitest.Password).Expect(http.StatusTooManyRequests)
+	if res.Header().Get("Retry-After") == "" {
+		t.Fatal("throttled response has no Retry-After")
+	}
+
+	var unknown int64
+	srv.DB.Model(&db.AuditLog{}).Where("action = ? AND user_email = ?", db.AuditLoginFailed, "nobody@example.com").Count(&unknown)
+	if unknown != 1 {
+		t.Fatalf("unknown-email failures audited = %d, want 1", unknown)
+	}
+}
@@ -0,0 +1,371 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at a time
+const recoveryCodeCount = 10
+
+// mfaPermissions are the privileged permissions whose holders in an entity
+// listed in MFARequiredEntities must use a second factor
+var mfaPermissions = []string{db.PermManageUsers, db.PermDispose}
+
+// mfaRequired reports whether user must use a second factor, from the
+// permissions their base and entity roles grant them
+func mfaRequired(ctx context.Context, users repository.UserRepository, cfg *config.Config, user *db.User) (bool, error) {
+	if len(cfg.MFARequiredEntities) == 0 {
+		return false, nil
+	}
+	grants, err := users.Grants(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	return mfaRequiredFor(cfg, grants), nil
+}
+
+// mfaRequiredFor reports whether grants include a privileged permission in
+// an entity listed in MFARequiredEntities, counting grants for every entity
+func mfaRequiredFor(cfg *config.Config, grants db.Grants) bool {
+	for _, perm := range mfaPermissions {
+		entities, all := grants.Entities(perm)
+		if all && len(cfg.MFARequiredEntities) > 0 {
+			return true
+		}
+		for _, e := range entities {
+			if slices.Contains(cfg.MFARequiredEntities, e) || slices.Contains(cfg.MFARequiredEntities, db.AllEntities) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// challengeMFA answers a correct password for a user with MFA enabled: the
+// challenge token is exchanged for a session by VerifyMFA
+func (h *AuthHandler) challengeMFA(c *gin.Context, user *db.User) {
+	token, err := h.Tokens.GenerateChallenge(user.ID, h.Config.MFAChallengeExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int(h.Config.MFAChallengeExpiry.Seconds()),
+	})
+}
+
+type verifyMFAReq struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// VerifyMFA handles POST /api/auth/mfa/verify, the second step of sign-in.
+// A TOTP code or an unused recovery code completes it; wrong codes count
+// towards the account lockout like wrong passwords.
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req verifyMFAReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "give either code or recovery_code"})
+		return
+	}
+	userID, err := h.Tokens.ValidateChallenge(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	actor := requestActor(c)
+	if h.throttled(c, actor.IP) {
+		return
+	}
+	user, err := h.Users.FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	actor.UserID, actor.Email = &user.ID, user.Email
+	policy := repository.LockoutPolicy{Threshold: h.Config.LockoutThreshold, Duration: h.Config.LockoutDuration}
+	if h.locked(c, user, policy, actor) {
+		return
+	}
+	if user.DisabledAt != nil || user.PendingApproval || user.MFAEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	if err := h.checkSecondFactor(ctx, user, req.Code, req.RecoveryCode, actor); err != nil {
+		if !errors.Is(err, repository.ErrMFACodeInvalid) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := h.Users.RecordFailedLogin(ctx, user, repository.LoginFailedMFA, policy, actor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": repository.ErrMFACodeInvalid.Error()})
+		return
+	}
+
+	if err := h.Users.RecordLogin(ctx, user.ID, actor); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	user.FailedLogins, user.LockedUntil = 0, nil
+	h.startSession(c, user, true)
+}
+
+// checkSecondFactor consumes a TOTP code or, if code is empty, a recovery
+// code; ErrMFACodeInvalid if neither is good
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, user *db.User, code, recoveryCode string, actor repository.Actor) error {
+	if code == "" {
+		return h.MFA.UseRecoveryCode(ctx, user.ID, utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode)), actor)
+	}
+	step, ok := utils.VerifyTOTP(user.MFASecret, code, time.Now(), user.MFALastStep)
+	if !ok {
+		return repository.ErrMFACodeInvalid
+	}
+	return h.MFA.UseStep(ctx, user.ID, step)
+}
+
+// currentUser loads the authenticated user, answering the error itself
+func (h *AuthHandler) currentUser(c *gin.Context) (*db.User, bool) {
+	user, err := h.Users.FindByID(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		writeUserError(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// MFAStatus handles GET /api/auth/mfa
+func (h *AuthHandler) MFAStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	required, err := mfaRequired(c.Request.Context(), h.Users, h.Config, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	left, err := h.MFA.RecoveryCodesLeft(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":             user.MFAEnabledAt != nil,
+		"enabled_at":          user.MFAEnabledAt,
+		"required":            required,
+		"session_verified":    c.GetBool("mfa_verified"),
+		"recovery_codes_left": left,
+	})
+}
+
+// EnrollMFA handles POST /api/auth/mfa/enroll. It returns a new secret and
+// its otpauth:// provisioning URI for a QR code; MFA is enabled only once
+// ConfirmMFA has seen a code generated from it.
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	if err := h.MFA.StartEnrollment(c.Request.Context(), user.ID, secret); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(h.Config.MFAIssuer, user.Email, secret),
+	})
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ConfirmMFA handles POST /api/auth/mfa/confirm. A correct code enables MFA
+// and returns the recovery codes, shown only this once, plus an access token
+// for the now verified session.
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	var req mfaCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		writeMFAError(c, repository.ErrMFAEnabled)
+		return
+	}
+	if user.MFASecret == "" {
+		writeMFAError(c, repository.ErrMFANotEnrolled)
+		return
+	}
+	step, valid := utils.VerifyTOTP(user.MFASecret, req.Code, time.Now(), user.MFALastStep)
+	if !valid {
+		writeMFAError(c, repository.ErrMFACodeInvalid)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.MFA.Enable(ctx, user.ID, step, hashes, requestActor(c)); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	sid := c.GetUint("session_id")
+	if sid != 0 {
+		if err := h.Sessions.MarkMFAVerified(ctx, sid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	token, err := h.Tokens.GenerateToken(user.ID, user.Email, user.Role, sid, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+		"token":          token,
+		"expires_in":     int(h.Tokens.Expiry().Seconds()),
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /api/auth/mfa/recovery-codes,
+// replacing every recovery code after checking a current TOTP code
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req mfaCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.checkSecondFactor(ctx, user, req.Code, "", requestActor(c)); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := h.MFA.ReplaceRecoveryCodes(ctx, user.ID, hashes, requestActor(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+type disableMFAReq struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DisableMFA handles DELETE /api/auth/mfa. It needs the password and a
+// current code, and is refused to users who are required to use MFA.
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	var req disableMFAReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	ctx := c.Request.Context()
+	required, err := mfaRequired(ctx, h.Users, h.Config, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for your account"})
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is incorrect"})
+		return
+	}
+	if err := h.checkSecondFactor(ctx, user, req.Code, "", requestActor(c)); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+	if err := h.MFA.Disable(ctx, user.ID, requestActor(c)); err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func writeMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrMFACodeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrMFAEnabled), errors.Is(err, repository.ErrMFANotEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeUserError(c, err)
+	}
+}
@@ -0,0 +1,210 @@
+package routes_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+)
+
+// totp returns the current code for secret. Each code works only once, so
+// tests that reuse the current step clear mfa_last_step first.
+func totp(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func allowCodeReuse(srv *apitest.Server, id uint) {
+	srv.DB.Model(&db.User{}).Where("id = ?", id).Update("mfa_last_step", 0)
+}
+
+type enrollment struct {
+	Secret        string
+	RecoveryCodes []string `json:"recovery_codes"`
+	Token         string   `json:"token"`
+}
+
+// enrollMFA sets up MFA for the user signed in with token
+func enrollMFA(t *testing.T, srv *apitest.Server, token string) enrollment {
+	t.Helper()
+	var started struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	srv.Do(http.MethodPost, "/api/auth/mfa/enroll", nil, apitest.Bearer(token)).Expect(http.StatusOK).Decode(&started)
+	if !strings.HasPrefix(started.ProvisioningURI, "otpauth://totp/") || !strings.Contains(started.ProvisioningURI, started.Secret) {
+		t.Fatalf("provisioning URI %q", started.ProvisioningURI)
+	}
+
+	var out enrollment
+	srv.Do(http.MethodPost, "/api/auth/mfa/confirm", map[string]string{"code": totp(t, started.Secret)}, apitest.Bearer(token)).
+		Expect(http.StatusOK).Decode(&out)
+	out.Secret = started.Secret
+	return out
+}
+
+func verifyMFA(srv *apitest.Server, mfaToken string, fields map[string]string) *apitest.Response {
+	body := map[string]string{"mfa_token": mfaToken}
+	for k, v := range fields {
+		body[k] = v
+	}
+	return srv.Do(http.MethodPost, "/api/auth/mfa/verify", body)
+}
+
+func TestMFAEnrollmentAndSignIn(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("someone@example.com", "user")
+	token := srv.Login(u.Email)
+
+	srv.Do(http.MethodPost, "/api/auth/mfa/confirm", map[string]string{"code": "123456"}, apitest.Bearer(token)).
+		Expect(http.StatusConflict)
+	mfa := enrollMFA(t, srv, token)
+	if len(mfa.RecoveryCodes) != 10 || mfa.Token == "" {
+		t.Fatalf("confirm returned %+v", mfa)
+	}
+	srv.Do(http.MethodPost, "/api/auth/mfa/enroll", nil, apitest.Bearer(token)).Expect(http.StatusConflict)
+
+	// the password alone only yields a challenge, which is not an access token
+	challenge := attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK).JSON()
+	if challenge["mfa_required"] != true || challenge["token"] != nil {
+		t.Fatalf("signin with MFA: %v", challenge)
+	}
+	mfaToken := challenge["mfa_token"].(string)
+	srv.Do(http.MethodGet, "/api/auth/mfa", nil, apitest.Bearer(mfaToken)).Expect(http.StatusUnauthorized)
+
+	verifyMFA(srv, mfaToken, map[string]string{"code": "000000"}).Expect(http.StatusUnauthorized)
+	allowCodeReuse(srv, u.ID)
+	code := totp(t, mfa.Secret)
+	res := verifyMFA(srv, mfaToken, map[string]string{"code": code}).Expect(http.StatusOK).JSON()
+	if res["token"] == nil || res["mfa_verified"] != true {
+		t.Fatalf("verify: %v", res)
+	}
+	verifyMFA(srv, mfaToken, map[string]string{"code": code}).Expect(http.StatusUnauthorized)
+
+	// recovery codes work once each, in any spelling
+	recovery := strings.ToUpper(strings.ReplaceAll(mfa.RecoveryCodes[0], "-", " "))
+	verifyMFA(srv, mfaToken, map[string]string{"recovery_code": recovery}).Expect(http.StatusOK)
+	verifyMFA(srv, mfaToken, map[string]string{"recovery_code": mfa.RecoveryCodes[0]}).Expect(http.StatusUnauthorized)
+
+	status := srv.Do(http.MethodGet, "/api/auth/mfa", nil, apitest.Bearer(res["token"].(string))).Expect(http.StatusOK).JSON()
+	if status["enabled"] != true || status["recovery_codes_left"] != float64(9) {
+		t.Fatalf("status: %v", status)
+	}
+
+	// an admin can remove a lost second factor
+	admin := apitest.Bearer(srv.AdminToken())
+	srv.Do(http.MethodPost, userPath(u.ID, "/reset-mfa"), nil, admin).Expect(http.StatusOK)
+	if res := attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK).JSON(); res["token"] == nil {
+		t.Fatalf("signin after reset-mfa: %v", res)
+	}
+}
+
+func TestAdminOnlyRequiresMFA(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.MFARequiredEntities = []string{"agro"}
+	admin := srv.CreateUser("boss@example.com", "admin")
+
+	session := signIn(t, srv, admin.Email)
+	res := attempt(srv, admin.Email, apitest.Password).Expect(http.StatusOK).JSON()
+	if res["mfa_enrollment_required"] != true {
+		t.Fatalf("signin: %v", res)
+	}
+	blocked := srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(session.Token)).Expect(http.StatusForbidden).JSON()
+	if blocked["mfa_required"] != true {
+		t.Fatalf("admin endpoint without MFA: %v", blocked)
+	}
+
+	// enrolling verifies the current session, and refreshing keeps it verified
+	mfa := enrollMFA(t, srv, session.Token)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(mfa.Token)).Expect(http.StatusOK)
+	var refreshed tokenPair
+	refresh(srv, session.RefreshToken).Expect(http.StatusOK).Decode(&refreshed)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(refreshed.Token)).Expect(http.StatusOK)
+
+	allowCodeReuse(srv, admin.ID)
+	srv.Do(http.MethodDelete, "/api/auth/mfa", map[string]string{"password": apitest.Password, "code": totp(t, mfa.Secret)},
+		apitest.Bearer(mfa.Token)).Expect(http.StatusForbidden)
+
+	// admins of other entities only are not covered
+	other := srv.CreateUser("adgyl-admin@example.com", "admin")
+	if err := srv.Repos.Users.SetEntities(context.Background(), other.ID, []string{"adgyl"}, repository.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(srv.Login(other.Email))).Expect(http.StatusOK)
+}
+
+func TestMFAFollowsPrivilegedGrants(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	// a member of adgyl who may dispose of records in agro through a role
+	clerk := srv.CreateUser("clerk@example.com", "user")
+	if err := srv.Repos.Users.SetEntities(context.Background(), clerk.ID, []string{"adgyl"}, repository.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Do(http.MethodPost, "/api/admin/roles", map[string]interface{}{
+		"name": "disposer", "permissions": []string{"index", "dispose"},
+	}, admin).Expect(http.StatusCreated)
+	srv.Do(http.MethodPut, userPath(clerk.ID, "/roles"), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "agro", "role": "disposer"}},
+	}, admin).Expect(http.StatusOK)
+
+	srv.Config.MFARequiredEntities = []string{"agro"}
+	res := attempt(srv, clerk.Email, apitest.Password).Expect(http.StatusOK).JSON()
+	if res["mfa_enrollment_required"] != true {
+		t.Fatalf("signin: %v", res)
+	}
+	blocked := srv.Do(http.MethodDelete, fmt.Sprintf("/api/test-items/%d/purge", fx.TestItems["agro"].ID), nil,
+		apitest.Bearer(res["token"].(string))).Expect(http.StatusForbidden).JSON()
+	if blocked["mfa_required"] != true {
+		t.Fatalf("purge without MFA: %v", blocked)
+	}
+	blocked = srv.Do(http.MethodPost, fmt.Sprintf("/api/test-items/%d/disposal-requests", fx.TestItems["agro"].ID),
+		map[string]string{"action": "dispose"}, apitest.Bearer(res["token"].(string))).Expect(http.StatusForbidden).JSON()
+	if blocked["mfa_required"] != true {
+		t.Fatalf("disposal request without MFA: %v", blocked)
+	}
+
+	// the same role in an entity not listed, or a role without privileged
+	// permissions in a listed one, needs no second factor
+	srv.Config.MFARequiredEntities = nil
+	srv.Do(http.MethodPut, userPath(clerk.ID, "/roles"), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "biopharma", "role": "disposer"}, {"entity": "agro", "role": "archivist"}},
+	}, admin).Expect(http.StatusOK)
+	srv.Config.MFARequiredEntities = []string{"agro"}
+	res = attempt(srv, clerk.Email, apitest.Password).Expect(http.StatusOK).JSON()
+	if res["mfa_enrollment_required"] != false {
+		t.Fatalf("signin: %v", res)
+	}
+
+	// and so does everything else when every entity is listed
+	srv.Config.MFARequiredEntities = []string{"*"}
+	res = attempt(srv, clerk.Email, apitest.Password).Expect(http.StatusOK).JSON()
+	if res["mfa_enrollment_required"] != true {
+		t.Fatalf("signin with every entity listed: %v", res)
+	}
+}
+
+func TestWrongMFACodesLockAccount(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("someone@example.com", "user")
+	enrollMFA(t, srv, srv.Login(u.Email))
+
+	mfaToken := attempt(srv, u.Email, apitest.Password).Expect(http.StatusOK).JSON()["mfa_token"].(string)
+	for i := 0; i < srv.Config.LockoutThreshold; i++ {
+		verifyMFA(srv, mfaToken, map[string]string{"code": "000000"}).Expect(http.StatusUnauthorized)
+	}
+	verifyMFA(srv, mfaToken, map[string]string{"code": "000000"}).Expect(http.StatusLocked)
+	attempt(srv, u.Email, apitest.Password).Expect(http.StatusLocked)
+}
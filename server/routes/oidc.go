@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"eurofines-server/auth"
+	"eurofines-server/db"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcLoginExpiry is how long the user has to sign in at the provider
+const oidcLoginExpiry = 10 * time.Minute
+
+// StartOIDC handles POST /api/auth/oidc/start. The frontend keeps the
+// returned state, sends the browser to authorization_url and posts the code
+// and state the provider redirects back with to /api/auth/oidc/callback.
+func (h *AuthHandler) StartOIDC(c *gin.Context) {
+	if h.Auth.OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "single sign-on is not configured"})
+		return
+	}
+	state, stateHash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	nonce, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	// 43 URL-safe characters, a valid PKCE code verifier
+	verifier, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	url, err := h.Auth.OIDC.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("oidc start: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "single sign-on is unavailable; try again later"})
+		return
+	}
+	login := db.OIDCLogin{
+		StateHash:    stateHash,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginExpiry),
+	}
+	if err := h.OIDCLogins.Create(c.Request.Context(), &login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": url, "state": state})
+}
+
+type oidcCallbackReq struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// OIDCCallback handles POST /api/auth/oidc/callback. The code is exchanged
+// with the verifier stored for state, and the ID token's verified email
+// identifies the user; a first sign-in creates the local account. The answer
+// is the same as for /api/auth/signin, including the two-factor challenge.
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.Auth.OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "single sign-on is not configured"})
+		return
+	}
+	var req oidcCallbackReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	actor := requestActor(c)
+	policy := repository.LockoutPolicy{Threshold: h.Config.LockoutThreshold, Duration: h.Config.LockoutDuration}
+	if h.throttled(c, actor.IP) {
+		return
+	}
+
+	login, err := h.OIDCLogins.Take(ctx, utils.HashToken(req.State))
+	if errors.Is(err, repository.ErrOIDCStateInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := h.Auth.OIDC.Exchange(ctx, req.Code, login.CodeVerifier, login.Nonce)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrNotPermitted):
+		reason, status, msg := repository.LoginFailedSSO, http.StatusUnauthorized, "single sign-on failed; try again"
+		if errors.Is(err, auth.ErrNotPermitted) {
+			reason, status, msg = repository.LoginFailedDenied, http.StatusForbidden, auth.ErrNotPermitted.Error()
+		}
+		log.Printf("oidc sign-in refused: %v", err)
+		if _, err := h.Users.RecordFailedLogin(ctx, nil, reason, policy, actor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(status, gin.H{"error": msg})
+		return
+	case err != nil:
+		log.Printf("oidc sign-in: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "single sign-on is unavailable; try again later"})
+		return
+	}
+
+	actor.Email = identity.Email
+	user, err := h.Users.FindByEmail(ctx, identity.Email)
+	if err == nil {
+		actor.UserID = &user.ID
+		if h.locked(c, user, policy, actor) {
+			return
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	account := repository.ExternalAccount{
+		Provider: db.ProviderOIDC,
+		Email:    identity.Email,
+		Role:     identity.Role,
+		Entities: identity.Entities,
+	}
+	user, err = h.Users.Provision(ctx, account, actor)
+	if errors.Is(err, repository.ErrProviderMismatch) {
+		// linking would let the provider take over an account it does not own
+		c.JSON(http.StatusConflict, gin.H{"error": "an account with this email address already signs in another way"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	actor.UserID = &user.ID
+	h.finishSignIn(c, user, actor)
+}
@@ -0,0 +1,138 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"eurofines-server/auth"
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+	"eurofines-server/internal/oidctest"
+)
+
+// withOIDC points single sign-on at a mock provider that maps the lab-agro
+// group to the agro entity and archive-admins to the admin role
+func withOIDC(t *testing.T, srv *apitest.Server) *oidctest.Provider {
+	idp := oidctest.New(t, "archive", "client-secret")
+	srv.Config.OIDC.Issuer = idp.URL
+	srv.Config.OIDC.ClientID = idp.ClientID
+	srv.Config.OIDC.ClientSecret = idp.ClientSecret
+	srv.Config.OIDC.RedirectURL = "http://localhost:5173/oidc/callback"
+	srv.Config.OIDC.AdminGroups = []string{"archive-admins"}
+	srv.Config.OIDC.EntityGroups = []string{"agro:lab-agro"}
+	srv.Auth.OIDC = auth.NewOIDC(srv.Config.OIDC)
+	return idp
+}
+
+// startOIDC begins a sign-in and returns the authorization URL and state
+func startOIDC(t *testing.T, srv *apitest.Server) (string, string) {
+	t.Helper()
+	var res struct {
+		AuthorizationURL string `json:"authorization_url"`
+		State            string `json:"state"`
+	}
+	srv.Do(http.MethodPost, "/api/auth/oidc/start", nil).Expect(http.StatusOK).Decode(&res)
+	u, err := url.Parse(res.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" || q.Get("state") != res.State {
+		t.Fatalf("authorization URL %s", res.AuthorizationURL)
+	}
+	return res.AuthorizationURL, res.State
+}
+
+func oidcCallback(srv *apitest.Server, code, state string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/oidc/callback", map[string]string{"code": code, "state": state})
+}
+
+// signInOIDC runs the whole redirect flow for u
+func signInOIDC(t *testing.T, srv *apitest.Server, idp *oidctest.Provider, u *oidctest.User) *apitest.Response {
+	t.Helper()
+	idp.SignIn(u)
+	authURL, state := startOIDC(t, srv)
+	code, returned := idp.Authorize(t, authURL)
+	if returned != state {
+		t.Fatalf("state %q came back as %q", state, returned)
+	}
+	return oidcCallback(srv, code, state)
+}
+
+func TestOIDCSignInProvisionsUser(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Do(http.MethodPost, "/api/auth/oidc/start", nil).Expect(http.StatusNotFound)
+	idp := withOIDC(t, srv)
+
+	ann := &oidctest.User{Subject: "ann", Email: "ann@example.com", EmailVerified: true,
+		Claims: map[string]interface{}{"groups": []string{"lab-agro", "canteen"}}}
+	res := signInOIDC(t, srv, idp, ann).Expect(http.StatusOK).JSON()
+	token, _ := res["token"].(string)
+	if token == "" || res["refresh_token"] == nil {
+		t.Fatalf("callback: %v", res)
+	}
+	srv.Do(http.MethodGet, "/api/test-items", nil, apitest.Bearer(token)).Expect(http.StatusOK)
+
+	var user db.User
+	if err := srv.DB.Where("email = ?", "ann@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	entities, err := srv.Repos.Users.Entities(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AuthProvider != db.ProviderOIDC || user.Role != "user" || user.Password != "" || !reflect.DeepEqual(entities[user.ID], []string{"agro"}) {
+		t.Fatalf("provisioned %+v in %v", user, entities)
+	}
+
+	// group changes at the provider apply on the next sign-in
+	ann.Claims["groups"] = []string{"lab-agro", "archive-admins"}
+	token = signInOIDC(t, srv, idp, ann).Expect(http.StatusOK).JSON()["token"].(string)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(token)).Expect(http.StatusOK)
+
+	ann.Claims["groups"] = []string{"canteen"}
+	signInOIDC(t, srv, idp, ann).Expect(http.StatusForbidden)
+
+	// the provider's email must be verified
+	signInOIDC(t, srv, idp, &oidctest.User{Subject: "bob", Email: "bob@example.com",
+		Claims: map[string]interface{}{"groups": []string{"lab-agro"}}}).Expect(http.StatusForbidden)
+
+	// a local account is not taken over by the provider
+	local := srv.CreateUser("local@example.com", "user")
+	signInOIDC(t, srv, idp, &oidctest.User{Subject: "local", Email: local.Email, EmailVerified: true,
+		Claims: map[string]interface{}{"groups": []string{"lab-agro"}}}).Expect(http.StatusConflict)
+}
+
+func TestOIDCStateAndVerifierAreChecked(t *testing.T) {
+	srv := apitest.New(t)
+	idp := withOIDC(t, srv)
+	idp.SignIn(&oidctest.User{Subject: "ann", Email: "ann@example.com", EmailVerified: true,
+		Claims: map[string]interface{}{"groups": "lab-agro"}})
+
+	authURL, state := startOIDC(t, srv)
+	code, _ := idp.Authorize(t, authURL)
+	oidcCallback(srv, code, "forged-state").Expect(http.StatusBadRequest)
+
+	// a code issued for one attempt fails with another attempt's verifier,
+	// and the provider then refuses it for its own attempt too
+	_, other := startOIDC(t, srv)
+	oidcCallback(srv, code, other).Expect(http.StatusUnauthorized)
+	oidcCallback(srv, code, state).Expect(http.StatusUnauthorized)
+
+	// each state works once
+	oidcCallback(srv, code, state).Expect(http.StatusBadRequest)
+	authURL, state = startOIDC(t, srv)
+	code, _ = idp.Authorize(t, authURL)
+	oidcCallback(srv, code, state).Expect(http.StatusOK)
+	oidcCallback(srv, code, state).Expect(http.StatusBadRequest)
+}
+
+func TestOIDCProviderUnavailable(t *testing.T) {
+	srv := apitest.New(t)
+	idp := withOIDC(t, srv)
+	idp.Close()
+	srv.Do(http.MethodPost, "/api/auth/oidc/start", nil).Expect(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,132 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/mail"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forgotPasswordReply is the same whether or not the address has an account
+const forgotPasswordReply = "if an account exists for that address, a reset link has been sent to it"
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword emails a one-time reset link to an active account. The
+// response never reveals whether the address is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	user, err := h.Users.FindByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// directory accounts reset their password in the directory
+	if err == nil && user.DisabledAt == nil && !user.PendingApproval && user.HasLocalPassword() {
+		if err := h.sendResetLink(c, user); err != nil {
+			// the requester learns nothing from a failed delivery either
+			log.Printf("password reset for user %d: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": forgotPasswordReply})
+}
+
+func (h *AuthHandler) sendResetLink(c *gin.Context, user *db.User) error {
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	reset := &db.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.Config.ResetTokenExpiry),
+		IPAddress: c.ClientIP(),
+	}
+	if err := h.Resets.Create(c.Request.Context(), reset, requestActor(c)); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(h.Config.AppURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(c.Request.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Eurofines archive password",
+		Body: fmt.Sprintf("A password reset was requested for your account.\n\n"+
+			"Open this link to choose a new password:\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for it, ignore this email.\n",
+			link, h.Config.ResetTokenExpiry),
+	})
+}
+
+type redeemResetReq struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token is consumed, the account unlocked and every session signed out.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req redeemResetReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	tokenHash := utils.HashToken(req.Token)
+
+	reset, err := h.Resets.Lookup(ctx, tokenHash)
+	if err != nil {
+		writeResetError(c, err)
+		return
+	}
+	user, err := h.Users.FindByID(ctx, reset.UserID)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	if user.DisabledAt != nil || user.PendingApproval || !user.HasLocalPassword() {
+		writeResetError(c, repository.ErrResetInvalid)
+		return
+	}
+	policy := h.Config.PasswordPolicy()
+	if !checkNewPassword(c, h.Users, policy, user.ID, req.NewPassword) {
+		return
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+	opts := repository.PasswordUpdate{Keep: policy.History - 1}
+	if _, err := h.Resets.Redeem(ctx, tokenHash, hash, opts, requestActor(c)); err != nil {
+		writeResetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset; sign in with the new password"})
+}
+
+func writeResetError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrResetInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
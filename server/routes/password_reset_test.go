@@ -0,0 +1,111 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+var resetLink = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+func forgotPassword(srv *apitest.Server, email string) map[string]interface{} {
+	return srv.Do(http.MethodPost, "/api/auth/forgot-password", map[string]string{"email": email}).
+		Expect(http.StatusAccepted).JSON()
+}
+
+func resetPassword(srv *apitest.Server, token, password string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/reset-password",
+		map[string]string{"token": token, "new_password": password})
+}
+
+// lastResetToken returns the token from the newest mail sent to email
+func lastResetToken(t *testing.T, srv *apitest.Server, email string) string {
+	t.Helper()
+	msgs := srv.Mail.Messages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].To != email {
+			continue
+		}
+		m := resetLink.FindStringSubmatch(msgs[i].Body)
+		if m == nil {
+			t.Fatalf("no reset link in %q", msgs[i].Body)
+		}
+		token, err := url.QueryUnescape(m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Fatalf("no mail sent to %s", email)
+	return ""
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("someone@example.com", "user")
+	disabled := srv.CreateUser("gone@example.com", "user")
+	now := time.Now()
+	srv.DB.Model(disabled).Update("disabled_at", &now)
+
+	known := forgotPassword(srv, "someone@example.com")
+	unknown := forgotPassword(srv, "nobody@example.com")
+	gone := forgotPassword(srv, "gone@example.com")
+	if known["message"] != unknown["message"] || known["message"] != gone["message"] || len(known) != 1 {
+		t.Fatalf("responses differ: %v / %v / %v", known, unknown, gone)
+	}
+	if msgs := srv.Mail.Messages(); len(msgs) != 1 || msgs[0].To != "someone@example.com" {
+		t.Fatalf("mail sent: %+v", msgs)
+	}
+	var stored db.PasswordReset
+	srv.DB.First(&stored)
+	if token := lastResetToken(t, srv, "someone@example.com"); stored.TokenHash == token {
+		t.Fatal("reset token stored in plain text")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("someone@example.com", "user")
+	session := signIn(t, srv, u.Email)
+	for i := 0; i < srv.Config.LockoutThreshold; i++ {
+		attempt(srv, u.Email, "wrong-password")
+	}
+
+	forgotPassword(srv, u.Email)
+	token := lastResetToken(t, srv, u.Email)
+
+	resetPassword(srv, "not-a-token", "Reset-by-email-1").Expect(http.StatusBadRequest)
+	resetPassword(srv, token, "weak").Expect(http.StatusBadRequest)
+	resetPassword(srv, token, apitest.Password).Expect(http.StatusBadRequest)
+	resetPassword(srv, token, "Reset-by-email-1").Expect(http.StatusOK)
+
+	// single use, the lock is lifted and old sessions are signed out
+	resetPassword(srv, token, "Reset-by-email-2").Expect(http.StatusBadRequest)
+	attempt(srv, u.Email, "Reset-by-email-1").Expect(http.StatusOK)
+	refresh(srv, session.RefreshToken).Expect(http.StatusUnauthorized)
+
+	var audited int64
+	srv.DB.Model(&db.AuditLog{}).Where("action = ? AND record_id = ?", db.AuditResetByEmail, u.ID).Count(&audited)
+	if audited != 1 {
+		t.Fatalf("reset_password_email audit entries = %d, want 1", audited)
+	}
+}
+
+func TestResetTokenExpiresAndIsReplaced(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("someone@example.com", "user")
+
+	forgotPassword(srv, u.Email)
+	first := lastResetToken(t, srv, u.Email)
+	forgotPassword(srv, u.Email)
+	second := lastResetToken(t, srv, u.Email)
+	resetPassword(srv, first, "Reset-by-email-1").Expect(http.StatusBadRequest)
+
+	srv.DB.Model(&db.PasswordReset{}).Where("user_id = ?", u.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	resetPassword(srv, second, "Reset-by-email-1").Expect(http.StatusBadRequest)
+}
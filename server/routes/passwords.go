@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkNewPassword answers 400 and returns false if password breaks policy
+// or, for an existing user (id > 0), is one of their recent passwords
+func checkNewPassword(c *gin.Context, users repository.UserRepository, policy utils.PasswordPolicy, id uint, password string) bool {
+	if err := policy.Check(password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if id == 0 {
+		return true
+	}
+	recent, err := users.RecentPasswords(c.Request.Context(), id, policy.History)
+	if err != nil {
+		writeUserError(c, err)
+		return false
+	}
+	if policy.Reused(password, recent) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("password was used recently; choose one not among the last %d", policy.History)})
+		return false
+	}
+	return true
+}
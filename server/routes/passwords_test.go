@@ -0,0 +1,100 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func changePassword(srv *apitest.Server, token, current, next string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/change-password",
+		map[string]string{"current_password": current, "new_password": next}, apitest.Bearer(token))
+}
+
+func TestSignUpEnforcesPasswordPolicy(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.SignupMode = config.SignupApproval
+
+	for _, weak := range []string{"Sh0rt!", "alllowercaseletters", "lowercase-only-symbols"} {
+		srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+			"email": "new@example.com", "password": weak, "entity": "agro",
+		}).Expect(http.StatusBadRequest)
+	}
+	srv.Do(http.MethodPost, "/api/auth/signup", map[string]string{
+		"email": "new@example.com", "password": "Lab-archive-2024", "entity": "agro",
+	}).Expect(http.StatusCreated)
+}
+
+func TestChangePassword(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Config.PasswordHistory = 3
+	srv.CreateUser("someone@example.com", "user")
+	token := srv.Login("someone@example.com")
+
+	changePassword(srv, token, "wrong-password", "Brand-new-pass-1").Expect(http.StatusBadRequest)
+	changePassword(srv, token, apitest.Password, "weak").Expect(http.StatusBadRequest)
+	changePassword(srv, token, apitest.Password, apitest.Password).Expect(http.StatusBadRequest)
+	changePassword(srv, token, apitest.Password, "Brand-new-pass-1").Expect(http.StatusOK)
+	changePassword(srv, token, "Brand-new-pass-1", "Brand-new-pass-2").Expect(http.StatusOK)
+
+	// the last three passwords, including the current one, are off limits
+	changePassword(srv, token, "Brand-new-pass-2", apitest.Password).Expect(http.StatusBadRequest)
+	changePassword(srv, token, "Brand-new-pass-2", "Brand-new-pass-1").Expect(http.StatusBadRequest)
+	changePassword(srv, token, "Brand-new-pass-2", "Brand-new-pass-3").Expect(http.StatusOK)
+	changePassword(srv, token, "Brand-new-pass-3", apitest.Password).Expect(http.StatusOK)
+
+	var changes int64
+	srv.DB.Model(&db.AuditLog{}).Where("action = ?", db.AuditPasswordChange).Count(&changes)
+	if changes != 4 {
+		t.Fatalf("change_password audit entries = %d, want 4", changes)
+	}
+	var kept int64
+	srv.DB.Model(&db.PasswordHistory{}).Count(&kept)
+	if kept != 2 {
+		t.Fatalf("password history rows = %d, want 2", kept)
+	}
+}
+
+func TestMustChangePasswordAfterAdminReset(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	u := srv.CreateUser("someone@example.com", "user")
+
+	temp := srv.Do(http.MethodPost, userPath(u.ID, "/reset-password"), nil, admin).Expect(http.StatusOK).
+		JSON()["temporary_password"].(string)
+	res := srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": u.Email, "password": temp}).
+		Expect(http.StatusOK).JSON()
+	if res["must_change_password"] != true {
+		t.Fatalf("signin after reset: %v", res)
+	}
+	token := res["token"].(string)
+
+	blocked := srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(token)).Expect(http.StatusForbidden).JSON()
+	if blocked["password_change_required"] != true {
+		t.Fatalf("blocked response: %v", blocked)
+	}
+	changePassword(srv, token, temp, "Chosen-by-user-1").Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(token)).Expect(http.StatusOK)
+}
+
+func TestExpiredPasswordMustBeChanged(t *testing.T) {
+	srv := apitest.New(t)
+	u := srv.CreateUser("someone@example.com", "user")
+	srv.DB.Model(&db.User{}).Where("id = ?", u.ID).
+		Update("password_changed_at", time.Now().Add(-srv.Config.PasswordMaxAge-time.Hour))
+
+	res := srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": u.Email, "password": apitest.Password}).
+		Expect(http.StatusOK).JSON()
+	if res["must_change_password"] != true {
+		t.Fatalf("signin with expired password: %v", res)
+	}
+	token := res["token"].(string)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(token)).Expect(http.StatusForbidden)
+
+	changePassword(srv, token, apitest.Password, "Renewed-pass-90").Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(token)).Expect(http.StatusOK)
+}
@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PersonnelHandler owns the personnel directory of study directors, PIs and
+// archivists, and the per-person views of the records naming them
+type PersonnelHandler struct {
+	Personnel repository.PersonnelRepository
+	Users     repository.UserRepository
+}
+
+// personView is a person with their roles as a list
+type personView struct {
+	db.Person
+	Roles []string `json:"roles"`
+}
+
+func newPersonView(p db.Person) personView {
+	return personView{Person: p, Roles: p.RoleList()}
+}
+
+type personReq struct {
+	Name   string   `json:"name" binding:"required"`
+	Email  string   `json:"email" binding:"omitempty,email"`
+	Roles  []string `json:"roles" binding:"dive,oneof=study-director pi archivist"`
+	UserID *uint    `json:"user_id"`
+	Notes  string   `json:"notes"`
+}
+
+// ListPersonnel handles GET /api/personnel?q=&role=
+func (h *PersonnelHandler) ListPersonnel(c *gin.Context) {
+	filter := repository.PersonnelFilter{Query: c.Query("q"), Role: c.Query("role")}
+	if filter.Role != "" && !slices.Contains(db.PersonRoles, filter.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role: " + filter.Role + ", expected study-director, pi or archivist"})
+		return
+	}
+	people, err := h.Personnel.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	views := make([]personView, len(people))
+	for i, p := range people {
+		views[i] = newPersonView(p)
+	}
+	c.JSON(http.StatusOK, gin.H{"personnel": views})
+}
+
+// GetPerson handles GET /api/personnel/:id
+func (h *PersonnelHandler) GetPerson(c *gin.Context) {
+	person, ok := h.person(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": newPersonView(*person)})
+}
+
+// CreatePerson handles POST /api/personnel
+func (h *PersonnelHandler) CreatePerson(c *gin.Context) {
+	var person db.Person
+	if !h.bindPerson(c, &person) {
+		return
+	}
+	if err := h.Personnel.Create(c.Request.Context(), &person, requestActor(c)); err != nil {
+		writePersonError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"person": newPersonView(person)})
+}
+
+// UpdatePerson handles PUT /api/personnel/:id, replacing every field.
+// Records keep the name they were saved with.
+func (h *PersonnelHandler) UpdatePerson(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	person := db.Person{ID: id}
+	if !h.bindPerson(c, &person) {
+		return
+	}
+	if err := h.Personnel.Update(c.Request.Context(), &person, requestActor(c)); err != nil {
+		writePersonError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": newPersonView(person)})
+}
+
+// DeletePerson handles DELETE /api/personnel/:id for a person no record names
+func (h *PersonnelHandler) DeletePerson(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if !editsAllEntities(c) {
+		return
+	}
+	if err := h.Personnel.Delete(c.Request.Context(), id, requestActor(c)); err != nil {
+		writePersonError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "person deleted"})
+}
+
+// GetPersonStudies handles GET /api/personnel/:id/studies?entity=, the
+// studies the person directs
+func (h *PersonnelHandler) GetPersonStudies(c *gin.Context) {
+	person, filter, ok := h.personAndFilter(c)
+	if !ok {
+		return
+	}
+	studies, err := h.Personnel.Studies(c.Request.Context(), person.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": newPersonView(*person), "studies": studies})
+}
+
+// GetPersonArchived handles GET /api/personnel/:id/archived?entity=, the
+// test items the person archived
+func (h *PersonnelHandler) GetPersonArchived(c *gin.Context) {
+	person, filter, ok := h.personAndFilter(c)
+	if !ok {
+		return
+	}
+	items, err := h.Personnel.Archived(c.Request.Context(), person.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": newPersonView(*person), "test_items": items})
+}
+
+func (h *PersonnelHandler) person(c *gin.Context) (*db.Person, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	person, err := h.Personnel.Get(c.Request.Context(), id)
+	if err != nil {
+		writePersonError(c, err)
+		return nil, false
+	}
+	return person, true
+}
+
+func (h *PersonnelHandler) personAndFilter(c *gin.Context) (*db.Person, repository.ListFilter, bool) {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, filter, false
+	}
+	person, ok := h.person(c)
+	return person, filter, ok
+}
+
+// bindPerson reads a directory entry into person
+func (h *PersonnelHandler) bindPerson(c *gin.Context, person *db.Person) bool {
+	if !editsAllEntities(c) {
+		return false
+	}
+	var req personReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	if req.UserID != nil {
+		if _, err := h.Users.FindByID(c.Request.Context(), *req.UserID); errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id does not refer to a user"})
+			return false
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	roles := []string{}
+	for _, r := range db.PersonRoles {
+		if slices.Contains(req.Roles, r) {
+			roles = append(roles, r)
+		}
+	}
+	person.Name = name
+	person.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	person.Roles = strings.Join(roles, ",")
+	person.UserID = req.UserID
+	person.Notes = strings.TrimSpace(req.Notes)
+	return true
+}
+
+// personFor resolves a person a record names, answering 400 unless they
+// exist and, when roles are given, have one of them
+func personFor(c *gin.Context, personnel repository.PersonnelRepository, id uint, field string, roles ...string) (*db.Person, bool) {
+	person, err := personnel.Get(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " does not refer to a person"})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(roles) > 0 && !person.HasRole(roles...) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " must refer to a " + strings.Join(roles, " or ")})
+		return nil, false
+	}
+	return person, true
+}
+
+func writePersonError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "person not found"})
+	case errors.Is(err, repository.ErrPersonUserLinked), errors.Is(err, repository.ErrPersonInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
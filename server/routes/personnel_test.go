@@ -0,0 +1,74 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+)
+
+func TestPersonnelDirectory(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+	account := srv.CreateUser("rao@example.com", "user")
+
+	sd := srv.Do(http.MethodPost, "/api/personnel", map[string]interface{}{
+		"name": " Dr.  Rao ", "email": "Rao@Example.com", "roles": []string{"pi", "study-director"}, "user_id": account.ID,
+	}, admin).Expect(http.StatusCreated).JSON()["person"].(map[string]interface{})
+	if sd["name"] != "Dr. Rao" || fmt.Sprint(sd["roles"]) != "[study-director pi]" {
+		t.Fatalf("person = %v", sd)
+	}
+	srv.Do(http.MethodPost, "/api/personnel", map[string]interface{}{"name": "Twin", "user_id": account.ID}, admin).
+		Expect(http.StatusConflict)
+	srv.Do(http.MethodPost, "/api/personnel", map[string]interface{}{"name": "X", "roles": []string{"cook"}}, admin).
+		Expect(http.StatusBadRequest)
+	archivist := srv.Do(http.MethodPost, "/api/personnel", map[string]interface{}{
+		"name": "A. Kumar", "roles": []string{"archivist"},
+	}, admin).Expect(http.StatusCreated).JSON()["person"].(map[string]interface{})
+	list := srv.Do(http.MethodGet, "/api/personnel?role=archivist", nil, user).Expect(http.StatusOK).JSON()["personnel"].([]interface{})
+	if len(list) != 1 {
+		t.Fatalf("archivists = %v", list)
+	}
+
+	// records take the person's name, and only someone in the right role
+	for _, entity := range []string{"agro", "adgyl"} {
+		study := srv.Do(http.MethodPatch, fmt.Sprintf("/api/studies/%d", fx.Studies[entity].ID),
+			map[string]interface{}{"study_director_id": sd["id"], "version": 1}, admin).
+			Expect(http.StatusOK).JSON()["study"].(map[string]interface{})
+		if study["sd_or_pi_name"] != "Dr. Rao" {
+			t.Fatalf("study = %v", study)
+		}
+	}
+	srv.Do(http.MethodPatch, fmt.Sprintf("/api/studies/%d", fx.Studies["biopharma"].ID),
+		map[string]interface{}{"study_director_id": archivist["id"], "version": 1}, admin).Expect(http.StatusBadRequest)
+	item := srv.Do(http.MethodPatch, fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID),
+		map[string]interface{}{"archived_by_id": archivist["id"], "version": 1}, admin).
+		Expect(http.StatusOK).JSON()["test_item"].(map[string]interface{})
+	if item["archived_by"] != "A. Kumar" {
+		t.Fatalf("test item = %v", item)
+	}
+
+	sdPath := fmt.Sprintf("/api/personnel/%v", sd["id"])
+	studies := srv.Do(http.MethodGet, sdPath+"/studies", nil, user).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(studies) != 2 {
+		t.Fatalf("studies = %v", studies)
+	}
+	studies = srv.Do(http.MethodGet, sdPath+"/studies?entity=agro", nil, user).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(studies) != 1 {
+		t.Fatalf("agro studies = %v", studies)
+	}
+	archivistPath := fmt.Sprintf("/api/personnel/%v", archivist["id"])
+	items := srv.Do(http.MethodGet, archivistPath+"/archived", nil, user).Expect(http.StatusOK).JSON()["test_items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("archived = %v", items)
+	}
+
+	srv.Do(http.MethodDelete, sdPath, nil, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodPatch, fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID),
+		map[string]interface{}{"archived_by_id": 0, "version": 2}, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, archivistPath, nil, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, archivistPath, nil, user).Expect(http.StatusNotFound)
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PortalHandler owns the sponsor portal: read-only access for sponsor
+// accounts to their company's test items, studies and disposal requests,
+// which they may approve
+type PortalHandler struct {
+	Portal    repository.PortalRepository
+	Disposals repository.DisposalRequestRepository
+	AccessLog repository.AccessLogRepository
+}
+
+// GetTestItems handles GET /api/sponsor/test-items
+func (h *PortalHandler) GetTestItems(c *gin.Context) {
+	items, err := h.Portal.TestItems(c.Request.Context(), c.GetString("user_sponsor"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"test_items": items})
+}
+
+// GetTestItem handles GET /api/sponsor/test-items/:id
+func (h *PortalHandler) GetTestItem(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	item, err := h.Portal.TestItem(c.Request.Context(), c.GetString("user_sponsor"), id)
+	if err != nil {
+		writeRecordError(c, testItemKind, err)
+		return
+	}
+	if !recordView(c, h.AccessLog, testItemKind, item) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"test_item": item})
+}
+
+// GetStudies handles GET /api/sponsor/studies, the studies of the company's
+// test items
+func (h *PortalHandler) GetStudies(c *gin.Context) {
+	studies, err := h.Portal.Studies(c.Request.Context(), c.GetString("user_sponsor"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"studies": studies})
+}
+
+// GetStudy handles GET /api/sponsor/studies/:id
+func (h *PortalHandler) GetStudy(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	study, err := h.Portal.Study(c.Request.Context(), c.GetString("user_sponsor"), id)
+	if err != nil {
+		writeRecordError(c, studyKind, err)
+		return
+	}
+	if !recordView(c, h.AccessLog, studyKind, study) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"study": study})
+}
+
+// GetDisposals handles GET /api/sponsor/disposal-requests?status=
+func (h *PortalHandler) GetDisposals(c *gin.Context) {
+	status, ok := parseDisposalStatus(c)
+	if !ok {
+		return
+	}
+	list, err := h.Disposals.List(c.Request.Context(), repository.DisposalFilter{
+		Company: c.GetString("user_sponsor"),
+		Status:  status,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disposal_requests": newDisposalViews(list)})
+}
+
+type approveDisposalReq struct {
+	Note string `json:"note"`
+}
+
+// ApproveDisposal handles POST /api/sponsor/disposal-requests/:id/approve.
+// Approval sets the test item's sponsor approval date to today.
+func (h *PortalHandler) ApproveDisposal(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req approveDisposalReq
+	// the note is optional, and so is the body
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	request, err := h.Disposals.Approve(c.Request.Context(), id, c.GetString("user_sponsor"), strings.TrimSpace(req.Note), requestActor(c))
+	if err != nil {
+		writeDisposalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disposal_request": disposalView{DisposalRequest: *request, Status: request.Status()}})
+}
@@ -0,0 +1,137 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func TestSponsorPortal(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	other := srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+		"test_item_name": "competitor sample", "test_item_code": "TI-900", "company_name": "Globex", "entity": "agro",
+	}, admin).Expect(http.StatusCreated).JSON()["test_item"].(map[string]interface{})
+	srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{
+		"study_number": "ST-ACME", "test_item_code": "TI-002", "entity": "agro",
+	}, admin).Expect(http.StatusCreated)
+
+	account := srv.CreateUser("viewer@acme.example", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/sponsor", account.ID), map[string]string{"sponsor": " acme pharma "}, admin).
+		Expect(http.StatusOK)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/role", account.ID), map[string]string{"role": "admin"}, admin).
+		Expect(http.StatusBadRequest)
+	sponsor := apitest.Bearer(srv.Login("viewer@acme.example"))
+
+	// only the company's records, and nothing of the staff API
+	items := srv.Do(http.MethodGet, "/api/sponsor/test-items", nil, sponsor).Expect(http.StatusOK).JSON()["test_items"].([]interface{})
+	if len(items) != len(apitest.Entities) {
+		t.Fatalf("sponsor sees %d test items", len(items))
+	}
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/sponsor/test-items/%v", other["id"]), nil, sponsor).Expect(http.StatusNotFound)
+	studies := srv.Do(http.MethodGet, "/api/sponsor/studies", nil, sponsor).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(studies) != 1 || studies[0].(map[string]interface{})["study_number"] != "ST-ACME" {
+		t.Fatalf("sponsor studies = %v", studies)
+	}
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/sponsor/studies/%d", fx.Studies["agro"].ID), nil, sponsor).Expect(http.StatusNotFound)
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "x", "entity": "agro"}, sponsor).
+		Expect(http.StatusForbidden)
+	srv.Do(http.MethodGet, "/api/sponsor/test-items", nil, admin).Expect(http.StatusForbidden)
+
+	// staff ask for approval; one open request per test item
+	agroItem := fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID)
+	created := srv.Do(http.MethodPost, agroItem+"/disposal-requests", map[string]string{"action": "dispose", "note": "expired"}, admin).
+		Expect(http.StatusCreated).JSON()["disposal_request"].(map[string]interface{})
+	srv.Do(http.MethodPost, agroItem+"/disposal-requests", map[string]string{"action": "return"}, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodPost, fmt.Sprintf("/api/test-items/%v/disposal-requests", other["id"]), map[string]string{"action": "shred"}, admin).
+		Expect(http.StatusBadRequest)
+	globex := srv.Do(http.MethodPost, fmt.Sprintf("/api/test-items/%v/disposal-requests", other["id"]), map[string]string{"action": "return"}, admin).
+		Expect(http.StatusCreated).JSON()["disposal_request"].(map[string]interface{})
+
+	pending := srv.Do(http.MethodGet, "/api/sponsor/disposal-requests?status=pending", nil, sponsor).Expect(http.StatusOK).
+		JSON()["disposal_requests"].([]interface{})
+	if len(pending) != 1 || pending[0].(map[string]interface{})["id"] != created["id"] {
+		t.Fatalf("pending = %v", pending)
+	}
+	srv.Do(http.MethodPost, fmt.Sprintf("/api/sponsor/disposal-requests/%v/approve", globex["id"]), nil, sponsor).Expect(http.StatusNotFound)
+	approved := srv.Do(http.MethodPost, fmt.Sprintf("/api/sponsor/disposal-requests/%v/approve", created["id"]), map[string]string{"note": "ok"}, sponsor).
+		Expect(http.StatusOK).JSON()["disposal_request"].(map[string]interface{})
+	if approved["status"] != db.DisposalApproved || approved["approval_note"] != "ok" {
+		t.Fatalf("approved = %v", approved)
+	}
+	srv.Do(http.MethodPost, fmt.Sprintf("/api/sponsor/disposal-requests/%v/approve", created["id"]), nil, sponsor).Expect(http.StatusConflict)
+
+	item := srv.Do(http.MethodGet, agroItem, nil, admin).Expect(http.StatusOK).JSON()["test_item"].(map[string]interface{})
+	if item["sponsor_approval_date"] != time.Now().Format("2006-01-02") || item["version"] != float64(2) {
+		t.Fatalf("test item after approval = %v", item)
+	}
+	open := srv.Do(http.MethodGet, "/api/disposal-requests?status=pending", nil, admin).Expect(http.StatusOK).
+		JSON()["disposal_requests"].([]interface{})
+	if len(open) != 1 || open[0].(map[string]interface{})["company_name"] != "Globex" {
+		t.Fatalf("open requests = %v", open)
+	}
+
+	// the approval stays on record once the test item is purged
+	srv.DB.Exec("UPDATE test_items SET date_of_archive = '2000-01-01' WHERE id = ?", fx.TestItems["agro"].ID)
+	srv.Do(http.MethodDelete, agroItem, map[string]string{"reason": "disposed"}, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, agroItem+"/purge", nil, admin).Expect(http.StatusOK)
+	done := srv.Do(http.MethodGet, "/api/sponsor/disposal-requests?status=approved", nil, sponsor).Expect(http.StatusOK).
+		JSON()["disposal_requests"].([]interface{})
+	if len(done) != 1 || done[0].(map[string]interface{})["id"] != created["id"] {
+		t.Fatalf("approved after purge = %v", done)
+	}
+}
+
+func TestSponsorPortalSharedTestItemCodes(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	// Globex uses TI-002 in agro too, like Acme's seeded test item
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+		"test_item_name": "globex sample", "test_item_code": "TI-002", "company_name": "Globex", "entity": "agro",
+	}, admin).Expect(http.StatusCreated)
+	globex := srv.Do(http.MethodPost, "/api/sponsors", map[string]interface{}{"name": "Globex"}, admin).
+		Expect(http.StatusCreated).JSON()["sponsor"].(map[string]interface{})
+	acme := srv.Do(http.MethodPost, "/api/sponsors", map[string]interface{}{"name": "Acme Pharma"}, admin).
+		Expect(http.StatusCreated).JSON()["sponsor"].(map[string]interface{})
+	globexStudy := srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{
+		"study_number": "ST-GLOBEX", "test_item_code": "TI-002", "sponsor_id": globex["id"], "entity": "agro",
+	}, admin).Expect(http.StatusCreated).JSON()["study"].(map[string]interface{})
+	shared := srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{
+		"study_number": "ST-SHARED", "test_item_code": "TI-002", "entity": "agro",
+	}, admin).Expect(http.StatusCreated).JSON()["study"].(map[string]interface{})
+	// the code of Acme's biopharma test item, used by nobody else there
+	srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{
+		"study_number": "ST-ACME", "test_item_code": "TI-003", "entity": "biopharma",
+	}, admin).Expect(http.StatusCreated)
+
+	account := srv.CreateUser("viewer@acme.example", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/sponsor", account.ID), map[string]string{"sponsor": "Acme Pharma"}, admin).
+		Expect(http.StatusOK)
+	sponsor := apitest.Bearer(srv.Login(account.Email))
+
+	numbers := func() []interface{} {
+		var out []interface{}
+		for _, s := range srv.Do(http.MethodGet, "/api/sponsor/studies", nil, sponsor).Expect(http.StatusOK).JSON()["studies"].([]interface{}) {
+			out = append(out, s.(map[string]interface{})["study_number"])
+		}
+		return out
+	}
+	if got := numbers(); len(got) != 1 || got[0] != "ST-ACME" {
+		t.Fatalf("sponsor studies = %v", got)
+	}
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/sponsor/studies/%v", globexStudy["id"]), nil, sponsor).Expect(http.StatusNotFound)
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/sponsor/studies/%v", shared["id"]), nil, sponsor).Expect(http.StatusNotFound)
+
+	// assigning the sponsor record settles the shared code
+	srv.Do(http.MethodPatch, fmt.Sprintf("/api/studies/%v", shared["id"]), map[string]interface{}{"sponsor_id": acme["id"], "version": 1}, admin).
+		Expect(http.StatusOK)
+	if got := numbers(); len(got) != 2 {
+		t.Fatalf("sponsor studies after assignment = %v", got)
+	}
+}
@@ -0,0 +1,141 @@
+package routes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"eurofines-server/auth"
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+type directoryUser struct {
+	password string
+	role     string
+	entities []string
+	barred   bool
+}
+
+// directory stands in for the LDAP provider
+type directory struct {
+	users map[string]*directoryUser
+	down  bool
+	// during, when set, runs while a sign-in is being checked
+	during func()
+}
+
+func (d *directory) Name() string { return db.ProviderLDAP }
+
+func (d *directory) Authenticate(_ context.Context, email, password string, user *db.User) (*auth.Identity, error) {
+	if d.down {
+		return nil, errors.New("directory unreachable")
+	}
+	if d.during != nil {
+		d.during()
+	}
+	if user != nil && user.AuthProvider != db.ProviderLDAP {
+		return nil, auth.ErrUnknownUser
+	}
+	u, ok := d.users[email]
+	switch {
+	case !ok && user == nil:
+		return nil, auth.ErrUnknownUser
+	case !ok || u.password != password:
+		return nil, auth.ErrInvalidCredentials
+	case u.barred:
+		return nil, auth.ErrNotPermitted
+	}
+	return &auth.Identity{Email: email, Role: u.role, Entities: u.entities}, nil
+}
+
+func withDirectory(srv *apitest.Server) *directory {
+	d := &directory{users: map[string]*directoryUser{}}
+	srv.Auth.Providers = append(srv.Auth.Providers, d)
+	return d
+}
+
+func TestDirectorySignInProvisionsUser(t *testing.T) {
+	srv := apitest.New(t)
+	dir := withDirectory(srv)
+	dir.users["ann@example.com"] = &directoryUser{password: "directory-pw", role: "user", entities: []string{"agro"}}
+
+	attempt(srv, "ann@example.com", "wrong").Expect(http.StatusUnauthorized)
+	res := attempt(srv, "ann@example.com", "directory-pw").Expect(http.StatusOK).JSON()
+	if res["token"] == nil {
+		t.Fatalf("signin: %v", res)
+	}
+	var user db.User
+	if err := srv.DB.Where("email = ?", "ann@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.AuthProvider != db.ProviderLDAP || user.Role != "user" || user.Password != "" {
+		t.Fatalf("provisioned %+v", user)
+	}
+	entities, err := srv.Repos.Users.Entities(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entities[user.ID], []string{"agro"}) {
+		t.Fatalf("entities %v", entities)
+	}
+
+	// group changes in the directory apply on the next sign-in
+	dir.users["ann@example.com"].role = "admin"
+	token := attempt(srv, "ann@example.com", "directory-pw").Expect(http.StatusOK).JSON()["token"].(string)
+	srv.Do(http.MethodGet, "/api/admin/users", nil, apitest.Bearer(token)).Expect(http.StatusOK)
+
+	dir.users["ann@example.com"].barred = true
+	attempt(srv, "ann@example.com", "directory-pw").Expect(http.StatusForbidden)
+	dir.down = true
+	attempt(srv, "ann@example.com", "directory-pw").Expect(http.StatusServiceUnavailable)
+
+	// local accounts are still checked locally
+	local := srv.CreateUser("local@example.com", "user")
+	dir.users[local.Email] = &directoryUser{password: "directory-pw"}
+	dir.down = false
+	attempt(srv, local.Email, "directory-pw").Expect(http.StatusUnauthorized)
+	attempt(srv, local.Email, apitest.Password).Expect(http.StatusOK)
+}
+
+func TestDirectoryUsersHaveNoLocalPassword(t *testing.T) {
+	srv := apitest.New(t)
+	dir := withDirectory(srv)
+	dir.users["ann@example.com"] = &directoryUser{password: "directory-pw"}
+	token := attempt(srv, "ann@example.com", "directory-pw").Expect(http.StatusOK).JSON()["token"].(string)
+
+	srv.Do(http.MethodPost, "/api/auth/change-password",
+		map[string]string{"current_password": "directory-pw", "new_password": "A-new-password-1"},
+		apitest.Bearer(token)).Expect(http.StatusBadRequest)
+
+	forgotPassword(srv, "ann@example.com")
+	if n := len(srv.Mail.Messages()); n != 0 {
+		t.Fatalf("%d reset mails sent to a directory user", n)
+	}
+
+	var user db.User
+	srv.DB.Where("email = ?", "ann@example.com").First(&user)
+	srv.Do(http.MethodPost, userPath(user.ID, "/reset-password"), nil, apitest.Bearer(srv.AdminToken())).
+		Expect(http.StatusConflict)
+}
+
+func TestDirectorySignInDoesNotTakeOverAccounts(t *testing.T) {
+	srv := apitest.New(t)
+	dir := withDirectory(srv)
+	dir.users["bo@example.com"] = &directoryUser{password: "directory-pw", role: "user"}
+	// the account is created another way while the directory is asked
+	dir.during = func() { srv.CreateUser("bo@example.com", db.RoleUser) }
+
+	res := attempt(srv, "bo@example.com", "directory-pw").Expect(http.StatusConflict).JSON()
+	if res["error"] != "an account with this email address already signs in another way" {
+		t.Fatalf("sign-in = %v", res)
+	}
+	var failed int64
+	srv.DB.Model(&db.AuditLog{}).Where("action = ? AND user_email = ? AND details = ?",
+		db.AuditLoginFailed, "bo@example.com", "account signs in another way").Count(&failed)
+	if failed != 1 {
+		t.Fatalf("%d failed sign-ins recorded, want 1", failed)
+	}
+}
@@ -0,0 +1,152 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+)
+
+// register describes one archive register for the table-driven tests
+type register struct {
+	path     string
+	singular string
+	plural   string
+	create   map[string]interface{}
+	field    string // a text field to update
+}
+
+var registers = []register{
+	{
+		path: "/api/test-items", singular: "test_item", plural: "test_items",
+		create: map[string]interface{}{"test_item_name": "Caffeine", "test_item_code": "TI-900", "entity": "agro"},
+		field:  "remark",
+	},
+	{
+		path: "/api/studies", singular: "study", plural: "studies",
+		create: map[string]interface{}{"study_number": "ST-900", "study_code": "SC-900", "entity": "agro"},
+		field:  "remarks",
+	},
+	{
+		path: "/api/facility-docs", singular: "facility_doc", plural: "facility_docs",
+		create: map[string]interface{}{"particulars": "Balance log", "dept_section": "QC", "entity": "agro"},
+		field:  "admin_remarks",
+	},
+}
+
+func recordID(t *testing.T, record map[string]interface{}) string {
+	t.Helper()
+	id, ok := record["id"].(float64)
+	if !ok {
+		t.Fatalf("record has no id: %v", record)
+	}
+	return fmt.Sprint(int(id))
+}
+
+func TestRecordLifecycle(t *testing.T) {
+	for _, reg := range registers {
+		t.Run(reg.singular, func(t *testing.T) {
+			srv := apitest.New(t)
+			admin := apitest.Bearer(srv.AdminToken())
+
+			created := srv.Do(http.MethodPost, reg.path, reg.create, admin).Expect(http.StatusCreated).
+				JSON()[reg.singular].(map[string]interface{})
+			id := recordID(t, created)
+			if created["version"] != float64(1) {
+				t.Fatalf("new record version = %v, want 1", created["version"])
+			}
+
+			got := srv.Do(http.MethodGet, reg.path+"/"+id, nil, admin).Expect(http.StatusOK)
+			if got.Header().Get("ETag") != `"1"` {
+				t.Fatalf("ETag = %q, want \"1\"", got.Header().Get("ETag"))
+			}
+			srv.Do(http.MethodGet, reg.path+"/"+id, nil, admin, apitest.Header{Name: "If-None-Match", Value: `"1"`}).
+				Expect(http.StatusNotModified)
+
+			list := srv.Do(http.MethodGet, reg.path, nil, admin).Expect(http.StatusOK).JSON()[reg.plural].([]interface{})
+			if len(list) != 1 {
+				t.Fatalf("list has %d records, want 1", len(list))
+			}
+
+			updated := srv.Do(http.MethodPatch, reg.path+"/"+id, map[string]interface{}{reg.field: "checked"},
+				apitest.Header{Name: "If-Match", Value: `"1"`}, admin).Expect(http.StatusOK).JSON()[reg.singular].(map[string]interface{})
+			if updated[reg.field] != "checked" || updated["version"] != float64(2) {
+				t.Fatalf("update returned %v", updated)
+			}
+
+			// a second writer still holding version 1 must not overwrite
+			conflict := srv.Do(http.MethodPut, reg.path+"/"+id, map[string]interface{}{reg.field: "stale", "version": 1}, admin).
+				Expect(http.StatusConflict).JSON()
+			if current := conflict["current"].(map[string]interface{}); current[reg.field] != "checked" {
+				t.Fatalf("conflict current = %v", current)
+			}
+
+			srv.Do(http.MethodDelete, reg.path+"/"+id, map[string]string{"reason": "entered twice"}, admin).
+				Expect(http.StatusOK)
+			srv.Do(http.MethodGet, reg.path+"/"+id, nil, admin).Expect(http.StatusNotFound)
+			if list := srv.Do(http.MethodGet, reg.path, nil, admin).Expect(http.StatusOK).JSON()[reg.plural].([]interface{}); len(list) != 0 {
+				t.Fatalf("deleted record still listed: %v", list)
+			}
+			deleted := srv.Do(http.MethodGet, reg.path+"/deleted", nil, admin).Expect(http.StatusOK).
+				JSON()[reg.plural].([]interface{})
+			if len(deleted) != 1 || deleted[0].(map[string]interface{})["deletion_reason"] != "entered twice" {
+				t.Fatalf("deleted list = %v", deleted)
+			}
+
+			srv.Do(http.MethodDelete, reg.path+"/"+id+"/purge", nil, admin).Expect(http.StatusConflict)
+			srv.Do(http.MethodPost, reg.path+"/"+id+"/restore", nil, admin).Expect(http.StatusOK)
+			srv.Do(http.MethodGet, reg.path+"/"+id, nil, admin).Expect(http.StatusOK)
+
+			versions := srv.Do(http.MethodGet, reg.path+"/"+id+"/versions", nil, admin).Expect(http.StatusOK).
+				JSON()["versions"].([]interface{})
+			if len(versions) != 4 {
+				t.Fatalf("got %d versions, want 4 (create, update, delete, restore)", len(versions))
+			}
+			diff := srv.Do(http.MethodGet, reg.path+"/"+id+"/diff?from=1&to=2", nil, admin).Expect(http.StatusOK).
+				JSON()["changes"].([]interface{})
+			if len(diff) != 1 || diff[0].(map[string]interface{})["field"] != reg.field {
+				t.Fatalf("diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestRecordValidation(t *testing.T) {
+	for _, reg := range registers {
+		t.Run(reg.singular, func(t *testing.T) {
+			srv := apitest.New(t)
+			admin := apitest.Bearer(srv.AdminToken())
+			id := recordID(t, srv.Do(http.MethodPost, reg.path, reg.create, admin).Expect(http.StatusCreated).
+				JSON()[reg.singular].(map[string]interface{}))
+			ifMatch := apitest.Header{Name: "If-Match", Value: `"1"`}
+
+			invalidEntity := map[string]interface{}{}
+			for k, v := range reg.create {
+				invalidEntity[k] = v
+			}
+			invalidEntity["entity"] = "pharma"
+			srv.Do(http.MethodPost, reg.path, invalidEntity, admin).Expect(http.StatusBadRequest)
+			srv.Do(http.MethodPost, reg.path, map[string]interface{}{}, admin).Expect(http.StatusBadRequest)
+			srv.Do(http.MethodPost, reg.path, `{"entity":`, admin).Expect(http.StatusBadRequest)
+
+			srv.Do(http.MethodGet, reg.path+"/abc", nil, admin).Expect(http.StatusBadRequest)
+			srv.Do(http.MethodGet, reg.path+"/9999", nil, admin).Expect(http.StatusNotFound)
+			// reads of single records are logged, so they need a user
+			srv.Do(http.MethodGet, reg.path+"/9999", nil).Expect(http.StatusUnauthorized)
+			srv.Do(http.MethodGet, reg.path+"?entity=pharma", nil, admin).Expect(http.StatusBadRequest)
+
+			srv.Do(http.MethodPatch, reg.path+"/"+id, map[string]interface{}{reg.field: "x"}, admin).
+				Expect(http.StatusPreconditionRequired)
+			srv.Do(http.MethodPatch, reg.path+"/"+id, map[string]interface{}{reg.field: "x"},
+				apitest.Header{Name: "If-Match", Value: "abc"}, admin).Expect(http.StatusBadRequest)
+			srv.Do(http.MethodPatch, reg.path+"/"+id, map[string]interface{}{}, ifMatch, admin).Expect(http.StatusBadRequest)
+			srv.Do(http.MethodPatch, reg.path+"/9999", map[string]interface{}{reg.field: "x"}, ifMatch, admin).
+				Expect(http.StatusNotFound)
+
+			srv.Do(http.MethodDelete, reg.path+"/"+id, map[string]string{"reason": "  "}, admin).
+				Expect(http.StatusBadRequest)
+			srv.Do(http.MethodPost, reg.path+"/"+id+"/restore", nil, admin).Expect(http.StatusNotFound)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler owns the endpoints that define roles and their permissions.
+// Roles apply across entities, so only users who manage every entity may
+// change them.
+type RoleHandler struct {
+	Roles repository.RoleRepository
+}
+
+// roleView is a role with its permissions as a list
+type roleView struct {
+	db.Role
+	Permissions []string `json:"permissions"`
+}
+
+func newRoleView(role db.Role) roleView {
+	return roleView{Role: role, Permissions: role.PermissionList()}
+}
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9-]{1,49}$`)
+
+type roleReq struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// ListRoles handles GET /api/admin/roles
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.Roles.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	views := make([]roleView, len(roles))
+	for i, role := range roles {
+		views[i] = newRoleView(role)
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": views, "permissions": db.Permissions})
+}
+
+// CreateRole handles POST /api/admin/roles
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	req, perms, ok := h.bindRole(c)
+	if !ok {
+		return
+	}
+	if !roleName.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 2-50 lower-case letters, digits or dashes, starting with a letter"})
+		return
+	}
+
+	role := db.Role{Name: req.Name, Description: strings.TrimSpace(req.Description), Permissions: strings.Join(perms, ",")}
+	if err := h.Roles.Create(c.Request.Context(), &role, requestActor(c)); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"role": newRoleView(role)})
+}
+
+// UpdateRole handles PUT /api/admin/roles/:name, replacing the description
+// and permissions. The admin role always has every permission.
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	req, perms, ok := h.bindRole(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	if name == db.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the admin role cannot be changed"})
+		return
+	}
+
+	role, err := h.Roles.Update(c.Request.Context(), name, strings.TrimSpace(req.Description), perms, requestActor(c))
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": newRoleView(*role)})
+}
+
+// DeleteRole handles DELETE /api/admin/roles/:name for a role nobody holds
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if !managesAllEntities(c) {
+		return
+	}
+	if err := h.Roles.Delete(c.Request.Context(), c.Param("name"), requestActor(c)); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
+
+// bindRole reads a role definition, returning its permissions in canonical order
+func (h *RoleHandler) bindRole(c *gin.Context) (roleReq, []string, bool) {
+	var req roleReq
+	if !managesAllEntities(c) {
+		return req, nil, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, nil, false
+	}
+	for _, p := range req.Permissions {
+		if !slices.Contains(db.Permissions, p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid permission: " + p})
+			return req, nil, false
+		}
+	}
+	return req, canonicalPermissions(req.Permissions), true
+}
+
+// managesAllEntities answers 403 unless the user may manage users in every
+// entity
+func managesAllEntities(c *gin.Context) bool {
+	if _, limited := permittedEntities(c); limited {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins of every entity can do this"})
+		return false
+	}
+	return true
+}
+
+// canonicalPermissions returns the requested permissions once each, in the
+// order of db.Permissions
+func canonicalPermissions(requested []string) []string {
+	perms := []string{}
+	for _, p := range db.Permissions {
+		if slices.Contains(requested, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+func writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+	case errors.Is(err, repository.ErrRoleExists), errors.Is(err, repository.ErrRoleInUse), errors.Is(err, repository.ErrRoleBuiltin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,175 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"eurofines-server/db"
+	"eurofines-server/internal/apitest"
+)
+
+func TestPermissionsFollowEntityRoles(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	clerk := srv.CreateUser("clerk@example.com", db.RoleUser)
+	token := apitest.Bearer(srv.Login("clerk@example.com"))
+	agroItem := fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID)
+	adgylItem := fmt.Sprintf("/api/test-items/%d", fx.TestItems["adgyl"].ID)
+	reason := map[string]string{"reason": "entered twice"}
+
+	// the base user role registers records but does not archive them
+	srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{"study_number": "ST-1", "entity": "agro"}, token).
+		Expect(http.StatusCreated)
+	denied := srv.Do(http.MethodDelete, agroItem, reason, token).Expect(http.StatusForbidden).JSON()
+	if denied["permission"] != db.PermArchive {
+		t.Fatalf("refusal = %v", denied)
+	}
+
+	user := srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", clerk.ID), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "agro", "role": "archivist"}},
+	}, admin).Expect(http.StatusOK).JSON()["user"].(map[string]interface{})
+	if roles := user["entity_roles"].([]interface{}); len(roles) != 1 {
+		t.Fatalf("entity_roles = %v", roles)
+	}
+
+	// archivist in agro only: other entities' records are out of reach
+	srv.Do(http.MethodDelete, adgylItem, reason, token).Expect(http.StatusNotFound)
+	srv.Do(http.MethodDelete, agroItem, reason, token).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, adgylItem, reason, admin).Expect(http.StatusOK)
+	deleted := srv.Do(http.MethodGet, "/api/test-items/deleted", nil, token).Expect(http.StatusOK).
+		JSON()["test_items"].([]interface{})
+	if len(deleted) != 1 || deleted[0].(map[string]interface{})["entity"] != "agro" {
+		t.Fatalf("deleted list = %v", deleted)
+	}
+	srv.Do(http.MethodGet, "/api/test-items/deleted?entity=adgyl", nil, token).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, adgylItem+"/restore", nil, token).Expect(http.StatusNotFound)
+	srv.Do(http.MethodPost, agroItem+"/restore", nil, token).Expect(http.StatusOK)
+	// disposal needs its own permission
+	srv.Do(http.MethodDelete, agroItem+"/purge", nil, token).Expect(http.StatusForbidden)
+
+	// nobody changes their own roles, and unknown roles are refused
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", clerk.ID), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "agro", "role": "janitor"}},
+	}, admin).Expect(http.StatusBadRequest)
+	adminUser := srv.Do(http.MethodGet, "/api/admin/users?q=admin@", nil, admin).JSON()["users"].([]interface{})[0]
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%v/roles", adminUser.(map[string]interface{})["id"]),
+		map[string]interface{}{"roles": []map[string]string{}}, admin).Expect(http.StatusBadRequest)
+}
+
+func TestBaseRoleAppliesInMemberEntities(t *testing.T) {
+	srv := apitest.New(t)
+	srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	member := srv.CreateUser("member@example.com", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/entities", member.ID), map[string]interface{}{"entities": []string{"biopharma"}},
+		admin).Expect(http.StatusOK)
+	token := apitest.Bearer(srv.Login("member@example.com"))
+
+	results := srv.Do(http.MethodGet, "/api/search?q=calibration", nil, token).Expect(http.StatusOK).
+		JSON()["results"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["entity"] != "biopharma" {
+		t.Fatalf("member searched %v", results)
+	}
+	srv.Do(http.MethodGet, "/api/search?q=calibration&entity=agro", nil, token).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "x", "entity": "agro"}, token).
+		Expect(http.StatusForbidden)
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "x", "entity": "biopharma"}, token).
+		Expect(http.StatusCreated)
+	srv.Do(http.MethodGet, "/api/admin/roles", nil, token).Expect(http.StatusForbidden)
+}
+
+func TestRoleManagement(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+
+	roles := srv.Do(http.MethodGet, "/api/admin/roles", nil, admin).Expect(http.StatusOK).JSON()["roles"].([]interface{})
+	if first := roles[0].(map[string]interface{}); first["name"] != db.RoleAdmin || len(first["permissions"].([]interface{})) != len(db.Permissions) {
+		t.Fatalf("roles = %v", roles)
+	}
+
+	created := srv.Do(http.MethodPost, "/api/admin/roles", map[string]interface{}{
+		"name": "indexer", "description": "Indexes incoming records", "permissions": []string{"index", "edit", "index"},
+	}, admin).Expect(http.StatusCreated).JSON()["role"].(map[string]interface{})
+	if perms := fmt.Sprint(created["permissions"]); perms != "[edit index]" {
+		t.Fatalf("permissions = %s", perms)
+	}
+	srv.Do(http.MethodPost, "/api/admin/roles", map[string]interface{}{"name": "indexer", "permissions": []string{"index"}}, admin).
+		Expect(http.StatusConflict)
+	srv.Do(http.MethodPost, "/api/admin/roles", map[string]interface{}{"name": "x y", "permissions": []string{"index"}}, admin).
+		Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, "/api/admin/roles", map[string]interface{}{"name": "shredder", "permissions": []string{"shred"}}, admin).
+		Expect(http.StatusBadRequest)
+
+	srv.Do(http.MethodPut, "/api/admin/roles/indexer", map[string]interface{}{"permissions": []string{"index"}}, admin).
+		Expect(http.StatusOK)
+	srv.Do(http.MethodPut, "/api/admin/roles/admin", map[string]interface{}{"permissions": []string{"index"}}, admin).
+		Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPut, "/api/admin/roles/nobody", map[string]interface{}{"permissions": []string{}}, admin).
+		Expect(http.StatusNotFound)
+
+	user := srv.CreateUser("indexer@example.com", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", user.ID), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "*", "role": "indexer"}},
+	}, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, "/api/admin/roles/indexer", nil, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodDelete, "/api/admin/roles/user", nil, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", user.ID), map[string]interface{}{"roles": []map[string]string{}},
+		admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, "/api/admin/roles/indexer", nil, admin).Expect(http.StatusOK)
+}
+
+func TestStudyDirectorsReadOwnStudies(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	// a member of adgyl who directs studies in agro
+	director := srv.CreateUser("sd@example.com", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/entities", director.ID), map[string]interface{}{"entities": []string{"adgyl"}},
+		admin).Expect(http.StatusOK)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", director.ID), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "agro", "role": "study-director"}},
+	}, admin).Expect(http.StatusOK)
+	person := srv.Do(http.MethodPost, "/api/personnel", map[string]interface{}{
+		"name": "Dr. Rao", "roles": []string{"study-director"}, "user_id": director.ID,
+	}, admin).Expect(http.StatusCreated).JSON()["person"].(map[string]interface{})
+	own := fmt.Sprintf("/api/studies/%d", fx.Studies["agro"].ID)
+	srv.Do(http.MethodPatch, own, map[string]interface{}{"study_director_id": person["id"], "version": 1}, admin).
+		Expect(http.StatusOK)
+	other := srv.Do(http.MethodPost, "/api/studies", map[string]interface{}{"study_number": "ST-OTHER", "entity": "agro"}, admin).
+		Expect(http.StatusCreated).JSON()["study"].(map[string]interface{})
+	token := apitest.Bearer(srv.Login(director.Email))
+
+	studies := srv.Do(http.MethodGet, "/api/studies", nil, token).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	entities := map[interface{}]bool{}
+	for _, s := range studies {
+		entities[s.(map[string]interface{})["entity"]] = true
+	}
+	if len(studies) != 2 || !entities["adgyl"] || !entities["agro"] {
+		t.Fatalf("studies = %v", studies)
+	}
+	studies = srv.Do(http.MethodGet, "/api/studies?entity=agro", nil, token).Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(studies) != 1 || studies[0].(map[string]interface{})["id"] != float64(fx.Studies["agro"].ID) {
+		t.Fatalf("agro studies = %v", studies)
+	}
+	srv.Do(http.MethodGet, "/api/studies?entity=biopharma", nil, token).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodGet, "/api/test-items?entity=agro", nil, token).Expect(http.StatusBadRequest)
+
+	srv.Do(http.MethodGet, own, nil, token).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/studies/%v", other["id"]), nil, token).Expect(http.StatusNotFound)
+	srv.Do(http.MethodGet, fmt.Sprintf("/api/studies/%d", fx.Studies["biopharma"].ID), nil, token).Expect(http.StatusNotFound)
+
+	// without a linked personnel entry the role shows no studies
+	unlinked := srv.CreateUser("sd2@example.com", db.RoleUser)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/entities", unlinked.ID), map[string]interface{}{"entities": []string{"adgyl"}},
+		admin).Expect(http.StatusOK)
+	srv.Do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", unlinked.ID), map[string]interface{}{
+		"roles": []map[string]string{{"entity": "*", "role": "study-director"}},
+	}, admin).Expect(http.StatusOK)
+	studies = srv.Do(http.MethodGet, "/api/studies?entity=agro", nil, apitest.Bearer(srv.Login(unlinked.Email))).
+		Expect(http.StatusOK).JSON()["studies"].([]interface{})
+	if len(studies) != 0 {
+		t.Fatalf("unlinked director sees %v", studies)
+	}
+}
@@ -1,16 +1,62 @@
 package routes
 
 import (
+	"eurofines-server/auth"
+	"eurofines-server/config"
+	"eurofines-server/db"
+	"eurofines-server/mail"
+	"eurofines-server/middleware"
+	"eurofines-server/repository"
+	"eurofines-server/utils"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupRoutes(r *gin.Engine, db *gorm.DB) {
+// SetupRoutes registers every API route. Handlers reach the database only
+// through repos; cfg is the configuration loaded once at startup, which
+// handlers read instead of the environment.
+func SetupRoutes(r *gin.Engine, repos *repository.Repositories, authenticator *auth.Authenticator, mailer mail.Mailer, cfg *config.Config) {
+	tokens := utils.NewTokenManager(cfg.JWTSecret, cfg.JWTExpiry, repos.Sessions)
+	authn := middleware.AuthMiddleware(tokens, repos.Users, cfg.PasswordMaxAge)
+	// only lets through users who must change their password to do so
+	passwordChange := middleware.PasswordChangeMiddleware(tokens, repos.Users)
+	// users who may manage users or dispose of records in an entity listed in
+	// MFARequiredEntities need a verified second factor for archiving,
+	// disposal and user management
+	mfa := middleware.RequireMFA(func(c *gin.Context) (bool, error) {
+		grants, _ := c.Get("grants")
+		g, _ := grants.(db.Grants)
+		return mfaRequiredFor(cfg, g), nil
+	})
+	need := middleware.RequirePermission
+	// also lets study directors read the studies they direct
+	needOwn := func(perm string) gin.HandlerFunc {
+		return middleware.RequireOwnPermission(perm, db.PermIndexOwn, repos.Personnel)
+	}
+	// takes the purpose of reads that the access log records
+	read := middleware.AccessPurpose(func() bool { return cfg.AccessPurposeRequired })
+
 	// create handler instances if you prefer object style
-	auth := &AuthHandler{}
-	ti := &TestItemHandler{}
-	st := &StudyHandler{}
-	fd := &FacilityDocHandler{}
+	auth := &AuthHandler{Users: repos.Users, Invitations: repos.Invitations, Sessions: repos.Sessions,
+		Resets: repos.Resets, MFA: repos.MFA, OIDCLogins: repos.OIDCLogins, Auth: authenticator, Tokens: tokens, Mailer: mailer, Config: cfg}
+	ti := &TestItemHandler{Repo: repos.TestItems, Sponsors: repos.Sponsors, Personnel: repos.Personnel, AccessLog: repos.AccessLog, Config: cfg}
+	st := &StudyHandler{Repo: repos.Studies, Sponsors: repos.Sponsors, Personnel: repos.Personnel, AccessLog: repos.AccessLog, Config: cfg}
+	fd := &FacilityDocHandler{Repo: repos.FacilityDocs, Personnel: repos.Personnel, AccessLog: repos.AccessLog, Config: cfg}
+	search := &SearchHandler{Repo: repos.Search}
+	users := &UserAdminHandler{Users: repos.Users, Sessions: repos.Sessions, MFA: repos.MFA, Config: cfg}
+	invites := &InvitationHandler{Invitations: repos.Invitations, Users: repos.Users, Config: cfg}
+	apiKeys := &APIKeyHandler{Keys: repos.APIKeys, Users: repos.Users, Config: cfg}
+	roles := &RoleHandler{Roles: repos.Roles}
+	disposals := &DisposalHandler{Disposals: repos.Disposals, TestItems: repos.TestItems}
+	sponsors := &SponsorHandler{Sponsors: repos.Sponsors}
+	personnel := &PersonnelHandler{Personnel: repos.Personnel, Users: repos.Users}
+	sp := &PortalHandler{Portal: repos.Portal, Disposals: repos.Disposals, AccessLog: repos.AccessLog}
+	accessLog := &AccessLogHandler{AccessLog: repos.AccessLog}
+
+	// routes machine integrations may call with an API key granting the scope
+	readItems := middleware.APIKeyMiddleware(repos.APIKeys, db.ScopeTestItemsRead)
+	writeItems := middleware.APIKeyMiddleware(repos.APIKeys, db.ScopeTestItemsWrite)
+	export := middleware.APIKeyMiddleware(repos.APIKeys, db.ScopeExport)
 
 	api := r.Group("/api")
 
@@ -18,23 +64,138 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB) {
 	authGroup := api.Group("/auth")
 	authGroup.POST("/signup", auth.SignUp)
 	authGroup.POST("/signin", auth.SignIn)
-	authGroup.GET("/me", auth.GetCurrentUser) // protect with auth middleware later
+	authGroup.POST("/refresh", auth.Refresh)
+	authGroup.POST("/logout", passwordChange, auth.Logout)
+	authGroup.POST("/change-password", passwordChange, auth.ChangePassword)
+	authGroup.POST("/forgot-password", auth.ForgotPassword)
+	authGroup.POST("/reset-password", auth.ResetPassword)
+	authGroup.POST("/oidc/start", auth.StartOIDC)
+	authGroup.POST("/oidc/callback", auth.OIDCCallback)
+	authGroup.POST("/mfa/verify", auth.VerifyMFA)
+	authGroup.GET("/mfa", authn, auth.MFAStatus)
+	authGroup.POST("/mfa/enroll", authn, auth.EnrollMFA)
+	authGroup.POST("/mfa/confirm", authn, auth.ConfirmMFA)
+	authGroup.POST("/mfa/recovery-codes", authn, auth.RegenerateRecoveryCodes)
+	authGroup.DELETE("/mfa", authn, auth.DisableMFA)
+	authGroup.GET("/me", authn, auth.GetCurrentUser)
 
 	// test items
 	items := api.Group("/test-items")
-	items.POST("", ti.CreateTestItem)
-	items.GET("", ti.GetTestItems)
-	items.GET("/:id", ti.GetTestItem)     // implement if you want
-	items.PUT("/:id", ti.UpdateTestItem)  // implement
-	items.DELETE("/:id", ti.DeleteTestItem) // implement
+	items.POST("", writeItems, authn, need(db.PermCreate), ti.CreateTestItem)
+	items.GET("", readItems, authn, need(db.PermIndex), ti.GetTestItems)
+	items.GET("/export", export, authn, need(db.PermExport), read, ti.ExportTestItems)
+	items.GET("/deleted", authn, need(db.PermArchive), mfa, ti.GetDeletedTestItems)
+	items.GET("/:id", readItems, authn, need(db.PermIndex), read, ti.GetTestItem) // implement if you want
+	items.PUT("/:id", writeItems, authn, need(db.PermEdit), ti.UpdateTestItem)
+	items.PATCH("/:id", writeItems, authn, need(db.PermEdit), ti.UpdateTestItem)
+	items.DELETE("/:id", authn, need(db.PermArchive), mfa, ti.DeleteTestItem)
+	items.POST("/:id/restore", authn, need(db.PermArchive), mfa, ti.RestoreTestItem)
+	items.DELETE("/:id/purge", authn, need(db.PermDispose), mfa, ti.PurgeTestItem)
+	items.POST("/:id/disposal-requests", authn, need(db.PermDispose), mfa, disposals.RequestDisposal)
+	items.GET("/:id/versions", authn, need(db.PermAuditRead), read, ti.GetTestItemVersions)
+	items.GET("/:id/versions/:n", authn, need(db.PermAuditRead), read, ti.GetTestItemVersion)
+	items.GET("/:id/diff", authn, need(db.PermAuditRead), read, ti.DiffTestItem)
 
 	// studies
 	stud := api.Group("/studies")
-	stud.POST("", st.CreateStudy)
-	stud.GET("", st.GetStudies)
+	stud.POST("", authn, need(db.PermCreate), st.CreateStudy)
+	stud.GET("", authn, needOwn(db.PermIndex), st.GetStudies)
+	stud.GET("/export", export, authn, need(db.PermExport), read, st.ExportStudies)
+	stud.GET("/deleted", authn, need(db.PermArchive), mfa, st.GetDeletedStudies)
+	stud.GET("/:id", authn, needOwn(db.PermIndex), read, st.GetStudy)
+	stud.PUT("/:id", authn, need(db.PermEdit), st.UpdateStudy)
+	stud.PATCH("/:id", authn, need(db.PermEdit), st.UpdateStudy)
+	stud.DELETE("/:id", authn, need(db.PermArchive), mfa, st.DeleteStudy)
+	stud.POST("/:id/restore", authn, need(db.PermArchive), mfa, st.RestoreStudy)
+	stud.DELETE("/:id/purge", authn, need(db.PermDispose), mfa, st.PurgeStudy)
+	stud.GET("/:id/versions", authn, need(db.PermAuditRead), read, st.GetStudyVersions)
+	stud.GET("/:id/versions/:n", authn, need(db.PermAuditRead), read, st.GetStudyVersion)
+	stud.GET("/:id/diff", authn, need(db.PermAuditRead), read, st.DiffStudy)
 
 	// facility docs
 	fdGroup := api.Group("/facility-docs")
-	fdGroup.POST("", fd.CreateFacilityDoc)
-	fdGroup.GET("", fd.GetFacilityDocs)
+	fdGroup.POST("", authn, need(db.PermCreate), fd.CreateFacilityDoc)
+	fdGroup.GET("", authn, need(db.PermIndex), fd.GetFacilityDocs)
+	fdGroup.GET("/export", export, authn, need(db.PermExport), read, fd.ExportFacilityDocs)
+	fdGroup.GET("/deleted", authn, need(db.PermArchive), mfa, fd.GetDeletedFacilityDocs)
+	fdGroup.GET("/:id", authn, need(db.PermIndex), read, fd.GetFacilityDoc)
+	fdGroup.PUT("/:id", authn, need(db.PermEdit), fd.UpdateFacilityDoc)
+	fdGroup.PATCH("/:id", authn, need(db.PermEdit), fd.UpdateFacilityDoc)
+	fdGroup.DELETE("/:id", authn, need(db.PermArchive), mfa, fd.DeleteFacilityDoc)
+	fdGroup.POST("/:id/restore", authn, need(db.PermArchive), mfa, fd.RestoreFacilityDoc)
+	fdGroup.DELETE("/:id/purge", authn, need(db.PermDispose), mfa, fd.PurgeFacilityDoc)
+	fdGroup.GET("/:id/versions", authn, need(db.PermAuditRead), read, fd.GetFacilityDocVersions)
+	fdGroup.GET("/:id/versions/:n", authn, need(db.PermAuditRead), read, fd.GetFacilityDocVersion)
+	fdGroup.GET("/:id/diff", authn, need(db.PermAuditRead), read, fd.DiffFacilityDoc)
+
+	// sponsor master data, shared by every entity
+	sponsorGroup := api.Group("/sponsors", authn)
+	sponsorGroup.GET("", need(db.PermIndex), sponsors.ListSponsors)
+	sponsorGroup.GET("/:id", need(db.PermIndex), sponsors.GetSponsor)
+	sponsorGroup.POST("", need(db.PermEdit), sponsors.CreateSponsor)
+	sponsorGroup.PUT("/:id", need(db.PermEdit), sponsors.UpdateSponsor)
+	sponsorGroup.DELETE("/:id", need(db.PermEdit), sponsors.DeleteSponsor)
+
+	// personnel directory, shared by every entity
+	people := api.Group("/personnel", authn)
+	people.GET("", need(db.PermIndex), personnel.ListPersonnel)
+	people.GET("/:id", need(db.PermIndex), personnel.GetPerson)
+	people.GET("/:id/studies", need(db.PermIndex), personnel.GetPersonStudies)
+	people.GET("/:id/archived", need(db.PermIndex), personnel.GetPersonArchived)
+	people.POST("", need(db.PermEdit), personnel.CreatePerson)
+	people.PUT("/:id", need(db.PermEdit), personnel.UpdatePerson)
+	people.DELETE("/:id", need(db.PermEdit), personnel.DeletePerson)
+
+	// disposal requests awaiting or given sponsor approval
+	api.GET("/disposal-requests", authn, need(db.PermDispose), disposals.ListDisposals)
+
+	// sponsor portal: read-only, limited to the sponsor account's company
+	portal := api.Group("/sponsor", authn, middleware.SponsorOnly())
+	portal.GET("/test-items", sp.GetTestItems)
+	portal.GET("/test-items/:id", read, sp.GetTestItem)
+	portal.GET("/studies", sp.GetStudies)
+	portal.GET("/studies/:id", read, sp.GetStudy)
+	portal.GET("/disposal-requests", sp.GetDisposals)
+	portal.POST("/disposal-requests/:id/approve", sp.ApproveDisposal)
+
+	// full-text search across all registers
+	api.GET("/search", authn, need(db.PermIndex), search.Search)
+
+	// who read which archive record, for QA
+	api.GET("/access-log", authn, need(db.PermAuditRead), accessLog.ListAccessLog)
+
+	// user management
+	adminUsers := api.Group("/admin/users", authn, need(db.PermManageUsers), mfa)
+	adminUsers.GET("", users.ListUsers)
+	adminUsers.GET("/:id", users.GetUser)
+	adminUsers.PUT("/:id/role", users.SetUserRole)
+	adminUsers.POST("/:id/deactivate", users.DeactivateUser)
+	adminUsers.POST("/:id/activate", users.ActivateUser)
+	adminUsers.POST("/:id/approve", users.ApproveUser)
+	adminUsers.POST("/:id/unlock", users.UnlockUser)
+	adminUsers.PUT("/:id/entities", users.SetUserEntities)
+	adminUsers.POST("/:id/reset-password", users.ResetUserPassword)
+	adminUsers.POST("/:id/revoke-sessions", users.RevokeUserSessions)
+	adminUsers.POST("/:id/reset-mfa", users.ResetUserMFA)
+	adminUsers.PUT("/:id/roles", users.SetUserEntityRoles)
+	adminUsers.PUT("/:id/sponsor", users.SetUserSponsor)
+
+	// signup invitations
+	invitations := api.Group("/admin/invitations", authn, need(db.PermManageUsers), mfa)
+	invitations.POST("", invites.CreateInvitation)
+	invitations.GET("", invites.ListInvitations)
+	invitations.DELETE("/:id", invites.RevokeInvitation)
+
+	// API keys for machine integrations
+	keys := api.Group("/admin/api-keys", authn, need(db.PermManageUsers), mfa)
+	keys.POST("", apiKeys.CreateAPIKey)
+	keys.GET("", apiKeys.ListAPIKeys)
+	keys.DELETE("/:id", apiKeys.RevokeAPIKey)
+
+	// roles and their permissions
+	roleGroup := api.Group("/admin/roles", authn, need(db.PermManageUsers), mfa)
+	roleGroup.GET("", roles.ListRoles)
+	roleGroup.POST("", roles.CreateRole)
+	roleGroup.PUT("/:name", roles.UpdateRole)
+	roleGroup.DELETE("/:name", roles.DeleteRole)
 }
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchHandler owns the cross-register full-text search
+type SearchHandler struct {
+	Repo repository.SearchRepository
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Search handles GET /api/search?q=&entity=&type=&limit=
+//
+// q uses web-search syntax ("quoted phrases", -exclusions, or). type is an
+// optional comma separated list of test_item, study and facility_doc.
+func (h *SearchHandler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tables, err := searchTablesFor(c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	results, err := h.Repo.Search(c.Request.Context(), repository.SearchQuery{
+		Text:     q,
+		Entity:   filter.Entity,
+		Entities: filter.Entities,
+		Tables:   tables,
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": q, "results": results})
+}
+
+// searchTablesFor resolves the ?type= list, defaulting to all registers
+func searchTablesFor(types string) ([]db.SearchTable, error) {
+	if strings.TrimSpace(types) == "" {
+		return db.SearchTables, nil
+	}
+	var tables []db.SearchTable
+	for _, name := range strings.Split(types, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, t := range db.SearchTables {
+			if t.Type == name {
+				tables = append(tables, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid type: %s, expected test_item, study or facility_doc", name)
+		}
+	}
+	return tables, nil
+}
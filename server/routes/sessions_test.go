@@ -0,0 +1,97 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+)
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func signIn(t *testing.T, srv *apitest.Server, email string) tokenPair {
+	t.Helper()
+	var out tokenPair
+	srv.Do(http.MethodPost, "/api/auth/signin", map[string]string{"email": email, "password": apitest.Password}).
+		Expect(http.StatusOK).Decode(&out)
+	if out.Token == "" || out.RefreshToken == "" || out.ExpiresIn <= 0 {
+		t.Fatalf("signin returned %+v", out)
+	}
+	return out
+}
+
+func refresh(srv *apitest.Server, token string) *apitest.Response {
+	return srv.Do(http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": token})
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("someone@example.com", "user")
+	first := signIn(t, srv, "someone@example.com")
+
+	var second tokenPair
+	refresh(srv, first.RefreshToken).Expect(http.StatusOK).Decode(&second)
+	if second.RefreshToken == first.RefreshToken || second.Token == first.Token {
+		t.Fatalf("refresh did not rotate tokens: %+v", second)
+	}
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(second.Token)).Expect(http.StatusOK)
+
+	// replaying the rotated token is treated as theft and ends the session
+	refresh(srv, first.RefreshToken).Expect(http.StatusUnauthorized)
+	refresh(srv, second.RefreshToken).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(second.Token)).Expect(http.StatusUnauthorized)
+
+	refresh(srv, "unknown").Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodPost, "/api/auth/refresh", map[string]string{}).Expect(http.StatusBadRequest)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	srv := apitest.New(t)
+	srv.CreateUser("someone@example.com", "user")
+	session := signIn(t, srv, "someone@example.com")
+	other := signIn(t, srv, "someone@example.com")
+
+	srv.Do(http.MethodPost, "/api/auth/logout", nil).Expect(http.StatusUnauthorized)
+	srv.Do(http.MethodPost, "/api/auth/logout", nil, apitest.Bearer(session.Token)).Expect(http.StatusNoContent)
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(session.Token)).Expect(http.StatusUnauthorized)
+	refresh(srv, session.RefreshToken).Expect(http.StatusUnauthorized)
+
+	// other sessions of the same user are unaffected
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(other.Token)).Expect(http.StatusOK)
+	refresh(srv, other.RefreshToken).Expect(http.StatusOK)
+}
+
+func TestAdminRevokesAllSessions(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	u := srv.CreateUser("someone@example.com", "user")
+	a := signIn(t, srv, u.Email)
+	b := signIn(t, srv, u.Email)
+
+	res := srv.Do(http.MethodPost, userPath(u.ID, "/revoke-sessions"), nil, admin).Expect(http.StatusOK).JSON()
+	if res["revoked_sessions"] != float64(2) {
+		t.Fatalf("revoke-sessions returned %v", res)
+	}
+	for _, s := range []tokenPair{a, b} {
+		srv.Do(http.MethodGet, "/api/search?q=x", nil, apitest.Bearer(s.Token)).Expect(http.StatusUnauthorized)
+		refresh(srv, s.RefreshToken).Expect(http.StatusUnauthorized)
+	}
+	srv.Do(http.MethodGet, "/api/search?q=x", nil, admin).Expect(http.StatusOK)
+	signIn(t, srv, u.Email)
+
+	srv.Do(http.MethodPost, userPath(9999, "/revoke-sessions"), nil, admin).Expect(http.StatusNotFound)
+}
+
+func TestRefreshRefusedForDisabledAccount(t *testing.T) {
+	srv := apitest.New(t)
+	admin := apitest.Bearer(srv.AdminToken())
+	u := srv.CreateUser("someone@example.com", "user")
+	session := signIn(t, srv, u.Email)
+
+	srv.Do(http.MethodPost, userPath(u.ID, "/deactivate"), nil, admin).Expect(http.StatusOK)
+	refresh(srv, session.RefreshToken).Expect(http.StatusUnauthorized)
+}
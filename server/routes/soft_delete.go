@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordKind names an archive record type in responses and the audit log
+type recordKind struct {
+	Type     string // audit/search type, e.g. "test_item"
+	Singular string // JSON key for one record
+	Plural   string // JSON key for a list
+	NotFound string
+}
+
+var (
+	testItemKind    = recordKind{repository.RecordTypeTestItem, "test_item", "test_items", "test item not found"}
+	studyKind       = recordKind{repository.RecordTypeStudy, "study", "studies", "study not found"}
+	facilityDocKind = recordKind{repository.RecordTypeFacilityDoc, "facility_doc", "facility_docs", "facility doc not found"}
+)
+
+type deletionReq struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type restoreReq struct {
+	Reason string `json:"reason"`
+}
+
+// parseIDParam reads :id, writing a 400 response when it is not a number
+func parseIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// listRecords returns the visible records, newest first
+func listRecords[T any](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T]) {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := repo.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{kind.Plural: list})
+}
+
+// listDeleted returns soft-deleted records, newest deletion first
+func listDeleted[T any](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T]) {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := repo.ListDeleted(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{kind.Plural: list})
+}
+
+// softDeleteRecord hides a record from normal lists, keeping the row and
+// recording who deleted it and why
+func softDeleteRecord[T any](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T]) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, repo, id) {
+		return
+	}
+	var req deletionReq
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a deletion reason is required"})
+		return
+	}
+
+	if err := repo.Delete(c.Request.Context(), id, strings.TrimSpace(req.Reason), requestActor(c)); err != nil {
+		writeRecordError(c, kind, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// restoreRecord brings a soft-deleted record back into normal lists
+func restoreRecord[T any](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T]) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, repo, id) {
+		return
+	}
+	var req restoreReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	record, err := repo.Restore(c.Request.Context(), id, strings.TrimSpace(req.Reason), requestActor(c))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted " + kind.NotFound})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{kind.Singular: record})
+}
+
+// purgeRecord permanently removes a soft-deleted record whose retention
+// period has ended. The audit entry survives the row.
+func purgeRecord[T any](c *gin.Context, kind recordKind, repo repository.ArchiveRepository[T], retentionYears int) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, repo, id) {
+		return
+	}
+	var req restoreReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := repo.Purge(c.Request.Context(), id, strings.TrimSpace(req.Reason), retentionYears, requestActor(c))
+	if err != nil {
+		var retained repository.UnderRetentionError
+		switch {
+		case errors.As(err, &retained):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "retained_until": retained.Until.Format("2006-01-02")})
+		case errors.Is(err, repository.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			writeRecordError(c, kind, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "purged"})
+}
+
+// writeRecordError maps a repository error to 404 or 500
+func writeRecordError(c *gin.Context, kind recordKind, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": kind.NotFound})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SponsorHandler owns the sponsor master data that test items and studies
+// refer to
+type SponsorHandler struct {
+	Sponsors repository.SponsorRepository
+}
+
+type sponsorReq struct {
+	Name           string `json:"name" binding:"required"`
+	ContactName    string `json:"contact_name"`
+	ContactEmail   string `json:"contact_email" binding:"omitempty,email"`
+	ContactPhone   string `json:"contact_phone"`
+	Address        string `json:"address"`
+	RetentionYears *int   `json:"retention_years" binding:"omitempty,min=1"`
+	Notes          string `json:"notes"`
+}
+
+// ListSponsors handles GET /api/sponsors?q=
+func (h *SponsorHandler) ListSponsors(c *gin.Context) {
+	sponsors, err := h.Sponsors.List(c.Request.Context(), c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sponsors": sponsors})
+}
+
+// GetSponsor handles GET /api/sponsors/:id
+func (h *SponsorHandler) GetSponsor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	sponsor, err := h.Sponsors.Get(c.Request.Context(), id)
+	if err != nil {
+		writeSponsorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sponsor": sponsor})
+}
+
+// CreateSponsor handles POST /api/sponsors
+func (h *SponsorHandler) CreateSponsor(c *gin.Context) {
+	var sponsor db.Sponsor
+	if !bindSponsor(c, &sponsor) {
+		return
+	}
+	if err := h.Sponsors.Create(c.Request.Context(), &sponsor, requestActor(c)); err != nil {
+		writeSponsorError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"sponsor": sponsor})
+}
+
+// UpdateSponsor handles PUT /api/sponsors/:id, replacing every field. Test
+// items keep the company name they were registered with.
+func (h *SponsorHandler) UpdateSponsor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	sponsor := db.Sponsor{ID: id}
+	if !bindSponsor(c, &sponsor) {
+		return
+	}
+	if err := h.Sponsors.Update(c.Request.Context(), &sponsor, requestActor(c)); err != nil {
+		writeSponsorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sponsor": sponsor})
+}
+
+// DeleteSponsor handles DELETE /api/sponsors/:id for a sponsor no record
+// refers to
+func (h *SponsorHandler) DeleteSponsor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	if !editsAllEntities(c) {
+		return
+	}
+	if err := h.Sponsors.Delete(c.Request.Context(), id, requestActor(c)); err != nil {
+		writeSponsorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "sponsor deleted"})
+}
+
+// bindSponsor reads a sponsor definition into sponsor
+func bindSponsor(c *gin.Context, sponsor *db.Sponsor) bool {
+	if !editsAllEntities(c) {
+		return false
+	}
+	var req sponsorReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	sponsor.Name = name
+	sponsor.ContactName = strings.TrimSpace(req.ContactName)
+	sponsor.ContactEmail = strings.TrimSpace(req.ContactEmail)
+	sponsor.ContactPhone = strings.TrimSpace(req.ContactPhone)
+	sponsor.Address = strings.TrimSpace(req.Address)
+	sponsor.RetentionYears = req.RetentionYears
+	sponsor.Notes = strings.TrimSpace(req.Notes)
+	return true
+}
+
+// editsAllEntities answers 403 unless the user may edit records in every
+// entity, as master data such as sponsors is shared by all of them
+func editsAllEntities(c *gin.Context) bool {
+	if _, limited := permittedEntities(c); limited {
+		c.JSON(http.StatusForbidden, gin.H{"error": "master data is shared by every entity; edit permission in all of them is required"})
+		return false
+	}
+	return true
+}
+
+// sponsorFor resolves the sponsor_id of a record, answering 400 for an
+// unknown sponsor
+func sponsorFor(c *gin.Context, sponsors repository.SponsorRepository, id uint) (*db.Sponsor, bool) {
+	sponsor, err := sponsors.Get(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sponsor_id does not refer to a sponsor"})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return sponsor, true
+}
+
+// companyFollowsSponsor answers 400 unless company, when given, names the
+// sponsor a test item is linked to: the company name of a linked item is
+// the sponsor's, and the sponsor portal matches on either
+func companyFollowsSponsor(c *gin.Context, company *string, sponsor string) bool {
+	if company == nil || strings.EqualFold(strings.TrimSpace(*company), strings.TrimSpace(sponsor)) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "company_name follows the sponsor; change sponsor_id instead"})
+	return false
+}
+
+func writeSponsorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "sponsor not found"})
+	case errors.Is(err, repository.ErrSponsorExists), errors.Is(err, repository.ErrSponsorInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
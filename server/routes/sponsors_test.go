@@ -0,0 +1,72 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"eurofines-server/internal/apitest"
+)
+
+func TestSponsorMasterData(t *testing.T) {
+	srv := apitest.New(t)
+	fx := srv.Seed()
+	admin := apitest.Bearer(srv.AdminToken())
+	user := apitest.Bearer(srv.UserToken())
+
+	sponsor := srv.Do(http.MethodPost, "/api/sponsors", map[string]interface{}{
+		"name": "  ABC   Ltd ", "contact_email": "qa@abc.example", "retention_years": 30,
+	}, admin).Expect(http.StatusCreated).JSON()["sponsor"].(map[string]interface{})
+	if sponsor["name"] != "ABC Ltd" {
+		t.Fatalf("sponsor = %v", sponsor)
+	}
+	srv.Do(http.MethodPost, "/api/sponsors", map[string]interface{}{"name": "abc ltd"}, admin).Expect(http.StatusConflict)
+	srv.Do(http.MethodPost, "/api/sponsors", map[string]interface{}{"name": "Bad", "contact_email": "nope"}, admin).Expect(http.StatusBadRequest)
+	list := srv.Do(http.MethodGet, "/api/sponsors?q=abc", nil, user).Expect(http.StatusOK).JSON()["sponsors"].([]interface{})
+	if len(list) != 1 {
+		t.Fatalf("sponsors = %v", list)
+	}
+
+	// records take the sponsor's name, and no other company name beside it
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+		"test_item_name": "buffer", "company_name": "abc", "sponsor_id": sponsor["id"], "entity": "agro",
+	}, admin).Expect(http.StatusBadRequest)
+	item := srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{
+		"test_item_name": "buffer", "company_name": "abc ltd", "sponsor_id": sponsor["id"], "entity": "agro",
+	}, admin).Expect(http.StatusCreated).JSON()["test_item"].(map[string]interface{})
+	if item["company_name"] != "ABC Ltd" || item["sponsor_id"] != sponsor["id"] {
+		t.Fatalf("test item = %v", item)
+	}
+	itemPath := fmt.Sprintf("/api/test-items/%v", item["id"])
+	srv.Do(http.MethodPatch, itemPath, map[string]interface{}{"company_name": "Acme Pharma", "version": 1}, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPatch, fmt.Sprintf("/api/test-items/%d", fx.TestItems["agro"].ID),
+		map[string]interface{}{"company_name": "Globex", "sponsor_id": sponsor["id"], "version": 1}, admin).Expect(http.StatusBadRequest)
+	srv.Do(http.MethodPost, "/api/test-items", map[string]interface{}{"test_item_name": "x", "sponsor_id": 999, "entity": "agro"}, admin).
+		Expect(http.StatusBadRequest)
+	studyPath := fmt.Sprintf("/api/studies/%d", fx.Studies["agro"].ID)
+	study := srv.Do(http.MethodPatch, studyPath, map[string]interface{}{"sponsor_id": sponsor["id"], "version": 1}, admin).
+		Expect(http.StatusOK).JSON()["study"].(map[string]interface{})
+	if study["sponsor_id"] != sponsor["id"] {
+		t.Fatalf("study = %v", study)
+	}
+
+	sponsorPath := fmt.Sprintf("/api/sponsors/%v", sponsor["id"])
+	srv.Do(http.MethodPut, sponsorPath, map[string]interface{}{"name": "ABC Limited", "retention_years": 30}, user).
+		Expect(http.StatusOK)
+	// a rename reaches the linked test items
+	item = srv.Do(http.MethodGet, itemPath, nil, admin).Expect(http.StatusOK).JSON()["test_item"].(map[string]interface{})
+	if item["company_name"] != "ABC Limited" || item["version"] != float64(2) {
+		t.Fatalf("test item after rename = %v", item)
+	}
+	srv.Do(http.MethodDelete, sponsorPath, nil, admin).Expect(http.StatusConflict)
+
+	// the sponsor's longer retention holds the purge back
+	srv.DB.Exec("UPDATE test_items SET date_of_archive = '2000-01-01' WHERE id = ?", item["id"])
+	srv.Do(http.MethodDelete, itemPath, map[string]string{"reason": "expired"}, admin).Expect(http.StatusOK)
+	refused := srv.Do(http.MethodDelete, itemPath+"/purge", nil, admin).Expect(http.StatusConflict).JSON()
+	if refused["retained_until"] != "2030-01-01" {
+		t.Fatalf("purge = %v", refused)
+	}
+	srv.Do(http.MethodPut, sponsorPath, map[string]interface{}{"name": "ABC Limited"}, admin).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, itemPath+"/purge", nil, admin).Expect(http.StatusOK)
+}
@@ -1,24 +1,35 @@
 package routes
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
+	"eurofines-server/config"
 	"eurofines-server/db"
+	"eurofines-server/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-type StudyHandler struct{}
+type StudyHandler struct {
+	Repo      repository.StudyRepository
+	Sponsors  repository.SponsorRepository
+	Personnel repository.PersonnelRepository
+	AccessLog repository.AccessLogRepository
+	Config    *config.Config
+}
 
 type createStudyReq struct {
-	StudyNumber   string  `json:"study_number" binding:"required"`
-	StudyCode     string  `json:"study_code"`
-	TestItemCode  string  `json:"test_item_code"`
-	SdOrPiName    string  `json:"sd_or_pi_name"`
-	DateOfReceipt *string `json:"date_of_receipt"`
-	Entity        string  `json:"entity" binding:"required,oneof=adgyl agro biopharma"`
-	CreatedBy     *uint   `json:"created_by"`
+	StudyNumber     string  `json:"study_number" binding:"required"`
+	StudyCode       string  `json:"study_code"`
+	TestItemCode    string  `json:"test_item_code"`
+	SponsorID       *uint   `json:"sponsor_id"`
+	SdOrPiName      string  `json:"sd_or_pi_name"`
+	StudyDirectorID *uint   `json:"study_director_id"`
+	DateOfReceipt   *string `json:"date_of_receipt"`
+	Entity          string  `json:"entity" binding:"required,oneof=adgyl agro biopharma"`
+	CreatedBy       *uint   `json:"created_by"`
 }
 
 func (h *StudyHandler) CreateStudy(c *gin.Context) {
@@ -28,6 +39,11 @@ func (h *StudyHandler) CreateStudy(c *gin.Context) {
 		return
 	}
 
+	if !entityAllowed(c, req.Entity) {
+		writeEntityDenied(c, req.Entity)
+		return
+	}
+
 	st := db.Study{
 		StudyNumber: req.StudyNumber,
 		StudyCode:   req.StudyCode,
@@ -35,9 +51,23 @@ func (h *StudyHandler) CreateStudy(c *gin.Context) {
 		SdOrPiName: req.SdOrPiName,
 		Entity: req.Entity,
 		CreatedBy: req.CreatedBy,
+		Version: 1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if req.SponsorID != nil {
+		if _, ok := sponsorFor(c, h.Sponsors, *req.SponsorID); !ok {
+			return
+		}
+		st.SponsorID = req.SponsorID
+	}
+	if req.StudyDirectorID != nil {
+		person, ok := personFor(c, h.Personnel, *req.StudyDirectorID, "study_director_id", db.PersonStudyDirector, db.PersonPI)
+		if !ok {
+			return
+		}
+		st.StudyDirectorID, st.SdOrPiName = &person.ID, person.Name
+	}
 
 	if req.DateOfReceipt != nil && *req.DateOfReceipt != "" {
 		var d db.Date
@@ -46,7 +76,7 @@ func (h *StudyHandler) CreateStudy(c *gin.Context) {
 		}
 	}
 
-	if err := db.DB.Create(&st).Error; err != nil {
+	if err := h.Repo.Create(c.Request.Context(), &st, requestActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -54,10 +84,194 @@ func (h *StudyHandler) CreateStudy(c *gin.Context) {
 }
 
 func (h *StudyHandler) GetStudies(c *gin.Context) {
-	var list []db.Study
-	if err := db.DB.Order("created_at desc").Find(&list).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	listRecords(c, studyKind, h.Repo)
+}
+
+// GetStudy handles GET /api/studies/:id
+func (h *StudyHandler) GetStudy(c *gin.Context) {
+	getRecord(c, studyKind, h.Repo, h.AccessLog)
+}
+
+type updateStudyReq struct {
+	StudyNumber                              *string `json:"study_number"`
+	StudyCode                                *string `json:"study_code"`
+	TestItemCode                             *string `json:"test_item_code"`
+	SponsorID                                *uint   `json:"sponsor_id"`
+	StudyDirectorID                          *uint   `json:"study_director_id"`
+	SdOrPiName                               *string `json:"sd_or_pi_name"`
+	StudyPlanPageNo                          *string `json:"study_plan_page_no"`
+	StudyPlanAmendmentPages                  *string `json:"study_plan_amendment_pages"`
+	DateOfReceipt                            *string `json:"date_of_receipt"`
+	RdIndex                                  *string `json:"rd_index"`
+	FrIndex                                  *string `json:"fr_index"`
+	BlockSlidesIndex                         *string `json:"block_slides_index"`
+	TissuesIndex                             *string `json:"tissues_index"`
+	CarcassIndex                             *string `json:"carcass_index"`
+	RawDataCount                             *int    `json:"raw_data_count"`
+	FinalOrTerminatedReport                  *string `json:"final_or_terminated_report"`
+	AmendmentToFinalReport                   *string `json:"amendment_to_final_report"`
+	Others                                   *string `json:"others"`
+	ElectronicDataArchivedUsingArchiveSystem *bool   `json:"electronic_data_archived_using_archive_system"`
+	ManuallyArchivingData                    *bool   `json:"manually_archiving_data"`
+	ProvantisData                            *bool   `json:"provantis_data"`
+	EmpowerData                              *bool   `json:"empower_data"`
+	OtherElectronicIfAny                     *bool   `json:"other_electronic_if_any"`
+	DetailsOfElectronicDataArchivedThrough   *string `json:"details_of_electronic_data_archived_through"`
+	BlockSlidesNameBoxNo                     *string `json:"block_slides_name_box_no"`
+	BlockSlidesNoOfBox                       *string `json:"block_slides_no_of_box"`
+	TissueBoxNameBoxNo                       *string `json:"tissue_box_name_box_no"`
+	TissueBoxNoOfBox                         *string `json:"tissue_box_no_of_box"`
+	CarcassBoxNameBoxNo                      *string `json:"carcass_box_name_box_no"`
+	CarcassBoxNoOfBox                        *string `json:"carcass_box_no_of_box"`
+	StudyCompletionDate                      *string `json:"study_completion_date"`
+	Remarks                                  *string `json:"remarks"`
+	RawDataItems                             *string `json:"raw_data_items"`
+	Entity                                   *string `json:"entity" binding:"omitempty,oneof=adgyl agro biopharma"`
+	Version                                  *int    `json:"version"`
+}
+
+// UpdateStudy handles PUT/PATCH /api/studies/:id. The client must send the
+// version it edited via If-Match or the version field.
+func (h *StudyHandler) UpdateStudy(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	current, err := h.Repo.Get(c.Request.Context(), id)
+	if err != nil {
+		writeRecordError(c, studyKind, err)
+		return
+	}
+	if !entityAllowed(c, current.Entity) {
+		writeRecordError(c, studyKind, repository.ErrNotFound)
+		return
+	}
+
+	var req updateStudyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	u := partialUpdate{}
+	u.setString("study_number", req.StudyNumber)
+	u.setString("study_code", req.StudyCode)
+	u.setString("test_item_code", req.TestItemCode)
+	u.setString("sd_or_pi_name", req.SdOrPiName)
+	// sponsor_id 0 removes the sponsor
+	if req.SponsorID != nil && *req.SponsorID == 0 {
+		u["sponsor_id"] = nil
+	} else if req.SponsorID != nil {
+		if _, ok := sponsorFor(c, h.Sponsors, *req.SponsorID); !ok {
+			return
+		}
+		u["sponsor_id"] = *req.SponsorID
+	}
+	// study_director_id 0 unlinks the SD/PI, keeping the name
+	if req.StudyDirectorID != nil && *req.StudyDirectorID == 0 {
+		u["study_director_id"] = nil
+	} else if req.StudyDirectorID != nil {
+		person, ok := personFor(c, h.Personnel, *req.StudyDirectorID, "study_director_id", db.PersonStudyDirector, db.PersonPI)
+		if !ok {
+			return
+		}
+		u["study_director_id"], u["sd_or_pi_name"] = person.ID, person.Name
+	}
+	u.setString("study_plan_page_no", req.StudyPlanPageNo)
+	u.setString("study_plan_amendment_pages", req.StudyPlanAmendmentPages)
+	u.setString("rd_index", req.RdIndex)
+	u.setString("fr_index", req.FrIndex)
+	u.setString("block_slides_index", req.BlockSlidesIndex)
+	u.setString("tissues_index", req.TissuesIndex)
+	u.setString("carcass_index", req.CarcassIndex)
+	u.setInt("raw_data_count", req.RawDataCount)
+	u.setString("final_or_terminated_report", req.FinalOrTerminatedReport)
+	u.setString("amendment_to_final_report", req.AmendmentToFinalReport)
+	u.setString("others", req.Others)
+	u.setBool("electronic_data_archived_using_archive_system", req.ElectronicDataArchivedUsingArchiveSystem)
+	u.setBool("manually_archiving_data", req.ManuallyArchivingData)
+	u.setBool("provantis_data", req.ProvantisData)
+	u.setBool("empower_data", req.EmpowerData)
+	u.setBool("other_electronic_if_any", req.OtherElectronicIfAny)
+	u.setString("details_of_electronic_data_archived_through", req.DetailsOfElectronicDataArchivedThrough)
+	u.setString("block_slides_name_box_no", req.BlockSlidesNameBoxNo)
+	u.setString("block_slides_no_of_box", req.BlockSlidesNoOfBox)
+	u.setString("tissue_box_name_box_no", req.TissueBoxNameBoxNo)
+	u.setString("tissue_box_no_of_box", req.TissueBoxNoOfBox)
+	u.setString("carcass_box_name_box_no", req.CarcassBoxNameBoxNo)
+	u.setString("carcass_box_no_of_box", req.CarcassBoxNoOfBox)
+	u.setString("remarks", req.Remarks)
+	if req.RawDataItems != nil {
+		// raw_data_items is a jsonb column: empty clears it, anything else must be JSON
+		switch {
+		case *req.RawDataItems == "":
+			u["raw_data_items"] = nil
+		case !json.Valid([]byte(*req.RawDataItems)):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "raw_data_items must be valid JSON"})
+			return
+		default:
+			u["raw_data_items"] = *req.RawDataItems
+		}
+	}
+	if req.Entity != nil && !entityAllowed(c, *req.Entity) {
+		writeEntityDenied(c, *req.Entity)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"studies": list})
+	u.setString("entity", req.Entity)
+	for column, v := range map[string]*string{
+		"date_of_receipt":       req.DateOfReceipt,
+		"study_completion_date": req.StudyCompletionDate,
+	} {
+		if err := u.setDate(column, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if len(u) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+		return
+	}
+
+	updateRecord(c, studyKind, h.Repo, id, expected, u)
+}
+
+// DeleteStudy handles DELETE /api/studies/:id (soft delete, reason required)
+func (h *StudyHandler) DeleteStudy(c *gin.Context) {
+	softDeleteRecord(c, studyKind, h.Repo)
+}
+
+// GetDeletedStudies handles GET /api/studies/deleted
+func (h *StudyHandler) GetDeletedStudies(c *gin.Context) {
+	listDeleted(c, studyKind, h.Repo)
+}
+
+// RestoreStudy handles POST /api/studies/:id/restore
+func (h *StudyHandler) RestoreStudy(c *gin.Context) {
+	restoreRecord(c, studyKind, h.Repo)
+}
+
+// PurgeStudy handles DELETE /api/studies/:id/purge
+func (h *StudyHandler) PurgeStudy(c *gin.Context) {
+	purgeRecord(c, studyKind, h.Repo, h.Config.RetentionYears)
+}
+
+// GetStudyVersions handles GET /api/studies/:id/versions
+func (h *StudyHandler) GetStudyVersions(c *gin.Context) {
+	listVersions(c, studyKind, h.Repo, h.AccessLog)
+}
+
+// GetStudyVersion handles GET /api/studies/:id/versions/:n
+func (h *StudyHandler) GetStudyVersion(c *gin.Context) {
+	getVersion(c, studyKind, h.Repo, h.AccessLog)
+}
+
+// DiffStudy handles GET /api/studies/:id/diff?from=&to=
+func (h *StudyHandler) DiffStudy(c *gin.Context) {
+	diffVersions(c, studyKind, h.Repo, h.AccessLog)
 }
@@ -2,25 +2,33 @@ package routes
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
+	"eurofines-server/config"
 	"eurofines-server/db"
+	"eurofines-server/repository"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // TestItemHandler owns test-item handlers
-type TestItemHandler struct{}
+type TestItemHandler struct {
+	Repo      repository.TestItemRepository
+	Sponsors  repository.SponsorRepository
+	Personnel repository.PersonnelRepository
+	AccessLog repository.AccessLogRepository
+	Config    *config.Config
+}
 
 // Request shape for creating/updating
 type createTestItemReq struct {
 	TestItemName  string  `json:"test_item_name" binding:"required"`
 	TestItemCode  string  `json:"test_item_code"`
 	CompanyName   string  `json:"company_name"`
+	SponsorID     *uint   `json:"sponsor_id"`
 	DateOfReceipt *string `json:"date_of_receipt"`
 	BatchNo       string  `json:"batch_no"`
+	ArchivedByID  *uint   `json:"archived_by_id"`
 	Storage       string  `json:"storage"`
 	ExpiryDate    *string `json:"expiry_date"`
 	Remark        string  `json:"remark"`
@@ -35,6 +43,10 @@ func (h *TestItemHandler) CreateTestItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !entityAllowed(c, req.Entity) {
+		writeEntityDenied(c, req.Entity)
+		return
+	}
 
 	ti := db.TestItem{
 		TestItemName: req.TestItemName,
@@ -45,9 +57,28 @@ func (h *TestItemHandler) CreateTestItem(c *gin.Context) {
 		Remark:       req.Remark,
 		Entity:       req.Entity,
 		CreatedBy:    req.CreatedBy,
+		Version:      1,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	// the sponsor's name is the company name
+	if req.SponsorID != nil {
+		sponsor, ok := sponsorFor(c, h.Sponsors, *req.SponsorID)
+		if !ok {
+			return
+		}
+		if req.CompanyName != "" && !companyFollowsSponsor(c, &req.CompanyName, sponsor.Name) {
+			return
+		}
+		ti.SponsorID, ti.CompanyName = &sponsor.ID, sponsor.Name
+	}
+	if req.ArchivedByID != nil {
+		person, ok := personFor(c, h.Personnel, *req.ArchivedByID, "archived_by_id", db.PersonArchivist)
+		if !ok {
+			return
+		}
+		ti.ArchivedByID, ti.ArchivedBy = &person.ID, person.Name
+	}
 
 	// parse dates into db.Date if provided
 	if req.DateOfReceipt != nil && *req.DateOfReceipt != "" {
@@ -63,7 +94,7 @@ func (h *TestItemHandler) CreateTestItem(c *gin.Context) {
 		}
 	}
 
-	if err := db.DB.Create(&ti).Error; err != nil {
+	if err := h.Repo.Create(c.Request.Context(), &ti, requestActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -72,51 +103,29 @@ func (h *TestItemHandler) CreateTestItem(c *gin.Context) {
 
 // GetTestItems handles GET /api/test-items
 func (h *TestItemHandler) GetTestItems(c *gin.Context) {
-	var items []db.TestItem
-	if err := db.DB.Order("created_at desc").Find(&items).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"test_items": items})
+	listRecords(c, testItemKind, h.Repo)
 }
 
 // GetTestItem handles GET /api/test-items/:id
 func (h *TestItemHandler) GetTestItem(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
+	getRecord(c, testItemKind, h.Repo, h.AccessLog)
+}
 
-	var item db.TestItem
-	if err := db.DB.First(&item, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "test item not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// UpdateTestItem handles PUT/PATCH /api/test-items/:id. The client must send
+// the version it edited via If-Match or the version field.
+func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"test_item": item})
-}
 
-// UpdateTestItem handles PUT /api/test-items/:id
-func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	current, err := h.Repo.Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		writeRecordError(c, testItemKind, err)
 		return
 	}
-
-	var existing db.TestItem
-	if err := db.DB.First(&existing, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "test item not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !entityAllowed(c, current.Entity) {
+		writeRecordError(c, testItemKind, repository.ErrNotFound)
 		return
 	}
 
@@ -125,6 +134,8 @@ func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
 		TestItemName  *string `json:"test_item_name"`
 		TestItemCode  *string `json:"test_item_code"`
 		CompanyName   *string `json:"company_name"`
+		SponsorID     *uint   `json:"sponsor_id"`
+		ArchivedByID  *uint   `json:"archived_by_id"`
 		DateOfReceipt *string `json:"date_of_receipt"`
 		BatchNo       *string `json:"batch_no"`
 		Storage       *string `json:"storage"`
@@ -132,12 +143,18 @@ func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
 		Remark        *string `json:"remark"`
 		Entity        *string `json:"entity"`
 		CreatedBy     *uint   `json:"created_by"`
+		Version       *int    `json:"version"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
 	updates := map[string]interface{}{}
 
 	if req.TestItemName != nil {
@@ -149,6 +166,32 @@ func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
 	if req.CompanyName != nil {
 		updates["company_name"] = *req.CompanyName
 	}
+	// sponsor_id 0 removes the sponsor, keeping the company name unless one
+	// is given. While linked the company name is the sponsor's.
+	if req.SponsorID != nil && *req.SponsorID == 0 {
+		updates["sponsor_id"] = nil
+	} else if req.SponsorID != nil {
+		sponsor, ok := sponsorFor(c, h.Sponsors, *req.SponsorID)
+		if !ok || !companyFollowsSponsor(c, req.CompanyName, sponsor.Name) {
+			return
+		}
+		updates["sponsor_id"], updates["company_name"] = sponsor.ID, sponsor.Name
+	} else if current.SponsorID != nil {
+		if !companyFollowsSponsor(c, req.CompanyName, current.CompanyName) {
+			return
+		}
+		delete(updates, "company_name")
+	}
+	// likewise archived_by_id 0 unlinks the archivist
+	if req.ArchivedByID != nil && *req.ArchivedByID == 0 {
+		updates["archived_by_id"] = nil
+	} else if req.ArchivedByID != nil {
+		person, ok := personFor(c, h.Personnel, *req.ArchivedByID, "archived_by_id", db.PersonArchivist)
+		if !ok {
+			return
+		}
+		updates["archived_by_id"], updates["archived_by"] = person.ID, person.Name
+	}
 	if req.BatchNo != nil {
 		updates["batch_no"] = *req.BatchNo
 	}
@@ -159,6 +202,10 @@ func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
 		updates["remark"] = *req.Remark
 	}
 	if req.Entity != nil {
+		if !entityAllowed(c, *req.Entity) {
+			writeEntityDenied(c, *req.Entity)
+			return
+		}
 		updates["entity"] = *req.Entity
 	}
 	if req.CreatedBy != nil {
@@ -184,43 +231,40 @@ func (h *TestItemHandler) UpdateTestItem(c *gin.Context) {
 		return
 	}
 
-	if err := db.DB.Model(&existing).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	updateRecord(c, testItemKind, h.Repo, id, expected, updates)
+}
 
-	// return updated record
-	if err := db.DB.First(&existing, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+// DeleteTestItem handles DELETE /api/test-items/:id (soft delete, reason required)
+func (h *TestItemHandler) DeleteTestItem(c *gin.Context) {
+	softDeleteRecord(c, testItemKind, h.Repo)
+}
 
-	c.JSON(http.StatusOK, gin.H{"test_item": existing})
+// GetDeletedTestItems handles GET /api/test-items/deleted
+func (h *TestItemHandler) GetDeletedTestItems(c *gin.Context) {
+	listDeleted(c, testItemKind, h.Repo)
 }
 
-// DeleteTestItem handles DELETE /api/test-items/:id
-func (h *TestItemHandler) DeleteTestItem(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
+// RestoreTestItem handles POST /api/test-items/:id/restore
+func (h *TestItemHandler) RestoreTestItem(c *gin.Context) {
+	restoreRecord(c, testItemKind, h.Repo)
+}
 
-	var item db.TestItem
-	if err := db.DB.First(&item, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "test item not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+// PurgeTestItem handles DELETE /api/test-items/:id/purge
+func (h *TestItemHandler) PurgeTestItem(c *gin.Context) {
+	purgeRecord(c, testItemKind, h.Repo, h.Config.RetentionYears)
+}
 
-	if err := db.DB.Delete(&item).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+// GetTestItemVersions handles GET /api/test-items/:id/versions
+func (h *TestItemHandler) GetTestItemVersions(c *gin.Context) {
+	listVersions(c, testItemKind, h.Repo, h.AccessLog)
+}
+
+// GetTestItemVersion handles GET /api/test-items/:id/versions/:n
+func (h *TestItemHandler) GetTestItemVersion(c *gin.Context) {
+	getVersion(c, testItemKind, h.Repo, h.AccessLog)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+// DiffTestItem handles GET /api/test-items/:id/diff?from=&to=
+func (h *TestItemHandler) DiffTestItem(c *gin.Context) {
+	diffVersions(c, testItemKind, h.Repo, h.AccessLog)
 }
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"fmt"
+
+	"eurofines-server/db"
+)
+
+// partialUpdate collects the columns present in a PUT/PATCH payload.
+// Absent (nil) fields are left untouched.
+type partialUpdate map[string]interface{}
+
+func (u partialUpdate) setString(column string, v *string) {
+	if v != nil {
+		u[column] = *v
+	}
+}
+
+func (u partialUpdate) setBool(column string, v *bool) {
+	if v != nil {
+		u[column] = *v
+	}
+}
+
+func (u partialUpdate) setInt(column string, v *int) {
+	if v != nil {
+		u[column] = *v
+	}
+}
+
+// setDate parses a YYYY-MM-DD value; an empty string clears the date
+func (u partialUpdate) setDate(column string, v *string) error {
+	if v == nil {
+		return nil
+	}
+	if *v == "" {
+		u[column] = nil
+		return nil
+	}
+	var d db.Date
+	if err := d.UnmarshalJSON([]byte(`"` + *v + `"`)); err != nil {
+		return fmt.Errorf("%s: %w", column, err)
+	}
+	u[column] = &d
+	return nil
+}
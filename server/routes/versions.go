@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eurofines-server/db"
+	"eurofines-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionView is a stored version together with the record snapshot
+type versionView struct {
+	db.RecordVersion
+	Data json.RawMessage `json:"data"`
+}
+
+// versionStore is the version history side of an archive repository
+type versionStore interface {
+	Versions(ctx context.Context, id uint) ([]db.RecordVersion, error)
+	Version(ctx context.Context, id uint, n int) (*db.RecordVersion, error)
+	VersionAt(ctx context.Context, id uint, at time.Time) (*db.RecordVersion, error)
+	LatestVersion(ctx context.Context, id uint) (int, error)
+	entityLookup
+}
+
+// listVersions handles GET /:id/versions. With ?as_of= (YYYY-MM-DD or
+// RFC3339) it instead returns the version that was current at that time.
+func listVersions(c *gin.Context, kind recordKind, store versionStore, accessLog repository.AccessLogRepository) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, store, id) {
+		return
+	}
+
+	if asOf := c.Query("as_of"); asOf != "" {
+		at, err := parseAsOf(asOf)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		v, err := store.VersionAt(c.Request.Context(), id, at)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no version of this record existed at " + asOf})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordHistoryView(c, accessLog, kind, v) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"version": versionView{*v, json.RawMessage(v.Data)}})
+		return
+	}
+
+	versions, err := store.Versions(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no versions recorded for this " + kind.Singular})
+		return
+	}
+	if !recordHistoryView(c, accessLog, kind, &versions[len(versions)-1]) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// getVersion handles GET /:id/versions/:n
+func getVersion(c *gin.Context, kind recordKind, store versionStore, accessLog repository.AccessLogRepository) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, store, id) {
+		return
+	}
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil || n < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+
+	v, err := store.Version(c.Request.Context(), id, n)
+	if err != nil {
+		writeVersionError(c, err)
+		return
+	}
+	if !recordHistoryView(c, accessLog, kind, v) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"version": versionView{*v, json.RawMessage(v.Data)}})
+}
+
+// diffVersions handles GET /:id/diff?from=&to=. to defaults to the latest
+// version and from to the one before it.
+func diffVersions(c *gin.Context, kind recordKind, store versionStore, accessLog repository.AccessLogRepository) {
+	id, ok := parseIDParam(c)
+	if !ok || !checkRecordEntity(c, kind, store, id) {
+		return
+	}
+
+	to := 0
+	if s := c.Query("to"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to version"})
+			return
+		}
+		to = n
+	} else {
+		latest, err := store.LatestVersion(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		to = latest
+	}
+	from := to - 1
+	if s := c.Query("from"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from version"})
+			return
+		}
+		from = n
+	}
+	if from < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least two versions are needed for a diff"})
+		return
+	}
+
+	fromV, err := store.Version(c.Request.Context(), id, from)
+	if err != nil {
+		writeVersionError(c, err)
+		return
+	}
+	toV, err := store.Version(c.Request.Context(), id, to)
+	if err != nil {
+		writeVersionError(c, err)
+		return
+	}
+
+	changes, err := db.DiffVersions(fromV, toV)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !recordHistoryView(c, accessLog, kind, toV) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": fromV, "to": toV, "changes": changes})
+}
+
+func writeVersionError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// parseAsOf accepts a date (meaning the end of that day) or an RFC3339 timestamp
+func parseAsOf(s string) (time.Time, error) {
+	if d, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return d.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid as_of, expected YYYY-MM-DD or RFC3339")
+	}
+	return t, nil
+}
@@ -1,11 +1,12 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
-	"eurofines-server/config"
-
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -14,9 +15,29 @@ type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// SessionID is the session the token was issued for; revoking the
+	// session invalidates its access tokens too
+	SessionID uint `json:"sid,omitempty"`
+	// MFA is set when the session was verified with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// Purpose marks tokens that are not access tokens, such as MFA challenges
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// purposeMFAChallenge marks the token handed out between password and second factor
+const purposeMFAChallenge = "mfa_challenge"
+
+// ErrTokenRevoked is returned by ValidateToken for a token that was revoked
+// before it expired
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore reports whether an access token, identified by its ID
+// (jti) and session, has been revoked
+type RevocationStore interface {
+	IsRevoked(ctx context.Context, tokenID string, sessionID uint) (bool, error)
+}
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -27,38 +48,97 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func GenerateToken(userID uint, email, role string) (string, error) {
-	cfg := config.LoadConfig()
-
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// TokenManager issues and validates HS256 access tokens
+type TokenManager struct {
+	secret  []byte
+	expiry  time.Duration
+	revoked RevocationStore
+}
+
+// NewTokenManager returns a TokenManager signing with secret; tokens expire
+// after expiry. ValidateToken rejects tokens revoked in the store, if any.
+func NewTokenManager(secret string, expiry time.Duration, revoked RevocationStore) *TokenManager {
+	return &TokenManager{secret: []byte(secret), expiry: expiry, revoked: revoked}
+}
+
+// Expiry is the lifetime of issued access tokens
+func (m *TokenManager) Expiry() time.Duration {
+	return m.expiry
+}
+
+// GenerateToken issues an access token for the user's session; mfa records
+// whether the session passed a second factor
+func (m *TokenManager) GenerateToken(userID uint, email, role string, sessionID uint, mfa bool) (string, error) {
+	return m.sign(Claims{UserID: userID, Email: email, Role: role, SessionID: sessionID, MFA: mfa}, m.expiry)
+}
+
+// GenerateChallenge issues a token proving the user's password was checked,
+// to be exchanged for an access token together with a second factor. It is
+// not accepted by ValidateToken.
+func (m *TokenManager) GenerateChallenge(userID uint, expiry time.Duration) (string, error) {
+	return m.sign(Claims{UserID: userID, Purpose: purposeMFAChallenge}, expiry)
+}
+
+func (m *TokenManager) sign(claims Claims, expiry time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        hex.EncodeToString(jti),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.JWTSecret))
+	return token.SignedString(m.secret)
+}
+
+// ValidateToken checks the signature, expiry and revocation of tokenString
+func (m *TokenManager) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+	if m.revoked != nil {
+		revoked, err := m.revoked.IsRevoked(ctx, claims.ID, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	cfg := config.LoadConfig()
+// ValidateChallenge checks a token from GenerateChallenge and returns the user ID
+func (m *TokenManager) ValidateChallenge(tokenString string) (uint, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if claims.Purpose != purposeMFAChallenge {
+		return 0, errors.New("not an MFA challenge token")
+	}
+	return claims.UserID, nil
+}
 
+func (m *TokenManager) parse(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
-	})
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-
-	return nil, errors.New("invalid token")
+	return claims, nil
 }
-
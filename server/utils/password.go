@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GeneratePassword returns a random 24-character password for temporary or
+// operator-issued credentials
+func GeneratePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PasswordPolicy is the rule set for passwords users choose
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is how many of lower case, upper case, digits and symbols
+	// a password must contain
+	MinClasses int
+	// MaxAge is how long a password may be used; zero means no expiry
+	MaxAge time.Duration
+	// History is how many recent passwords, including the current one, may
+	// not be chosen again
+	History int
+}
+
+// Check reports why password does not meet the policy, or nil
+func (p PasswordPolicy) Check(password string) error {
+	var problems []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		problems = append(problems, fmt.Sprintf("at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(problems, " and "))
+	}
+	return nil
+}
+
+// Expired reports whether a password set at setAt has expired by now
+func (p PasswordPolicy) Expired(setAt, now time.Time) bool {
+	return p.MaxAge > 0 && !now.Before(setAt.Add(p.MaxAge))
+}
+
+// Reused reports whether password matches any of the given bcrypt hashes
+func (p PasswordPolicy) Reused(password string, hashes []string) bool {
+	for _, hash := range hashes {
+		if CheckPasswordHash(password, hash) {
+			return true
+		}
+	}
+	return false
+}
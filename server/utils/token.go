@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random single-use token for a link or form and
+// the hash to store in its place
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of token, the form opaque tokens are stored and looked up in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix starts every API key, telling keys apart from JWTs in the
+// Authorization header
+const APIKeyPrefix = "efk_"
+
+// NewAPIKey returns a new API key, its hash to store, and the prefix shown
+// in lists to identify it
+func NewAPIKey() (key, hash, prefix string, err error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, HashToken(key), key[:len(APIKeyPrefix)+8], nil
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return len(token) > len(APIKeyPrefix) && token[:len(APIKeyPrefix)] == APIKeyPrefix
+}
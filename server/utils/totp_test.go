@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 key "12345678901234567890", truncated to 6 digits
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Errorf("TOTPCode at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	step := TOTPStep(now)
+	previous, _ := TOTPCode(secret, step-1)
+	stale, _ := TOTPCode(secret, step-3)
+
+	if got, ok := VerifyTOTP(secret, previous, now, 0); !ok || got != step-1 {
+		t.Fatalf("previous step: %d, %v", got, ok)
+	}
+	if _, ok := VerifyTOTP(secret, previous, now, step-1); ok {
+		t.Fatal("code accepted twice")
+	}
+	if _, ok := VerifyTOTP(secret, stale, now, 0); ok {
+		t.Fatal("stale code accepted")
+	}
+}
@@ -137,6 +137,8 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
   };
 
   const signout = () => {
+    // end the session on the server too; local state is cleared regardless
+    void api.logout();
     setUser(null);
     setToken(null);
     setSelectedEntity(null);
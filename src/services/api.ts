@@ -15,6 +15,7 @@ export interface AuthUser {
 
 export interface AuthResponse {
   token: string;
+  refresh_token?: string;
   user: AuthUser;
 }
 
@@ -80,11 +81,39 @@ class ApiService {
     return parsed as T;
   }
 
+  // Exchanges the stored refresh token for new tokens; false if the session is gone
+  private async refreshSession(): Promise<boolean> {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) return false;
+    try {
+      const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      });
+      if (!response.ok) {
+        localStorage.removeItem('refresh_token');
+        return false;
+      }
+      const body = await response.json();
+      localStorage.setItem('token', body.token);
+      localStorage.setItem('refresh_token', body.refresh_token);
+      return true;
+    } catch {
+      return false;
+    }
+  }
+
   private async request<T>(endpoint: string, options: RequestInit = {}): Promise<ApiResponse<T>> {
     const url = `${API_BASE_URL}${endpoint}`;
     const headers = this.buildHeaders(options.headers || {});
     try {
-      const response = await fetch(url, { ...options, headers });
+      let response = await fetch(url, { ...options, headers });
+
+      // access tokens are short-lived: refresh once and retry
+      if (response.status === 401 && !endpoint.startsWith('/auth/') && (await this.refreshSession())) {
+        response = await fetch(url, { ...options, headers: this.buildHeaders(options.headers || {}) });
+      }
 
       // read text first to avoid JSON parse errors
       const text = await response.text();
@@ -133,10 +162,20 @@ class ApiService {
   }
 
   async signin(email: string, password: string) {
-    return this.request<AuthResponse>('/auth/signin', {
+    const res = await this.request<AuthResponse>('/auth/signin', {
       method: 'POST',
       body: JSON.stringify({ email, password }),
     });
+    if (res.data?.refresh_token) {
+      localStorage.setItem('refresh_token', res.data.refresh_token);
+    }
+    return res;
+  }
+
+  async logout() {
+    const res = await this.request<void>('/auth/logout', { method: 'POST' });
+    localStorage.removeItem('refresh_token');
+    return res;
   }
 
   async getCurrentUser() {